@@ -20,8 +20,11 @@ const CommandName = "saveme"
 var backupInProgress bool
 
 func main() {
-	// Configurer la gestion des signaux pour une interruption propre
-	setupSignalHandling()
+	// Configurer la gestion des signaux pour une interruption propre. Le démon gère
+	// lui-même les signaux, pour terminer les sauvegardes en cours avant de s'arrêter.
+	if len(os.Args) < 2 || os.Args[1] != "daemon" {
+		setupSignalHandling()
+	}
 
 	// Initialisation de l'application
 	if err := common.InitApp(); err != nil {
@@ -39,6 +42,8 @@ func main() {
 	switch os.Args[1] {
 	case "watch", "--watch", "-w":
 		commands.HandleWatchCommand(os.Args[2:])
+	case "backup", "--backup", "-b":
+		commands.HandleBackupCommand(os.Args[2:])
 	case "restore", "--restore", "-r":
 		commands.HandleRestoreCommand(os.Args[2:])
 	case "manage", "--manage", "-m":
@@ -47,6 +52,18 @@ func main() {
 		ui.HandleDiscoverCommand(os.Args[2:])
 	case "add":
 		commands.HandleAddCommand(os.Args[2:])
+	case "verify":
+		commands.HandleVerifyCommand(os.Args[2:])
+	case "ls":
+		commands.HandleLsCommand(os.Args[2:])
+	case "cat":
+		commands.HandleCatCommand(os.Args[2:])
+	case "serve":
+		commands.HandleServeCommand(os.Args[2:])
+	case "export":
+		commands.HandleExportCommand(os.Args[2:])
+	case "daemon":
+		commands.HandleDaemonCommand(os.Args[2:])
 	case "--help", "-h":
 		printHelp()
 	case "--version", "-v":
@@ -89,10 +106,17 @@ func printHelp() {
 	fmt.Printf("%sUsage:%s %s [commande] [options]\n\n", bold, nc, CommandName)
 	fmt.Printf("%sCommandes:%s\n", bold, nc)
 	fmt.Println("  watch     Surveiller un répertoire et créer des sauvegardes")
+	fmt.Println("  backup    Sauvegarder une configuration maintenant (--dry-run pour simuler)")
 	fmt.Println("  restore   Restaurer une sauvegarde existante")
 	fmt.Println("  manage    Gérer les sauvegardes existantes")
 	fmt.Println("  discover  Découvrir les serveurs rsync sur le réseau")
 	fmt.Println("  add       Ajouter une nouvelle configuration (ex: add server)")
+	fmt.Println("  verify    Vérifier l'intégrité d'une sauvegarde (ex: verify <id>)")
+	fmt.Println("  ls        Lister le contenu d'une sauvegarde (ex: ls <id> [chemin])")
+	fmt.Println("  cat       Afficher un fichier d'une sauvegarde (ex: cat <id> <chemin>)")
+	fmt.Println("  serve     Exposer les sauvegardes en lecture seule (HTTP/WebDAV, --listen)")
+	fmt.Println("  daemon    Superviser toutes les configurations (intervalles et surveillance)")
+	fmt.Println("  export    Exporter une sauvegarde en archive autonome (ex: export <id> -o x.tar.gz)")
 	fmt.Println("  --help    Afficher cette aide")
 	fmt.Println("  --version Afficher la version")
 	fmt.Println()
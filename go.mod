@@ -3,7 +3,10 @@ module github.com/Noziop/s4v3my4ss
 go 1.18
 
 require (
-	// Les dépendances seront ajoutées ici au fur et à mesure
+	github.com/klauspost/compress v1.17.2
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/crypto v0.14.0
+	golang.org/x/sys v0.13.0
 )
 
-replace github.com/Noziop/s4v3my4ss/internal/ui/ => ./internal/ui/
\ No newline at end of file
+replace github.com/Noziop/s4v3my4ss/internal/ui/ => ./internal/ui/
@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
+	"github.com/Noziop/s4v3my4ss/internal/encryption"
+	"github.com/Noziop/s4v3my4ss/internal/journal"
+	"github.com/Noziop/s4v3my4ss/internal/manifest"
 	"github.com/Noziop/s4v3my4ss/internal/wrappers"
 	"github.com/Noziop/s4v3my4ss/pkg/common"
 )
@@ -24,26 +28,121 @@ type BackupConfig struct {
 	ExcludeFiles []string
 	// Whether to create an incremental backup
 	Incremental bool
+	// Whether to create a differential backup (based on the last full backup, takes precedence over Incremental)
+	Differential bool
+	// Force a full backup every N runs (0 to disable)
+	FullEveryRuns int
+	// Force a full backup every N days (0 to disable)
+	FullEveryDays int
+	// Whether to encrypt the backup at rest
+	Encrypt bool
+	// Name of the destination to use (default destination if empty)
+	DestinationName string
+	// Commands run before the backup
+	PreHooks []common.Hook
+	// Commands run after the backup
+	PostHooks []common.Hook
+	// Only report what the backup would transfer, without writing anything
+	DryRun bool
+	// Change journal kept by the watcher: only the changed paths are read from the source (nil for a full scan)
+	Journal *journal.Journal
 }
 
-// CreateBackup crée une sauvegarde d'un répertoire selon la configuration
+// FromConfig crée les paramètres de sauvegarde d'une configuration enregistrée
+func FromConfig(c common.BackupConfig) BackupConfig {
+	mode := c.BackupMode()
+	return BackupConfig{
+		SourcePath:      c.SourcePath,
+		Name:            c.Name,
+		Compression:     c.Compression,
+		ExcludeDirs:     c.ExcludeDirs,
+		ExcludeFiles:    c.ExcludeFiles,
+		Incremental:     mode == common.BackupModeIncremental,
+		Differential:    mode == common.BackupModeDifferential,
+		FullEveryRuns:   c.FullEveryRuns,
+		FullEveryDays:   c.FullEveryDays,
+		Encrypt:         c.Encrypt,
+		DestinationName: c.DestinationName,
+		PreHooks:        c.PreHooks,
+		PostHooks:       c.PostHooks,
+	}
+}
+
+// CreateBackup crée une sauvegarde d'un répertoire selon la configuration,
+// en exécutant les hooks définis avant et après la sauvegarde.
+// En mode DryRun, seul le résumé de ce qui serait transféré est affiché.
 func CreateBackup(config BackupConfig) error {
+	if config.DryRun {
+		report, err := DryRunBackup(config)
+		if err != nil {
+			return err
+		}
+		report.Print(os.Stdout)
+		return nil
+	}
+	
 	// Générer un ID unique pour la sauvegarde
 	backupID := common.GenerateBackupID(config.Name)
 	
-	// Déterminer le chemin de destination
-	destPath := filepath.Join(common.AppConfig.BackupDestination, backupID)
+	// Déterminer la destination et son format de stockage
+	destRoot, destFormat := resolveDestination(config.DestinationName)
+	
+	env := hookEnv(config, backupID, destRoot)
+	err := runHooks(config.PreHooks, "pre", env, nil)
+	if err == nil {
+		err = createBackup(config, backupID, destRoot, destFormat)
+	}
+	if postErr := runHooks(config.PostHooks, "post", completeHookEnv(env, backupID, err), err); err == nil {
+		err = postErr
+	}
+	return err
+}
+
+// createBackup crée la sauvegarde backupID dans destRoot
+func createBackup(config BackupConfig, backupID, destRoot, destFormat string) error {
+	if destFormat == common.FormatChunks {
+		if config.Encrypt {
+			return fmt.Errorf("le chiffrement n'est pas encore pris en charge pour les dépôts dédupliqués")
+		}
+		return createChunkBackup(config, backupID, destRoot)
+	}
+	destPath := filepath.Join(destRoot, backupID)
 	
-	// Trouver la dernière sauvegarde pour faire une sauvegarde incrémentielle
-	if config.Incremental {
-		// À implémenter: logique pour sauvegarde incrémentielle
-		// Note: cette fonctionnalité sera développée dans une prochaine version
-		// La logique utiliserait findLastBackup() pour établir un lien vers la sauvegarde précédente
-		_, err := findLastBackup(config.Name)
+	// Les sauvegardes compressées sont écrites directement dans l'archive, sans copie intermédiaire
+	if config.Compression {
+		return createCompressedBackup(config, backupID, destPath)
+	}
+	
+	// Les sauvegardes chiffrées sont chiffrées à la lecture de la source, sans passer par rsync
+	if config.Encrypt {
+		return createEncryptedBackup(config, backupID, destPath)
+	}
+	
+	// Trouver la sauvegarde de base: la précédente en mode incrémentiel,
+	// la dernière sauvegarde complète en mode différentiel
+	rsyncOpts := wrappers.BackupOptions{
+		ExcludeDirs:  config.ExcludeDirs,
+		ExcludeFiles: config.ExcludeFiles,
+	}
+	backupType := common.BackupModeFull
+	var parent common.BackupInfo
+	if config.mode() != common.BackupModeFull {
+		var err error
+		parent, backupType, err = selectBase(config)
 		if err != nil {
-			fmt.Printf("Note: première sauvegarde de '%s', création d'une sauvegarde complète.\n", config.Name)
+			common.LogInfo("Sauvegarde complète pour '%s': %v", config.Name, err)
+			fmt.Printf("Note: %v, création d'une sauvegarde complète.\n", err)
+		} else {
+			rsyncOpts.Incremental = true
+			rsyncOpts.LinkDest = parent.BackupPath
+			fmt.Printf("Sauvegarde %s basée sur %s.\n", getBackupTypeStr(backupType, false), parent.ID)
 		}
 	}
+
+	// Chemins modifiés depuis le début de la sauvegarde parente, relevés par la surveillance.
+	// Le journal relève ensuite les modifications depuis le début de cette sauvegarde.
+	changes, journaled := config.Journal.Begin(backupID, parent.ID)
+	journaled = journaled && rsyncOpts.Incremental
 	
 	// Créer le répertoire de destination
 	if err := os.MkdirAll(destPath, 0755); err != nil {
@@ -51,38 +150,59 @@ func CreateBackup(config BackupConfig) error {
 	}
 	
 	fmt.Printf("Création d'une sauvegarde %s de %s vers %s...\n", 
-		getBackupTypeStr(config.Incremental, config.Compression),
+		getBackupTypeStr(backupType, config.Compression),
 		config.SourcePath, 
 		destPath)
 	
-	// Effectuer la sauvegarde avec rsync
-	if err := wrappers.RsyncBackup(config.SourcePath, destPath, config.ExcludeDirs, config.ExcludeFiles, config.Compression, nil); err != nil {
+	// Effectuer la sauvegarde avec rsync, limitée aux chemins modifiés si le journal les couvre tous
+	var stats *common.TransferStats
+	var err error
+	if journaled {
+		fmt.Printf("%d chemin(s) modifié(s) d'après le journal de surveillance.\n", len(changes))
+		if stats, err = syncChanges(config, parent.BackupPath, destPath, changes, rsyncOpts); err != nil {
+			// La copie partielle partage des fichiers avec la sauvegarde parente: elle est recréée
+			common.LogWarning("Journal des modifications inutilisable pour '%s', analyse complète: %v", config.Name, err)
+			fmt.Printf("Note: analyse complète de la source (%v).\n", err)
+			journaled = false
+			if err := os.RemoveAll(destPath); err != nil {
+				return fmt.Errorf("impossible de nettoyer la sauvegarde partielle: %w", err)
+			}
+			if err := os.MkdirAll(destPath, 0755); err != nil {
+				return fmt.Errorf("impossible de créer le répertoire de destination: %w", err)
+			}
+		}
+	}
+	if !journaled {
+		_, stats, err = wrappers.RsyncBackup(config.SourcePath, destPath, rsyncOpts, config.Compression, nil)
+	}
+	if err != nil {
 		return fmt.Errorf("erreur lors de la sauvegarde avec rsync: %w", err)
 	}
 	
-	// Calculer la taille de la sauvegarde avant compression
-	size, err := getDirSize(destPath)
+	// Décrire le contenu de la sauvegarde
+	manifestPath := destPath + manifest.Extension
+	var previous *manifest.Manifest
+	if rsyncOpts.Incremental && parent.ManifestPath != "" {
+		previous, _ = manifest.Load(parent.ManifestPath, nil)
+	}
+	m, err := manifest.Build(backupID, manifest.WalkDir(destPath, nil), previous)
+	if err == nil {
+		err = m.Save(manifestPath, nil)
+	}
 	if err != nil {
-		fmt.Printf("Impossible de calculer la taille de la sauvegarde avant compression: %v\n", err)
-		size = 0 // Initialiser pour éviter des erreurs plus tard
+		common.LogWarning("Impossible de créer le manifeste de %s: %v", backupID, err)
+		fmt.Printf("Avertissement: impossible de créer le manifeste de la sauvegarde: %v\n", err)
+		manifestPath = ""
 	}
 	
-	finalDestPath := destPath // Chemin final qui sera utilisé pour les métadonnées
-	
-	// Si la compression est activée, compresser la sauvegarde
-	if config.Compression {
-		compressedFile := destPath + ".tar.gz"
-		if err := compressBackup(destPath, config.Name); err != nil {
-			return fmt.Errorf("erreur lors de la compression: %w", err)
-		}
-		
-		// Mettre à jour le chemin final et calculer la taille du fichier compressé
-		finalDestPath = compressedFile
-		if compressedSize, err := getFileSize(compressedFile); err == nil {
-			size = compressedSize // Utiliser la taille du fichier compressé
-		} else {
-			fmt.Printf("Impossible de calculer la taille du fichier compressé: %v\n", err)
-		}
+	// La taille vient des statistiques de rsync; avec le journal, rsync ne compte que les
+	// chemins transférés et la sauvegarde doit être parcourue
+	var size int64
+	if stats != nil && !journaled {
+		size = stats.TotalSize
+	} else if size, err = getDirSize(destPath); err != nil {
+		fmt.Printf("Impossible de calculer la taille de la sauvegarde: %v\n", err)
+		size = 0 // Initialiser pour éviter des erreurs plus tard
 	}
 	
 	// Créer l'info de sauvegarde
@@ -90,11 +210,16 @@ func CreateBackup(config BackupConfig) error {
 		ID:           backupID,
 		Name:         config.Name,
 		SourcePath:   config.SourcePath,
-		BackupPath:   finalDestPath,
+		BackupPath:   destPath,
 		Time:         time.Now(),
 		Size:         size,
-		IsIncremental: config.Incremental,
-		Compression:   config.Compression,
+		IsIncremental: rsyncOpts.Incremental,
+		Type:         backupType,
+		ManifestPath: manifestPath,
+		Stats:        stats,
+	}
+	if rsyncOpts.Incremental {
+		backupInfo.ParentID = parent.ID
 	}
 	
 	// Sauvegarder les métadonnées
@@ -103,6 +228,10 @@ func CreateBackup(config BackupConfig) error {
 	}
 	
 	fmt.Printf("Sauvegarde terminée avec succès. Taille: %s\n", common.FormatSize(size))
+	if stats != nil {
+		fmt.Printf("Transféré: %d fichier(s), %s copiés, %s repris d'une version existante.\n",
+			stats.TransferredFiles, common.FormatSize(stats.LiteralData), common.FormatSize(stats.MatchedData))
+	}
 	
 	// Nettoyer les anciennes sauvegardes selon la politique de rétention
 	go cleanupOldBackups(config.Name)
@@ -110,6 +239,26 @@ func CreateBackup(config BackupConfig) error {
 	return nil
 }
 
+// resolveDestination renvoie le répertoire racine et le format de stockage à utiliser.
+// Sans destination nommée, la destination principale AppConfig.BackupDestination est utilisée,
+// avec le format de la destination configurée qui pointe vers ce même chemin.
+func resolveDestination(name string) (string, string) {
+	if name != "" {
+		if dest, found := common.GetBackupDestination(name); found {
+			return dest.Path, dest.Format
+		}
+		common.LogWarning("Destination '%s' introuvable, utilisation de la destination principale.", name)
+	}
+
+	root := common.AppConfig.BackupDestination
+	for _, dest := range common.AppConfig.BackupDestinations {
+		if filepath.Clean(dest.Path) == filepath.Clean(root) {
+			return root, dest.Format
+		}
+	}
+	return root, ""
+}
+
 // getDirSize calcule la taille totale d'un répertoire
 func getDirSize(path string) (int64, error) {
 	var size int64
@@ -138,74 +287,346 @@ func getFileSize(path string) (int64, error) {
 
 
 
-// findLastBackup trouve la dernière sauvegarde pour un nom donné
-func findLastBackup(name string) (string, error) {
+// mode renvoie le mode de sauvegarde demandé
+func (c BackupConfig) mode() string {
+	switch {
+	case c.Differential:
+		return common.BackupModeDifferential
+	case c.Incremental:
+		return common.BackupModeIncremental
+	default:
+		return common.BackupModeFull
+	}
+}
+
+// linkDestCandidates renvoie les sauvegardes d'une configuration utilisables comme base
+// (--link-dest), de la plus ancienne à la plus récente: les sauvegardes locales non compressées,
+// ou celles faites sur le serveur remote s'il n'est pas nil. Une sauvegarde chiffrée ne sert de
+// base qu'à une sauvegarde chiffrée, et inversement.
+func linkDestCandidates(name string, remote *common.RsyncServerConfig, encrypted bool) ([]common.BackupInfo, error) {
 	backups, err := common.ListBackups()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	
-	var lastBackup common.BackupInfo
-	var found bool
-	
+	var candidates []common.BackupInfo
 	for _, backup := range backups {
-		if backup.Name == name {
-			if !found || backup.Time.After(lastBackup.Time) {
-				lastBackup = backup
-				found = true
+		if backup.Name != name || backup.Encrypted != encrypted || backup.Format != "" {
+			continue
+		}
+		if remote != nil {
+			// Sur un serveur distant, la compression ne concerne que le transfert
+			if backup.RemoteServer != nil && backup.RemoteServer.IP == remote.IP && backup.RemoteServer.DefaultModule == remote.DefaultModule {
+				candidates = append(candidates, backup)
 			}
+			continue
+		}
+		// Une archive compressée ou une sauvegarde distante ne peut pas servir de base pour --link-dest
+		if backup.Compression || backup.RemoteServer != nil {
+			continue
+		}
+		if !common.DirExists(backup.BackupPath) {
+			common.LogWarning("Sauvegarde %s ignorée comme base: répertoire %s introuvable.", backup.ID, backup.BackupPath)
+			continue
+		}
+		candidates = append(candidates, backup)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Time.Before(candidates[j].Time) })
+	return candidates, nil
+}
+
+// selectBase choisit la sauvegarde de base et le type de la nouvelle sauvegarde.
+// Une erreur signifie qu'une sauvegarde complète doit être faite: aucune base n'existe,
+// ou la règle FullEveryRuns/FullEveryDays l'impose.
+func selectBase(config BackupConfig) (common.BackupInfo, string, error) {
+	candidates, err := linkDestCandidates(config.Name, nil, config.Encrypt)
+	if err != nil {
+		return common.BackupInfo{}, common.BackupModeFull, err
+	}
+	return baseFrom(config, candidates, time.Now())
+}
+
+// SelectRemoteBase choisit, comme pour une sauvegarde locale, la sauvegarde de base sur le
+// serveur distant et le type de la nouvelle sauvegarde
+func SelectRemoteBase(config BackupConfig, server *common.RsyncServerConfig) (common.BackupInfo, string, error) {
+	if config.mode() == common.BackupModeFull {
+		return common.BackupInfo{}, common.BackupModeFull, fmt.Errorf("mode de sauvegarde complet")
+	}
+	candidates, err := linkDestCandidates(config.Name, server, false)
+	if err != nil {
+		return common.BackupInfo{}, common.BackupModeFull, err
+	}
+	return baseFrom(config, candidates, time.Now())
+}
+
+// baseFrom applique les règles de selectBase aux candidats triés du plus ancien au plus récent
+func baseFrom(config BackupConfig, candidates []common.BackupInfo, now time.Time) (common.BackupInfo, string, error) {
+	lastFull := -1
+	for i, b := range candidates {
+		if b.IsFull() {
+			lastFull = i
 		}
 	}
+	if lastFull < 0 {
+		return common.BackupInfo{}, common.BackupModeFull, fmt.Errorf("aucune sauvegarde complète précédente pour '%s'", config.Name)
+	}
+	full := candidates[lastFull]
 	
-	if !found {
-		return "", fmt.Errorf("aucune sauvegarde précédente trouvée pour: %s", name)
+	// Exécutions depuis la dernière sauvegarde complète, celle-ci comprise
+	runs := len(candidates) - lastFull
+	if config.FullEveryRuns > 0 && runs >= config.FullEveryRuns {
+		return common.BackupInfo{}, common.BackupModeFull, fmt.Errorf("%d exécutions depuis la dernière sauvegarde complète", runs)
+	}
+	if config.FullEveryDays > 0 && now.Sub(full.Time) >= time.Duration(config.FullEveryDays)*24*time.Hour {
+		return common.BackupInfo{}, common.BackupModeFull, fmt.Errorf("dernière sauvegarde complète datant de plus de %d jours", config.FullEveryDays)
 	}
 	
-	return lastBackup.BackupPath, nil
+	if config.mode() == common.BackupModeDifferential {
+		return full, common.BackupModeDifferential, nil
+	}
+	return candidates[len(candidates)-1], common.BackupModeIncremental, nil
 }
 
-// compressBackup compresse une sauvegarde terminée
-func compressBackup(path string, name string) error {
-	// Créer le wrapper de compression
+// createCompressedBackup archive la source directement dans un fichier compressé.
+// Les exclusions sont appliquées pendant le parcours et l'archive n'apparaît qu'une fois
+// complète (fichier temporaire puis renommage): aucun répertoire intermédiaire n'est créé.
+func createCompressedBackup(config BackupConfig, backupID, destPath string) error {
 	cw, err := wrappers.NewCompressionWrapper()
 	if err != nil {
 		return fmt.Errorf("impossible d'initialiser la compression: %w", err)
 	}
+	cw.Progress = printProgress
+	cw.Manifest = manifest.New(backupID)
 	
-	// Chemin du fichier compressé
-	compressedFile := path + ".tar.gz"
+	compressedFile := destPath + wrappers.FormatTarGz.Extension()
+	if config.Encrypt {
+		key, err := newEncryptionKey()
+		if err != nil {
+			return err
+		}
+		cw.Key = key
+		compressedFile += encryption.Extension
+	}
 	
-	fmt.Printf("Compression de la sauvegarde vers %s...\n", compressedFile)
+	if config.mode() != common.BackupModeFull {
+		common.LogInfo("Sauvegarde compressée de '%s': les modes incrémentiel et différentiel ne s'appliquent pas aux archives.", config.Name)
+	}
 	
-	// Compresser la sauvegarde
-	if err := cw.Compress(path, compressedFile, wrappers.FormatTarGz); err != nil {
+	fmt.Printf("Création d'une sauvegarde %s de %s vers %s...\n",
+		getBackupTypeStr(common.BackupModeFull, true), config.SourcePath, compressedFile)
+	
+	exclude := func(rel string, isDir bool) bool {
+		return common.IsExcluded(rel, isDir, config.ExcludeDirs, config.ExcludeFiles)
+	}
+	err = cw.CompressFiltered(config.SourcePath, compressedFile, wrappers.FormatTarGz, exclude)
+	fmt.Println()
+	if err != nil {
 		return fmt.Errorf("erreur lors de la compression: %w", err)
 	}
 	
-	// Suppression du répertoire original après compression réussie
-	if err := os.RemoveAll(path); err != nil {
-		fmt.Printf("Avertissement: impossible de supprimer le répertoire original après compression: %v\n", err)
+	size, err := getFileSize(compressedFile)
+	if err != nil {
+		fmt.Printf("Impossible de calculer la taille du fichier compressé: %v\n", err)
+	}
+	
+	// Le manifeste est chiffré avec la même clé que l'archive
+	manifestPath := destPath + manifest.Extension
+	if err := cw.Manifest.Save(manifestPath, cw.Key); err != nil {
+		common.LogWarning("Impossible de créer le manifeste de %s: %v", backupID, err)
+		fmt.Printf("Avertissement: impossible de créer le manifeste de la sauvegarde: %v\n", err)
+		manifestPath = ""
+	}
+	
+	backupInfo := common.BackupInfo{
+		ID:              backupID,
+		Name:            config.Name,
+		SourcePath:      config.SourcePath,
+		BackupPath:      compressedFile,
+		Time:            time.Now(),
+		Size:            size,
+		Compression:     true,
+		Type:            common.BackupModeFull,
+		Encrypted:       config.Encrypt,
+		DestinationName: config.DestinationName,
+		ManifestPath:    manifestPath,
+	}
+	
+	if err := common.SaveBackupInfo(backupInfo); err != nil {
+		os.Remove(compressedFile)
+		if manifestPath != "" {
+			os.Remove(manifestPath)
+		}
+		return fmt.Errorf("erreur lors de l'enregistrement des métadonnées: %w", err)
+	}
+	
+	fmt.Printf("Sauvegarde terminée avec succès. Taille: %s\n", common.FormatSize(size))
+	
+	go cleanupOldBackups(config.Name)
+	
+	return nil
+}
+
+// createEncryptedBackup recopie la source dans destPath en chiffrant chaque fichier au fil de
+// la lecture: le contenu en clair n'atteint jamais la destination, même en cas d'interruption.
+// Les fichiers chiffrés ne pouvant pas être comparés à la source par --link-dest, la sauvegarde
+// est toujours complète.
+func createEncryptedBackup(config BackupConfig, backupID, destPath string) error {
+	// Dériver la clé avant la copie pour échouer tôt si la phrase secrète manque
+	key, err := newEncryptionKey()
+	if err != nil {
+		return err
+	}
+	// Les fichiers inchangés depuis la sauvegarde de base sont repris par lien physique, comme
+	// avec rsync --link-dest
+	backupType := common.BackupModeFull
+	var parentID string
+	var reuse func(rel string, info os.FileInfo) (string, string)
+	if config.mode() != common.BackupModeFull {
+		parent, baseType, err := selectBase(config)
+		var previous *manifest.Manifest
+		if err == nil {
+			// Le manifeste de la base n'est lisible qu'avec la même phrase secrète
+			previous, err = loadEncryptedManifest(parent)
+		}
+		if err != nil {
+			common.LogInfo("Sauvegarde complète pour '%s': %v", config.Name, err)
+			fmt.Printf("Note: %v, création d'une sauvegarde complète.\n", err)
+		} else {
+			backupType, parentID = baseType, parent.ID
+			reuse = unchangedFiles(parent, previous)
+			fmt.Printf("Sauvegarde %s basée sur %s.\n", getBackupTypeStr(backupType, false), parent.ID)
+		}
+	}
+	if !common.DirExists(config.SourcePath) {
+		return fmt.Errorf("le répertoire source '%s' n'existe pas", config.SourcePath)
+	}
+	if err := os.MkdirAll(destPath, 0755); err != nil {
+		return fmt.Errorf("impossible de créer le répertoire de destination: %w", err)
+	}
+	
+	fmt.Printf("Création d'une sauvegarde %s chiffrée de %s vers %s...\n", getBackupTypeStr(backupType, false), config.SourcePath, destPath)
+	
+	m := manifest.New(backupID)
+	exclude := func(rel string, isDir bool) bool {
+		return common.IsExcluded(rel, isDir, config.ExcludeDirs, config.ExcludeFiles)
+	}
+	if err := key.EncryptTree(config.SourcePath, destPath, exclude, reuse, m.Add); err != nil {
+		// La sauvegarde incomplète ne contient que des fichiers chiffrés, elle est tout de même retirée
+		os.RemoveAll(destPath)
+		return fmt.Errorf("erreur lors du chiffrement: %w", err)
+	}
+	common.LogSecurity("Sauvegarde %s chiffrée.", destPath)
+	
+	// Le manifeste est chiffré avec la même clé que les fichiers
+	manifestPath := destPath + manifest.Extension
+	if err := m.Save(manifestPath, key); err != nil {
+		common.LogWarning("Impossible de créer le manifeste de %s: %v", backupID, err)
+		fmt.Printf("Avertissement: impossible de créer le manifeste de la sauvegarde: %v\n", err)
+		manifestPath = ""
 	}
 	
-	fmt.Println("Compression terminée avec succès.")
+	size, err := getDirSize(destPath)
+	if err != nil {
+		fmt.Printf("Impossible de calculer la taille de la sauvegarde: %v\n", err)
+		size = 0
+	}
+	
+	backupInfo := common.BackupInfo{
+		ID:           backupID,
+		Name:         config.Name,
+		SourcePath:   config.SourcePath,
+		BackupPath:   destPath,
+		Time:         time.Now(),
+		Size:          size,
+		IsIncremental: reuse != nil,
+		Type:          backupType,
+		ParentID:      parentID,
+		Encrypted:     true,
+		ManifestPath:  manifestPath,
+	}
+	if err := common.SaveBackupInfo(backupInfo); err != nil {
+		return fmt.Errorf("erreur lors de l'enregistrement des métadonnées: %w", err)
+	}
+	
+	fmt.Printf("Sauvegarde terminée avec succès. Taille: %s\n", common.FormatSize(size))
+	
+	go cleanupOldBackups(config.Name)
 	
 	return nil
 }
 
+// newEncryptionKey dérive une clé de chiffrement à partir de la phrase secrète configurée
+func newEncryptionKey() (*encryption.Key, error) {
+	passphrase, err := common.EncryptionPassphrase()
+	if err != nil {
+		return nil, fmt.Errorf("chiffrement impossible: %w", err)
+	}
+	key, err := encryption.NewKey(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("chiffrement impossible: %w", err)
+	}
+	return key, nil
+}
+
+// loadEncryptedManifest lit le manifeste chiffré d'une sauvegarde avec la phrase secrète configurée
+func loadEncryptedManifest(backup common.BackupInfo) (*manifest.Manifest, error) {
+	if backup.ManifestPath == "" {
+		return nil, fmt.Errorf("la sauvegarde %s n'a pas de manifeste", backup.ID)
+	}
+	passphrase, err := common.EncryptionPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	keyring, err := encryption.NewKeyring(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	m, err := manifest.Load(backup.ManifestPath, keyring)
+	if err != nil {
+		return nil, fmt.Errorf("manifeste de la sauvegarde %s illisible: %w", backup.ID, err)
+	}
+	return m, nil
+}
 
+// unchangedFiles renvoie, pour un fichier dont la taille, les permissions et la date n'ont pas
+// changé depuis la sauvegarde chiffrée parent, sa version chiffrée dans parent et son empreinte
+func unchangedFiles(parent common.BackupInfo, previous *manifest.Manifest) func(rel string, info os.FileInfo) (string, string) {
+	known := make(map[string]manifest.Entry, len(previous.Entries))
+	for _, e := range previous.Entries {
+		known[e.Path] = e
+	}
+	return func(rel string, info os.FileInfo) (string, string) {
+		prev, ok := known[rel]
+		if !ok || !prev.Unchanged(info) {
+			return "", ""
+		}
+		return filepath.Join(parent.BackupPath, filepath.FromSlash(rel)), prev.SHA256
+	}
+}
 
+// printProgress affiche l'avancement d'une opération sur une seule ligne
+func printProgress(done, total int64) {
+	if total > 0 {
+		fmt.Printf("\r  %3d%% (%s / %s)", done*100/total, common.FormatSize(done), common.FormatSize(total))
+	} else {
+		fmt.Printf("\r  %s", common.FormatSize(done))
+	}
+}
 
 // getBackupTypeStr renvoie une chaîne décrivant le type de sauvegarde
-func getBackupTypeStr(incremental bool, compression bool) string {
-	backupType := "complète"
-	if incremental {
-		backupType = "incrémentielle"
+func getBackupTypeStr(backupType string, compression bool) string {
+	str := "complète"
+	switch backupType {
+	case common.BackupModeIncremental:
+		str = "incrémentielle"
+	case common.BackupModeDifferential:
+		str = "différentielle"
 	}
 	
 	if compression {
-		backupType += " compressée"
+		str += " compressée"
 	}
 	
-	return backupType
+	return str
 }
 
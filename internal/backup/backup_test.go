@@ -1,56 +1,160 @@
 package backup
 
 import (
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/internal/encryption"
+	"github.com/Noziop/s4v3my4ss/internal/manifest"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
 )
 
 func TestGenerateBackupID(t *testing.T) {
+	// Format: name_date_time_hash
+	suffix := regexp.MustCompile(`^[0-9]{8}_[0-9]{6}_[0-9a-f]{6}$`)
+
 	// Test cases
 	testCases := []struct {
-		name          string
-		inputName     string
-		expectedParts int
+		name         string
+		inputName    string
+		expectedName string
 	}{
 		{
-			name:          "Simple name",
-			inputName:     "test",
-			expectedParts: 3, // name_date_hash
+			name:         "Simple name",
+			inputName:    "test",
+			expectedName: "test",
 		},
 		{
-			name:          "Name with spaces",
-			inputName:     "my backup",
-			expectedParts: 3,
+			name:         "Name with spaces",
+			inputName:    "my backup",
+			expectedName: "my_backup",
 		},
 		{
-			name:          "Name with special characters",
-			inputName:     "backup!@#$%^&*()",
-			expectedParts: 3,
+			name:         "Name with special characters",
+			inputName:    "backup!@#$%^&*()",
+			expectedName: "backup__________",
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			// Call the function
-			result := generateBackupID(tc.inputName)
+			result := common.GenerateBackupID(tc.inputName)
 
 			// Check that the result is not empty
 			if result == "" {
-				t.Errorf("generateBackupID(%s) returned empty string", tc.inputName)
+				t.Errorf("GenerateBackupID(%s) returned empty string", tc.inputName)
 			}
 
-			// Check that the ID has the expected format (name_date_hash)
-			parts := strings.Split(result, "_")
-			if len(parts) != tc.expectedParts {
-				t.Errorf("generateBackupID(%s) = %s, expected %d parts but got %d", 
-					tc.inputName, result, tc.expectedParts, len(parts))
+			// Check that special characters are properly sanitized
+			if !strings.HasPrefix(result, tc.expectedName+"_") {
+				t.Errorf("GenerateBackupID(%s) = %s, expected name part %s",
+					tc.inputName, result, tc.expectedName)
 			}
 
-			// Check that special characters are properly sanitized
-			if strings.ContainsAny(parts[0], "!@#$%^&*()") {
-				t.Errorf("generateBackupID(%s) = %s, name part contains special characters", 
+			// Check that the ID has the expected format (name_date_time_hash)
+			if !suffix.MatchString(strings.TrimPrefix(result, tc.expectedName+"_")) {
+				t.Errorf("GenerateBackupID(%s) = %s, expected a date, a time and a hash after the name",
 					tc.inputName, result)
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestBaseFrom(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	backup := func(id, backupType string, daysAgo int) common.BackupInfo {
+		return common.BackupInfo{ID: id, Type: backupType, Time: now.AddDate(0, 0, -daysAgo)}
+	}
+	full := common.BackupModeFull
+	incr := common.BackupModeIncremental
+	diff := common.BackupModeDifferential
+
+	tests := []struct {
+		name       string
+		config     BackupConfig
+		candidates []common.BackupInfo
+		wantID     string
+		wantType   string
+	}{
+		{"no previous backup", BackupConfig{Incremental: true}, nil, "", full},
+		{"no previous full backup", BackupConfig{Incremental: true}, []common.BackupInfo{backup("i1", incr, 2)}, "", full},
+		{"incremental on the latest backup", BackupConfig{Incremental: true},
+			[]common.BackupInfo{backup("f1", full, 3), backup("i1", incr, 2), backup("i2", incr, 1)}, "i2", incr},
+		{"differential on the latest full backup", BackupConfig{Differential: true},
+			[]common.BackupInfo{backup("f1", full, 4), backup("d1", diff, 3), backup("f2", full, 2), backup("d2", diff, 1)}, "f2", diff},
+		{"differential takes precedence over incremental", BackupConfig{Incremental: true, Differential: true},
+			[]common.BackupInfo{backup("f1", full, 2), backup("d1", diff, 1)}, "f1", diff},
+		{"full every 3 runs reached", BackupConfig{Differential: true, FullEveryRuns: 3},
+			[]common.BackupInfo{backup("f1", full, 3), backup("d1", diff, 2), backup("d2", diff, 1)}, "", full},
+		{"full every 3 runs not reached", BackupConfig{Differential: true, FullEveryRuns: 3},
+			[]common.BackupInfo{backup("f1", full, 2), backup("d1", diff, 1)}, "f1", diff},
+		{"full every 7 days reached", BackupConfig{Incremental: true, FullEveryDays: 7},
+			[]common.BackupInfo{backup("f1", full, 8), backup("i1", incr, 1)}, "", full},
+		{"full every 7 days not reached", BackupConfig{Incremental: true, FullEveryDays: 7},
+			[]common.BackupInfo{backup("f1", full, 6), backup("i1", incr, 1)}, "i1", incr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, backupType, err := baseFrom(tt.config, tt.candidates, now)
+			if backupType != tt.wantType {
+				t.Errorf("Expected a %s backup, got %s", tt.wantType, backupType)
+			}
+			if tt.wantID == "" {
+				if err == nil {
+					t.Errorf("Expected a full backup to be required, got base %s", base.ID)
+				}
+			} else if err != nil || base.ID != tt.wantID {
+				t.Errorf("Expected base %s, got %s (%v)", tt.wantID, base.ID, err)
+			}
+		})
+	}
+}
+
+func TestEncryptedIncrementalLinksUnchangedFiles(t *testing.T) {
+	key, err := encryption.NewKey("test passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := t.TempDir()
+	for name, content := range map[string]string{"same.txt": "same", "changed.txt": "before"} {
+		if err := os.WriteFile(filepath.Join(source, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parent := common.BackupInfo{ID: "parent", BackupPath: filepath.Join(t.TempDir(), "parent")}
+	previous := manifest.New(parent.ID)
+	if err := key.EncryptTree(source, parent.BackupPath, nil, nil, previous.Add); err != nil {
+		t.Fatalf("First backup failed: %v", err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.WriteFile(filepath.Join(source, "changed.txt"), []byte("after"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filepath.Join(source, "changed.txt"), later, later)
+	dest := filepath.Join(t.TempDir(), "child")
+	if err := key.EncryptTree(source, dest, nil, unchangedFiles(parent, previous), nil); err != nil {
+		t.Fatalf("Second backup failed: %v", err)
+	}
+
+	// Le fichier inchangé est partagé, le fichier modifié est chiffré à nouveau
+	sameFile := func(name string) bool {
+		a, errA := os.Stat(filepath.Join(parent.BackupPath, name))
+		b, errB := os.Stat(filepath.Join(dest, name))
+		if errA != nil || errB != nil {
+			t.Fatalf("Encrypted %s missing: %v %v", name, errA, errB)
+		}
+		return os.SameFile(a, b)
+	}
+	if !sameFile("same.txt") {
+		t.Errorf("Unchanged file was encrypted again instead of linked")
+	}
+	if sameFile("changed.txt") {
+		t.Errorf("Changed file shares the parent's ciphertext")
+	}
+}
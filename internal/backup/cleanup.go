@@ -40,10 +40,21 @@ func cleanupOldBackups(name string) {
 		}
 	}
 
-	policy := common.AppConfig.RetentionPolicy
+	toDelete := retentionDeletions(relevantBackups, common.AppConfig.RetentionPolicy)
+	for id := range toDelete {
+		if err := DeleteBackup(id); err != nil {
+			common.LogError("cleanupOldBackups: impossible de supprimer la sauvegarde %s: %v", id, err)
+		} else {
+			common.LogSecurity("Sauvegarde %s supprimée par la politique de rétention.", id)
+		}
+	}
+}
 
+// retentionDeletions renvoie les IDs des sauvegardes, triées de la plus ancienne à la plus
+// récente, que la politique de rétention ne conserve pas
+func retentionDeletions(backups []common.BackupInfo, policy common.RetentionPolicy) map[string]struct{} {
 	// Nettoyage quotidien
-	dailyKept := cleanupByInterval(relevantBackups, policy.KeepDaily, common.Daily)
+	dailyKept := cleanupByInterval(backups, policy.KeepDaily, common.Daily)
 	// Nettoyage hebdomadaire
 	weeklyKept := cleanupByInterval(dailyKept, policy.KeepWeekly, common.Weekly)
 	// Nettoyage mensuel
@@ -51,7 +62,7 @@ func cleanupOldBackups(name string) {
 
 	// Supprimer les sauvegardes qui ne sont pas conservées par la politique
 	toDelete := make(map[string]struct{})
-	for _, b := range relevantBackups {
+	for _, b := range backups {
 		toDelete[b.ID] = struct{}{}
 	}
 
@@ -65,13 +76,23 @@ func cleanupOldBackups(name string) {
 		delete(toDelete, b.ID)
 	}
 
-	for id := range toDelete {
-		if err := common.DeleteBackup(id); err != nil {
-			common.LogError("cleanupOldBackups: impossible de supprimer la sauvegarde %s: %v", id, err)
-		} else {
-			common.LogSecurity("Sauvegarde %s supprimée par la politique de rétention.", id)
+	// Conserver les sauvegardes complètes servant de base: la plus récente, qui sert aux
+	// prochaines sauvegardes différentielles, et celles des sauvegardes différentielles conservées
+	for i := len(backups) - 1; i >= 0; i-- {
+		if backups[i].IsFull() {
+			delete(toDelete, backups[i].ID)
+			break
+		}
+	}
+	for _, b := range backups {
+		if _, deleted := toDelete[b.ID]; !deleted && b.BackupType() == common.BackupModeDifferential && b.ParentID != "" {
+			if _, ok := toDelete[b.ParentID]; ok {
+				common.LogInfo("Sauvegarde complète %s conservée: base de la sauvegarde différentielle %s.", b.ParentID, b.ID)
+				delete(toDelete, b.ParentID)
+			}
 		}
 	}
+	return toDelete
 }
 
 // cleanupByInterval filtre les sauvegardes pour ne garder que celles qui respectent la politique de rétention pour un intervalle donné
@@ -0,0 +1,64 @@
+package backup
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+func TestRetentionDeletions(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 12, 0, 0, 0, time.UTC) }
+	full := func(id string, d int) common.BackupInfo {
+		return common.BackupInfo{ID: id, Time: day(d), Type: common.BackupModeFull}
+	}
+	diff := func(id string, d int, parent string) common.BackupInfo {
+		return common.BackupInfo{ID: id, Time: day(d), Type: common.BackupModeDifferential, ParentID: parent}
+	}
+
+	tests := []struct {
+		name    string
+		backups []common.BackupInfo
+		policy  common.RetentionPolicy
+		deleted []string
+	}{
+		{
+			name:    "oldest full backups beyond the policy",
+			backups: []common.BackupInfo{full("f1", 1), full("f2", 2), full("f3", 3)},
+			policy:  common.RetentionPolicy{KeepDaily: 2},
+			deleted: []string{"f1"},
+		},
+		{
+			name:    "latest full backup kept as the next differential base",
+			backups: []common.BackupInfo{full("f1", 1), diff("d1", 2, "f1"), diff("d2", 3, "f1")},
+			policy:  common.RetentionPolicy{KeepDaily: 1},
+			deleted: []string{"d1"},
+		},
+		{
+			name:    "base of a kept differential backup",
+			backups: []common.BackupInfo{full("f1", 1), full("f2", 2), diff("d1", 3, "f1")},
+			policy:  common.RetentionPolicy{KeepDaily: 1},
+			deleted: nil,
+		},
+		{
+			name:    "base of a deleted differential backup",
+			backups: []common.BackupInfo{full("f1", 1), diff("d1", 2, "f1"), full("f2", 3)},
+			policy:  common.RetentionPolicy{KeepDaily: 1},
+			deleted: []string{"d1", "f1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted []string
+			for id := range retentionDeletions(tt.backups, tt.policy) {
+				deleted = append(deleted, id)
+			}
+			sort.Strings(deleted)
+			if !reflect.DeepEqual(deleted, tt.deleted) {
+				t.Errorf("Expected %v to be deleted, got %v", tt.deleted, deleted)
+			}
+		})
+	}
+}
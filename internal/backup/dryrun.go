@@ -0,0 +1,99 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Noziop/s4v3my4ss/internal/wrappers"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// DryRunReport décrit ce qu'une sauvegarde transférerait, sans rien écrire
+type DryRunReport struct {
+	Name       string            `json:"name"`
+	SourcePath string            `json:"sourcePath"`
+	Type       string            `json:"type"`             // Type de la sauvegarde qui serait créée
+	BaseID     string            `json:"baseId,omitempty"` // Sauvegarde de base servant de comparaison
+	Changes    []wrappers.Change `json:"changes"`
+	New        int               `json:"new"`
+	Modified   int               `json:"modified"`
+	Deleted    int               `json:"deleted"`
+	Attributes int               `json:"attributes"`
+	Bytes      int64             `json:"bytes"` // Volume des fichiers nouveaux ou modifiés
+}
+
+// DryRunBackup simule la sauvegarde décrite par config avec rsync --dry-run.
+// Les hooks ne sont pas exécutés, rien n'est écrit et aucune métadonnée n'est enregistrée.
+func DryRunBackup(config BackupConfig) (DryRunReport, error) {
+	report := DryRunReport{Name: config.Name, SourcePath: config.SourcePath, Type: common.BackupModeFull}
+	backupID := common.GenerateBackupID(config.Name)
+	destRoot, destFormat := resolveDestination(config.DestinationName)
+
+	// Comparer avec la base que la sauvegarde utiliserait, ou avec un répertoire
+	// inexistant pour une sauvegarde complète
+	destPath := filepath.Join(destRoot, backupID)
+	if config.mode() != common.BackupModeFull && !config.Compression && !config.Encrypt && destFormat != common.FormatChunks {
+		if base, backupType, err := selectBase(config); err == nil {
+			destPath = base.BackupPath
+			report.Type = backupType
+			report.BaseID = base.ID
+		}
+	}
+	common.LogInfo("Simulation de la sauvegarde de '%s' (%s) vers %s.", config.Name, report.Type, destPath)
+
+	changes, err := wrappers.RsyncDryRun(config.SourcePath, destPath, wrappers.BackupOptions{
+		ExcludeDirs:  config.ExcludeDirs,
+		ExcludeFiles: config.ExcludeFiles,
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for i, c := range changes {
+		switch c.Type {
+		case wrappers.ChangeNew, wrappers.ChangeModified:
+			if c.Type == wrappers.ChangeNew {
+				report.New++
+			} else {
+				report.Modified++
+			}
+			if info, err := os.Lstat(filepath.Join(config.SourcePath, filepath.FromSlash(c.Path))); err == nil && info.Mode().IsRegular() {
+				changes[i].Size = info.Size()
+				report.Bytes += info.Size()
+			}
+		case wrappers.ChangeDeleted:
+			report.Deleted++
+		case wrappers.ChangeAttributes:
+			report.Attributes++
+		}
+	}
+	report.Changes = changes
+	return report, nil
+}
+
+// Print affiche le détail et le résumé de la simulation
+func (r DryRunReport) Print(w io.Writer) {
+	labels := map[wrappers.ChangeType]string{
+		wrappers.ChangeNew:        "Nouveau",
+		wrappers.ChangeModified:   "Modifié",
+		wrappers.ChangeDeleted:    "Supprimé",
+		wrappers.ChangeAttributes: "Attributs",
+	}
+	for _, c := range r.Changes {
+		path := c.Path
+		if c.IsDir {
+			path += "/"
+		}
+		fmt.Fprintf(w, "%-10s %s\n", labels[c.Type], path)
+	}
+
+	base := "aucune, sauvegarde complète"
+	if r.BaseID != "" {
+		base = r.BaseID
+	}
+	fmt.Fprintf(w, "\nSimulation de la sauvegarde %s de '%s' (base: %s)\n", getBackupTypeStr(r.Type, false), r.Name, base)
+	fmt.Fprintf(w, "%d nouveau(x), %d modifié(s), %d supprimé(s), %d changement(s) d'attributs, %s à transférer.\n",
+		r.New, r.Modified, r.Deleted, r.Attributes, common.FormatSize(r.Bytes))
+}
@@ -0,0 +1,71 @@
+package backup
+
+import (
+	"fmt"
+
+	"github.com/Noziop/s4v3my4ss/internal/wrappers"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// Statuts transmis aux hooks dans SAVEME_STATUS
+const (
+	hookStatusPending = "pending"
+	hookStatusSuccess = "success"
+	hookStatusFailure = "failure"
+)
+
+// hookEnv renvoie les variables décrivant la sauvegarde, transmises à chaque hook
+func hookEnv(config BackupConfig, backupID, destRoot string) map[string]string {
+	return map[string]string{
+		"SAVEME_BACKUP_ID":   backupID,
+		"SAVEME_BACKUP_NAME": config.Name,
+		"SAVEME_SOURCE":      config.SourcePath,
+		"SAVEME_DESTINATION": destRoot,
+		"SAVEME_STATUS":      hookStatusPending,
+	}
+}
+
+// completeHookEnv ajoute aux variables le résultat de la sauvegarde, pour les hooks "post"
+func completeHookEnv(env map[string]string, backupID string, backupErr error) map[string]string {
+	post := make(map[string]string, len(env)+2)
+	for k, v := range env {
+		post[k] = v
+	}
+	if backupErr != nil {
+		post["SAVEME_STATUS"] = hookStatusFailure
+		post["SAVEME_ERROR"] = backupErr.Error()
+		return post
+	}
+	post["SAVEME_STATUS"] = hookStatusSuccess
+	if info, err := findBackup(backupID); err == nil {
+		post["SAVEME_BACKUP_PATH"] = info.BackupPath
+	}
+	return post
+}
+
+// runHooks exécute les hooks d'une phase ("pre" ou "post") dans l'ordre. Après un échec
+// (backupErr pour la sauvegarde, ou un hook précédent), seuls les hooks RunOnFailure
+// sont exécutés. La première erreur de hook est renvoyée.
+func runHooks(hooks []common.Hook, phase string, env map[string]string, backupErr error) error {
+	failed := backupErr != nil
+	var firstErr error
+	for i, hook := range hooks {
+		if failed && !hook.RunOnFailure {
+			common.LogInfo("Hook %s %d (%s) ignoré après un échec.", phase, i+1, hook.Command)
+			continue
+		}
+		vars := make(map[string]string, len(env)+1)
+		for k, v := range env {
+			vars[k] = v
+		}
+		vars["SAVEME_HOOK_PHASE"] = phase
+		if err := wrappers.RunHook(hook, vars); err != nil {
+			fmt.Printf("Erreur: hook %s %d (%s): %v\n", phase, i+1, hook.Command, err)
+			failed = true
+			if firstErr == nil {
+				firstErr = fmt.Errorf("échec du hook %s %s: %w", phase, hook.Command, err)
+			}
+		}
+	}
+	return firstErr
+}
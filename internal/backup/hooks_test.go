@@ -0,0 +1,112 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// recordHook renvoie un hook qui ajoute son nom et le statut de la sauvegarde au fichier out
+func recordHook(name, out string, runOnFailure bool) common.Hook {
+	return common.Hook{
+		Command:      "sh",
+		Args:         []string{"-c", `printf '%s %s %s\n' "$NAME" "$SAVEME_STATUS" "$SAVEME_HOOK_PHASE" >> "$OUT"`},
+		Env:          map[string]string{"NAME": name, "OUT": out},
+		RunOnFailure: runOnFailure,
+	}
+}
+
+// withTestDestination utilise un répertoire temporaire comme destination principale
+func withTestDestination(t *testing.T) string {
+	t.Helper()
+	dest := t.TempDir()
+	origDest, origDests := common.AppConfig.BackupDestination, common.AppConfig.BackupDestinations
+	common.AppConfig.BackupDestination, common.AppConfig.BackupDestinations = dest, nil
+	t.Cleanup(func() {
+		common.AppConfig.BackupDestination, common.AppConfig.BackupDestinations = origDest, origDests
+	})
+	return dest
+}
+
+// readHookLog renvoie les lignes écrites par les hooks recordHook
+func readHookLog(t *testing.T, out string) string {
+	t.Helper()
+	data, err := os.ReadFile(out)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestFailingPreHookAbortsBackup(t *testing.T) {
+	dest := withTestDestination(t)
+	out := filepath.Join(t.TempDir(), "hooks.log")
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := BackupConfig{
+		Name:       "hooks-test",
+		SourcePath: source,
+		PreHooks: []common.Hook{
+			{Command: "false"},
+			recordHook("pre-skipped", out, false),
+		},
+		PostHooks: []common.Hook{
+			recordHook("post-skipped", out, false),
+			recordHook("post-always", out, true),
+		},
+	}
+	if err := CreateBackup(config); err == nil {
+		t.Fatal("Expected the backup to fail after a failing pre-hook")
+	}
+
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Backup written despite the failing pre-hook: %v", entries)
+	}
+	want := "post-always failure post"
+	if got := readHookLog(t, out); got != want {
+		t.Errorf("Expected hooks log %q, got %q", want, got)
+	}
+}
+
+func TestPostHooksRunAfterFailedBackup(t *testing.T) {
+	withTestDestination(t)
+	out := filepath.Join(t.TempDir(), "hooks.log")
+	errOut := filepath.Join(t.TempDir(), "error.log")
+
+	config := BackupConfig{
+		Name:       "hooks-test",
+		SourcePath: filepath.Join(t.TempDir(), "missing"),
+		PreHooks:   []common.Hook{recordHook("pre", out, false)},
+		PostHooks: []common.Hook{
+			recordHook("post-skipped", out, false),
+			recordHook("post-always", out, true),
+			{
+				Command:      "sh",
+				Args:         []string{"-c", `printf '%s' "$SAVEME_ERROR" > "$OUT"`},
+				Env:          map[string]string{"OUT": errOut},
+				RunOnFailure: true,
+			},
+		},
+	}
+	if err := CreateBackup(config); err == nil {
+		t.Fatal("Expected the backup of a missing source to fail")
+	}
+
+	want := "pre pending pre\npost-always failure post"
+	if got := readHookLog(t, out); got != want {
+		t.Errorf("Expected hooks log %q, got %q", want, got)
+	}
+	if data, err := os.ReadFile(errOut); err != nil || len(data) == 0 {
+		t.Errorf("Expected SAVEME_ERROR to describe the failure, got %q (%v)", data, err)
+	}
+}
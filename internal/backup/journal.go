@@ -0,0 +1,192 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/Noziop/s4v3my4ss/internal/journal"
+	"github.com/Noziop/s4v3my4ss/internal/wrappers"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// UsesChangeJournal indique si les sauvegardes d'une configuration peuvent exploiter le journal
+// des modifications tenu par la surveillance: sauvegardes incrémentales locales, ni compressées
+// ni chiffrées
+func UsesChangeJournal(c common.BackupConfig) bool {
+	_, format := resolveDestination(c.DestinationName)
+	return c.BackupMode() == common.BackupModeIncremental && !c.Compression && !c.Encrypt && format != common.FormatChunks
+}
+
+// syncChanges crée la sauvegarde destPath à partir de la sauvegarde parente, en ne transmettant
+// à rsync que les chemins modifiés d'après le journal: la source n'est pas parcourue en entier.
+func syncChanges(config BackupConfig, parentPath, destPath string, changes []journal.Change, opts wrappers.BackupOptions) (*common.TransferStats, error) {
+	if err := linkTree(parentPath, destPath); err != nil {
+		return nil, fmt.Errorf("impossible de reprendre la sauvegarde parente: %w", err)
+	}
+	files, err := changedFiles(config.SourcePath, destPath, changes)
+	if err != nil {
+		return nil, err
+	}
+	opts.Files = files
+	_, stats, err := wrappers.RsyncBackup(config.SourcePath, destPath, opts, false, nil)
+	return stats, err
+}
+
+// changedFiles prépare la copie destPath au transfert des chemins modifiés et en renvoie la
+// liste. Les chemins disparus de la source sont retirés de la copie; les autres en sont retirés
+// s'ils ne sont pas des répertoires, pour que rsync ne modifie jamais un fichier partagé avec
+// la sauvegarde parente (--link-dest reprend ceux qui n'ont pas changé).
+func changedFiles(source, destPath string, changes []journal.Change) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	add := func(rel string, info os.FileInfo) error {
+		if seen[rel] {
+			return nil
+		}
+		seen[rel] = true
+		if err := detach(filepath.Join(destPath, rel), info); err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	}
+
+	for _, change := range changes {
+		rel := filepath.Clean(change.Path)
+		if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("chemin invalide dans le journal des modifications: %s", change.Path)
+		}
+		// Un lien symbolique a remplacé un répertoire: seule une analyse complète est sûre
+		if underSymlink(source, rel) || underSymlink(destPath, rel) {
+			return nil, fmt.Errorf("chemin modifié sous un lien symbolique: %s", rel)
+		}
+		info, err := os.Lstat(filepath.Join(source, rel))
+		if missing(err) {
+			if err := os.RemoveAll(filepath.Join(destPath, rel)); err != nil {
+				return nil, err
+			}
+			// Le répertoire parent a changé de date de modification
+			rel = filepath.Dir(rel)
+			if info, err = os.Lstat(filepath.Join(source, rel)); missing(err) {
+				continue
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := add(rel, info); err != nil {
+			return nil, err
+		}
+		if !change.Tree || !info.IsDir() {
+			continue
+		}
+		// Répertoire créé ou renommé: tout son contenu est nouveau pour la sauvegarde
+		root := filepath.Join(source, rel)
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if missing(err) {
+					return nil
+				}
+				return err
+			}
+			sub, err := filepath.Rel(source, path)
+			if err != nil {
+				return err
+			}
+			return add(sub, info)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// missing indique qu'un chemin n'existe pas ou plus
+func missing(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
+}
+
+// underSymlink indique si l'un des répertoires parents de rel sous root est un lien symbolique
+func underSymlink(root, rel string) bool {
+	parts := strings.Split(filepath.Dir(rel), string(filepath.Separator))
+	path := root
+	for _, part := range parts {
+		if part == "." {
+			break
+		}
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return false
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// detach retire de la copie l'élément dest, sauf s'il s'agit d'un répertoire qui le reste
+func detach(dest string, info os.FileInfo) error {
+	current, err := os.Lstat(dest)
+	if missing(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current.IsDir() && info.IsDir() {
+		return nil
+	}
+	return os.RemoveAll(dest)
+}
+
+// linkTree reproduit la sauvegarde src dans le répertoire existant dst: les répertoires sont
+// recréés, tout le reste est partagé par liens physiques
+func linkTree(src, dst string) error {
+	var dirs []string
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(dst, rel)
+		if !info.IsDir() {
+			return os.Link(path, dest)
+		}
+		if err := os.Mkdir(dest, 0700); err != nil && !os.IsExist(err) {
+			return err
+		}
+		dirs = append(dirs, rel)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Propriétaires, permissions et dates des répertoires, une fois leur contenu créé
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := os.Lstat(filepath.Join(src, dirs[i]))
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(dst, dirs[i])
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && os.Geteuid() == 0 {
+			os.Lchown(dest, int(stat.Uid), int(stat.Gid))
+		}
+		if err := os.Chmod(dest, info.Mode()&(os.ModePerm|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return err
+		}
+		os.Chtimes(dest, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Noziop/s4v3my4ss/internal/journal"
+	"github.com/Noziop/s4v3my4ss/internal/wrappers"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChangedFilesOnLinkedSnapshot(t *testing.T) {
+	root := t.TempDir()
+	parent := filepath.Join(root, "parent")
+	source := filepath.Join(root, "source")
+	dest := filepath.Join(root, "dest")
+
+	// Sauvegarde parente et source au moment de cette sauvegarde
+	for _, dir := range []string{parent, source} {
+		writeTestFile(t, filepath.Join(dir, "a.txt"), "old")
+		writeTestFile(t, filepath.Join(dir, "keep.txt"), "same")
+		writeTestFile(t, filepath.Join(dir, "gone.txt"), "bye")
+		writeTestFile(t, filepath.Join(dir, "old dir", "x.txt"), "x")
+	}
+	// Modifications relevées depuis par la surveillance
+	writeTestFile(t, filepath.Join(source, "a.txt"), "new")
+	os.Remove(filepath.Join(source, "gone.txt"))
+	if err := os.Rename(filepath.Join(source, "old dir"), filepath.Join(source, "new dir")); err != nil {
+		t.Fatal(err)
+	}
+	changes := []journal.Change{
+		{Path: "a.txt"},
+		{Path: "gone.txt"},
+		{Path: "old dir"},
+		{Path: "new dir", Tree: true},
+	}
+
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkTree(parent, dest); err != nil {
+		t.Fatalf("linkTree failed: %v", err)
+	}
+	files, err := changedFiles(source, dest, changes)
+	if err != nil {
+		t.Fatalf("changedFiles failed: %v", err)
+	}
+
+	sort.Strings(files)
+	want := []string{".", "a.txt", "new dir", "new dir/x.txt"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Expected files %v, got %v", want, files)
+	}
+	// Chemins modifiés retirés de la copie, le reste partagé avec la sauvegarde parente
+	for _, rel := range []string{"a.txt", "gone.txt", "old dir"} {
+		if _, err := os.Lstat(filepath.Join(dest, rel)); !os.IsNotExist(err) {
+			t.Errorf("%s still present in the snapshot: %v", rel, err)
+		}
+	}
+	kept, err := os.Stat(filepath.Join(dest, "keep.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := os.Stat(filepath.Join(parent, "keep.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(kept, original) {
+		t.Error("Unchanged file is not shared with the parent backup")
+	}
+	// La sauvegarde parente est intacte
+	for _, rel := range []string{"a.txt", "gone.txt", "old dir/x.txt"} {
+		if _, err := os.Stat(filepath.Join(parent, rel)); err != nil {
+			t.Errorf("Parent backup modified: %v", err)
+		}
+	}
+	if content, _ := os.ReadFile(filepath.Join(parent, "a.txt")); string(content) != "old" {
+		t.Errorf("Parent backup content modified: %q", content)
+	}
+}
+
+func TestSyncChanges(t *testing.T) {
+	if !common.IsCommandAvailable("rsync") {
+		t.Skip("rsync is not installed")
+	}
+	root := t.TempDir()
+	parent := filepath.Join(root, "parent")
+	source := filepath.Join(root, "source")
+	dest := filepath.Join(root, "dest")
+	for _, dir := range []string{parent, source} {
+		writeTestFile(t, filepath.Join(dir, "a.txt"), "old")
+		writeTestFile(t, filepath.Join(dir, "keep.txt"), "same")
+	}
+	writeTestFile(t, filepath.Join(source, "a.txt"), "new")
+	writeTestFile(t, filepath.Join(source, "sub", "added.txt"), "added")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := []journal.Change{{Path: "a.txt"}, {Path: "sub", Tree: true}}
+	config := BackupConfig{Name: "test", SourcePath: source}
+	opts := wrappers.BackupOptions{Incremental: true, LinkDest: parent}
+	if _, err := syncChanges(config, parent, dest, changes, opts); err != nil {
+		t.Fatalf("syncChanges failed: %v", err)
+	}
+
+	for rel, want := range map[string]string{"a.txt": "new", "keep.txt": "same", "sub/added.txt": "added"} {
+		if content, err := os.ReadFile(filepath.Join(dest, rel)); err != nil || string(content) != want {
+			t.Errorf("Snapshot %s = %q (%v), want %q", rel, content, err, want)
+		}
+	}
+	if content, _ := os.ReadFile(filepath.Join(parent, "a.txt")); string(content) != "old" {
+		t.Errorf("Parent backup content modified: %q", content)
+	}
+}
+
+func TestChangedFilesRejectsUnsafePaths(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	dest := filepath.Join(root, "dest")
+	writeTestFile(t, filepath.Join(source, "real", "f.txt"), "f")
+	if err := os.Symlink(filepath.Join(source, "real"), filepath.Join(source, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, change := range []journal.Change{{Path: "../outside"}, {Path: "link/f.txt"}} {
+		if _, err := changedFiles(source, dest, []journal.Change{change}); err == nil {
+			t.Errorf("Expected an error for %q", change.Path)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"fmt"
+
+	"github.com/Noziop/s4v3my4ss/internal/chunkstore"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// createChunkBackup crée une sauvegarde dans un dépôt de blocs dédupliqués
+func createChunkBackup(config BackupConfig, backupID, repoPath string) error {
+	repo, err := chunkstore.Open(repoPath)
+	if err != nil {
+		return fmt.Errorf("impossible d'ouvrir le dépôt %s: %w", repoPath, err)
+	}
+
+	fmt.Printf("Création d'une sauvegarde dédupliquée de %s dans le dépôt %s...\n", config.SourcePath, repoPath)
+
+	snapshot, stats, err := repo.CreateSnapshot(backupID, config.Name, config.SourcePath, config.ExcludeDirs, config.ExcludeFiles)
+	if err != nil {
+		return fmt.Errorf("erreur lors de la création de l'instantané: %w", err)
+	}
+
+	backupInfo := common.BackupInfo{
+		ID:              backupID,
+		Name:            config.Name,
+		SourcePath:      config.SourcePath,
+		BackupPath:      repoPath,
+		Time:            snapshot.Time,
+		Size:            stats.TotalSize,
+		DestinationName: config.DestinationName,
+		Format:          common.FormatChunks,
+		// Les données nouvelles sont écrites, les autres reprises des blocs déjà présents
+		Stats: &common.TransferStats{
+			Files:       int64(stats.Files),
+			TotalSize:   stats.TotalSize,
+			LiteralData: stats.NewBytes,
+			MatchedData: stats.TotalSize - stats.NewBytes,
+		},
+	}
+
+	if err := common.SaveBackupInfo(backupInfo); err != nil {
+		return fmt.Errorf("erreur lors de l'enregistrement des métadonnées: %w", err)
+	}
+
+	fmt.Printf("Sauvegarde terminée avec succès. %d fichiers (%s), %s de nouvelles données.\n",
+		stats.Files, common.FormatSize(stats.TotalSize), common.FormatSize(stats.NewBytes))
+
+	go cleanupOldBackups(config.Name)
+
+	return nil
+}
+
+// DeleteBackup supprime une sauvegarde et ses données, quel que soit son format de stockage.
+// Pour un dépôt de blocs, l'instantané est retiré puis les blocs orphelins sont libérés.
+func DeleteBackup(id string) error {
+	info, err := findBackup(id)
+	if err != nil {
+		return err
+	}
+
+	if info.Format == common.FormatChunks {
+		repo, err := chunkstore.Open(info.BackupPath)
+		if err != nil {
+			return fmt.Errorf("impossible d'ouvrir le dépôt %s: %w", info.BackupPath, err)
+		}
+		if err := repo.DeleteSnapshot(info.ID); err != nil {
+			return err
+		}
+		if err := common.DeleteBackup(id); err != nil {
+			return err
+		}
+		if _, err := repo.Prune(); err != nil {
+			common.LogError("Nettoyage du dépôt %s impossible après suppression de %s: %v", info.BackupPath, id, err)
+		}
+		return nil
+	}
+
+	return common.DeleteBackup(id)
+}
+
+// findBackup cherche les métadonnées d'une sauvegarde par son ID
+func findBackup(id string) (common.BackupInfo, error) {
+	backups, err := common.ListBackups()
+	if err != nil {
+		return common.BackupInfo{}, fmt.Errorf("impossible de récupérer la liste des sauvegardes: %w", err)
+	}
+	for _, b := range backups {
+		if b.ID == id {
+			return b, nil
+		}
+	}
+	return common.BackupInfo{}, fmt.Errorf("sauvegarde avec ID %s non trouvée", id)
+}
@@ -0,0 +1,54 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+func TestChunkBackupRecordsLogicalSize(t *testing.T) {
+	withTestBackupInfo(t)
+	source := t.TempDir()
+	content := []byte("content stored once in the repository")
+	if err := os.WriteFile(filepath.Join(source, "file.txt"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := BackupConfig{Name: "chunks-test", SourcePath: source}
+	repo := filepath.Join(t.TempDir(), "repo")
+
+	ids := []string{common.GenerateBackupID(config.Name), common.GenerateBackupID(config.Name)}
+	for _, id := range ids {
+		if err := createChunkBackup(config, id, repo); err != nil {
+			t.Fatalf("createChunkBackup failed: %v", err)
+		}
+	}
+
+	backups, err := common.ListBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range backups {
+		if b.ID != ids[1] {
+			continue
+		}
+		// Instantané inchangé: rien de nouveau, mais la taille reste celle de la source
+		if b.Size != int64(len(content)) {
+			t.Errorf("Expected size %d, got %d", len(content), b.Size)
+		}
+		if b.Stats == nil || b.Stats.LiteralData != 0 || b.Stats.MatchedData != int64(len(content)) {
+			t.Errorf("Expected no new data and %d reused bytes, got %+v", len(content), b.Stats)
+		}
+		return
+	}
+	t.Fatalf("Backup %s not recorded", ids[1])
+}
+
+// withTestBackupInfo enregistre les métadonnées des sauvegardes dans un répertoire temporaire
+func withTestBackupInfo(t *testing.T) {
+	t.Helper()
+	origInfoDir := common.BackupInfoDir
+	common.BackupInfoDir = t.TempDir()
+	t.Cleanup(func() { common.BackupInfoDir = origInfoDir })
+}
@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Noziop/s4v3my4ss/internal/chunkstore"
+	"github.com/Noziop/s4v3my4ss/internal/encryption"
+	"github.com/Noziop/s4v3my4ss/internal/manifest"
+	"github.com/Noziop/s4v3my4ss/internal/wrappers"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// VerifyBackup relit une sauvegarde et la compare à son manifeste.
+// Le rapport liste les fichiers manquants, corrompus ou en trop.
+func VerifyBackup(id string) (manifest.Report, error) {
+	info, err := findBackup(id)
+	if err != nil {
+		return manifest.Report{}, err
+	}
+	common.LogInfo("Vérification de la sauvegarde %s (%s).", id, info.BackupPath)
+
+	if info.RemoteServer != nil {
+		return manifest.Report{}, fmt.Errorf("la vérification des sauvegardes distantes n'est pas prise en charge")
+	}
+
+	// Dans un dépôt dédupliqué, l'instantané tient lieu de manifeste
+	if info.Format == common.FormatChunks {
+		repo, err := chunkstore.Open(info.BackupPath)
+		if err != nil {
+			return manifest.Report{}, fmt.Errorf("impossible d'ouvrir le dépôt %s: %w", info.BackupPath, err)
+		}
+		return repo.Verify(id)
+	}
+
+	if info.ManifestPath == "" {
+		return manifest.Report{}, fmt.Errorf("la sauvegarde %s n'a pas de manifeste (créée par une version antérieure)", id)
+	}
+
+	var keyring *encryption.Keyring
+	if info.Encrypted {
+		passphrase, err := common.EncryptionPassphrase()
+		if err != nil {
+			return manifest.Report{}, fmt.Errorf("impossible de vérifier une sauvegarde chiffrée: %w", err)
+		}
+		if keyring, err = encryption.NewKeyring(passphrase); err != nil {
+			return manifest.Report{}, err
+		}
+	}
+
+	m, err := manifest.Load(info.ManifestPath, keyring)
+	if err != nil {
+		return manifest.Report{}, err
+	}
+
+	var walk manifest.WalkFunc
+	if info.Compression {
+		if !common.FileExists(info.BackupPath) {
+			return manifest.Report{}, fmt.Errorf("archive de sauvegarde introuvable: %s", info.BackupPath)
+		}
+		cw, err := wrappers.NewCompressionWrapper()
+		if err != nil {
+			return manifest.Report{}, err
+		}
+		cw.Keyring = keyring
+		walk = func(fn manifest.EntryFunc) error {
+			return cw.WalkArchive(info.BackupPath, fn)
+		}
+	} else {
+		if !common.DirExists(info.BackupPath) {
+			return manifest.Report{}, fmt.Errorf("répertoire de sauvegarde introuvable: %s", info.BackupPath)
+		}
+		var open func(path string) (io.ReadCloser, error)
+		if keyring != nil {
+			open = keyring.OpenFile
+		}
+		walk = manifest.WalkDir(info.BackupPath, open)
+	}
+
+	report, err := manifest.Verify(m, walk)
+	if err != nil {
+		common.LogError("Erreur lors de la vérification de %s: %v", id, err)
+		return report, fmt.Errorf("erreur lors de la vérification: %w", err)
+	}
+	if report.OK() {
+		common.LogInfo("Sauvegarde %s vérifiée: %d éléments intacts.", id, report.Checked)
+	} else {
+		common.LogSecurity("Sauvegarde %s altérée: %d manquants, %d corrompus, %d en trop.",
+			id, len(report.Missing), len(report.Corrupted), len(report.Extra))
+	}
+	return report, nil
+}
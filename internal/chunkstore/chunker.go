@@ -0,0 +1,94 @@
+package chunkstore
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// minChunkSize est la taille minimale d'un bloc (sauf dernier bloc d'un fichier)
+	minChunkSize = 256 << 10
+	// maxChunkSize est la taille maximale d'un bloc
+	maxChunkSize = 4 << 20
+	// chunkMask détermine la taille moyenne des blocs (~1 Mo)
+	chunkMask = (1 << 20) - 1
+)
+
+// gearTable contient les valeurs pseudo-aléatoires du hachage roulant "gear".
+// Elle est dérivée de SHA-256 pour rester identique d'une version à l'autre:
+// des frontières de blocs différentes casseraient la déduplication d'un dépôt existant.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	for i := range table {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("s4v3my4ss-gear-%d", i)))
+		table[i] = binary.LittleEndian.Uint64(sum[:8])
+	}
+	return table
+}()
+
+// chunker découpe un flux en blocs définis par leur contenu (content-defined chunking).
+// Une insertion au milieu d'un fichier ne décale ainsi que les blocs voisins.
+type chunker struct {
+	r     io.Reader
+	buf   []byte
+	start int
+	end   int
+	eof   bool
+}
+
+// newChunker crée un découpeur lisant depuis r
+func newChunker(r io.Reader) *chunker {
+	return &chunker{
+		r:   r,
+		buf: make([]byte, maxChunkSize),
+	}
+}
+
+// Next renvoie le bloc suivant, ou io.EOF quand le flux est épuisé.
+// Le slice renvoyé n'est valide que jusqu'au prochain appel.
+func (c *chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+
+	data := c.buf[c.start:c.end]
+	cut := len(data)
+	if len(data) > minChunkSize {
+		var hash uint64
+		for i := minChunkSize; i < len(data); i++ {
+			hash = (hash << 1) + gearTable[data[i]]
+			if hash&chunkMask == 0 {
+				cut = i + 1
+				break
+			}
+		}
+	}
+
+	chunk := data[:cut]
+	c.start += cut
+	return chunk, nil
+}
+
+// fill complète le tampon jusqu'à maxChunkSize octets disponibles ou la fin du flux
+func (c *chunker) fill() error {
+	if c.eof || c.end-c.start >= maxChunkSize {
+		return nil
+	}
+
+	copy(c.buf, c.buf[c.start:c.end])
+	c.end -= c.start
+	c.start = 0
+
+	n, err := io.ReadFull(c.r, c.buf[c.end:])
+	c.end += n
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.eof = true
+		return nil
+	}
+	return err
+}
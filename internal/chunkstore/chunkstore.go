@@ -0,0 +1,661 @@
+package chunkstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/internal/manifest"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// repositoryVersion est la version du format de dépôt écrite dans repo.json
+const repositoryVersion = 1
+
+// Types d'entrées d'un instantané
+const (
+	EntryDir     = "dir"
+	EntryFile    = "file"
+	EntrySymlink = "symlink"
+)
+
+// Repository représente un dépôt de blocs dédupliqués stocké sous une destination de sauvegarde.
+// Chaque fichier est découpé en blocs identifiés par leur SHA-256 et stockés une seule fois
+// dans chunks/, les instantanés étant des arborescences de références dans snapshots/.
+type Repository struct {
+	// Path est le répertoire racine du dépôt
+	Path string
+}
+
+// Snapshot décrit l'arborescence d'une sauvegarde sous forme de références de blocs
+type Snapshot struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	SourcePath string    `json:"sourcePath"`
+	Time       time.Time `json:"time"`
+	Entries    []Entry   `json:"entries"`
+}
+
+// Entry est un élément (répertoire, fichier ou lien symbolique) d'un instantané
+type Entry struct {
+	Path    string      `json:"path"`
+	Type    string      `json:"type"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	Size    int64       `json:"size,omitempty"`
+	Target  string      `json:"target,omitempty"` // Cible d'un lien symbolique
+	Chunks  []string    `json:"chunks,omitempty"`
+}
+
+// CreateStats résume le travail effectué lors de la création d'un instantané
+type CreateStats struct {
+	// Files est le nombre de fichiers réguliers parcourus
+	Files int
+	// TotalSize est la taille logique de l'instantané
+	TotalSize int64
+	// NewChunks est le nombre de blocs ajoutés au dépôt
+	NewChunks int
+	// NewBytes est le volume effectivement écrit dans le dépôt
+	NewBytes int64
+}
+
+// PruneStats résume le nettoyage des blocs non référencés
+type PruneStats struct {
+	RemovedChunks int
+	RemovedBytes  int64
+}
+
+// lockFile est le fichier verrouillé (flock) pendant les opérations modifiant le dépôt
+const lockFile = "lock"
+
+// lock verrouille le dépôt et renvoie la fonction de déverrouillage. Le verrou est posé sur
+// un fichier du dépôt: il sérialise aussi les processus (démon, surveillance, commandes) pour
+// qu'un nettoyage ne supprime pas des blocs en cours de référencement par un autre.
+func (r *Repository) lock() (func(), error) {
+	file, err := os.OpenFile(filepath.Join(r.Path, lockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("impossible d'ouvrir le verrou du dépôt: %w", err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("impossible de verrouiller le dépôt: %w", err)
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// Open ouvre le dépôt situé à path, en l'initialisant s'il n'existe pas encore
+func Open(path string) (*Repository, error) {
+	if !common.IsValidPath(path) {
+		common.LogError("Chemin de dépôt invalide ou non sécurisé: %s", path)
+		return nil, fmt.Errorf("chemin de dépôt invalide ou non sécurisé: %s", path)
+	}
+
+	r := &Repository{Path: path}
+	for _, dir := range []string{r.chunksDir(), r.snapshotsDir()} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			common.LogError("Impossible de créer le répertoire du dépôt %s: %v", dir, err)
+			return nil, fmt.Errorf("impossible de créer le répertoire du dépôt: %w", err)
+		}
+	}
+
+	configPath := filepath.Join(path, "repo.json")
+	if !common.FileExists(configPath) {
+		data, _ := json.MarshalIndent(map[string]int{"version": repositoryVersion}, "", "  ")
+		if err := os.WriteFile(configPath, data, 0600); err != nil {
+			common.LogError("Impossible d'initialiser le dépôt %s: %v", path, err)
+			return nil, fmt.Errorf("impossible d'initialiser le dépôt: %w", err)
+		}
+		common.LogInfo("Dépôt de blocs initialisé dans %s.", path)
+	}
+
+	return r, nil
+}
+
+// CreateSnapshot parcourt source et enregistre un nouvel instantané id dans le dépôt
+func (r *Repository) CreateSnapshot(id, name, source string, excludeDirs, excludeFiles []string) (Snapshot, CreateStats, error) {
+	common.LogInfo("Création de l'instantané %s de %s dans le dépôt %s.", id, source, r.Path)
+	var stats CreateStats
+
+	if !common.IsValidName(id) || id == "" {
+		return Snapshot{}, stats, fmt.Errorf("ID d'instantané invalide: %s", id)
+	}
+	if !common.DirExists(source) {
+		common.LogError("Le répertoire source '%s' n'existe pas.", source)
+		return Snapshot{}, stats, fmt.Errorf("le répertoire source '%s' n'existe pas", source)
+	}
+
+	unlock, err := r.lock()
+	if err != nil {
+		return Snapshot{}, stats, err
+	}
+	defer unlock()
+
+	snapshot := Snapshot{
+		ID:         id,
+		Name:       name,
+		SourcePath: source,
+		Time:       time.Now(),
+	}
+
+	err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if common.IsExcluded(rel, info.IsDir(), excludeDirs, excludeFiles) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		entry := Entry{
+			Path:    filepath.ToSlash(rel),
+			Mode:    info.Mode().Perm(),
+			ModTime: info.ModTime(),
+		}
+
+		switch {
+		case info.IsDir():
+			entry.Type = EntryDir
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			entry.Type = EntrySymlink
+			entry.Target = target
+		case info.Mode().IsRegular():
+			entry.Type = EntryFile
+			entry.Size = info.Size()
+			chunks, err := r.storeFile(path, &stats)
+			if err != nil {
+				return fmt.Errorf("erreur lors du stockage de %s: %w", rel, err)
+			}
+			entry.Chunks = chunks
+			stats.Files++
+			stats.TotalSize += info.Size()
+		default:
+			// Sockets, FIFO et périphériques ne sont pas sauvegardés
+			common.LogWarning("Élément spécial ignoré dans l'instantané %s: %s", id, rel)
+			return nil
+		}
+
+		snapshot.Entries = append(snapshot.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		common.LogError("Erreur lors de la création de l'instantané %s: %v", id, err)
+		return Snapshot{}, stats, fmt.Errorf("erreur lors de la création de l'instantané: %w", err)
+	}
+
+	if err := r.writeSnapshot(snapshot); err != nil {
+		return Snapshot{}, stats, err
+	}
+
+	common.LogInfo("Instantané %s créé: %d fichiers, %d nouveaux blocs (%s écrits).",
+		id, stats.Files, stats.NewChunks, common.FormatSize(stats.NewBytes))
+	return snapshot, stats, nil
+}
+
+// storeFile découpe un fichier en blocs, stocke les blocs absents et renvoie leurs empreintes
+func (r *Repository) storeFile(path string, stats *CreateStats) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var hashes []string
+	c := newChunker(file)
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(chunk)
+		hash := hex.EncodeToString(sum[:])
+		written, err := r.writeChunk(hash, chunk)
+		if err != nil {
+			return nil, err
+		}
+		if written {
+			stats.NewChunks++
+			stats.NewBytes += int64(len(chunk))
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// writeChunk écrit un bloc s'il n'est pas déjà présent dans le dépôt
+func (r *Repository) writeChunk(hash string, data []byte) (bool, error) {
+	path := r.chunkPath(hash)
+	if common.FileExists(path) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return false, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return false, err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	return true, nil
+}
+
+// readChunk lit un bloc et vérifie son empreinte
+func (r *Repository) readChunk(hash string) ([]byte, error) {
+	data, err := os.ReadFile(r.chunkPath(hash))
+	if err != nil {
+		return nil, fmt.Errorf("bloc %s illisible: %w", hash, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != hash {
+		common.LogSecurity("Bloc corrompu détecté dans le dépôt %s: %s", r.Path, hash)
+		return nil, fmt.Errorf("bloc %s corrompu", hash)
+	}
+	return data, nil
+}
+
+// LoadSnapshot charge un instantané par son ID
+func (r *Repository) LoadSnapshot(id string) (Snapshot, error) {
+	var snapshot Snapshot
+	if !common.IsValidName(id) || id == "" {
+		return snapshot, fmt.Errorf("ID d'instantané invalide: %s", id)
+	}
+
+	data, err := os.ReadFile(r.snapshotPath(id))
+	if err != nil {
+		common.LogError("Impossible de lire l'instantané %s: %v", id, err)
+		return snapshot, fmt.Errorf("impossible de lire l'instantané %s: %w", id, err)
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		common.LogError("Impossible de désérialiser l'instantané %s: %v", id, err)
+		return snapshot, fmt.Errorf("instantané %s invalide: %w", id, err)
+	}
+	return snapshot, nil
+}
+
+// ListSnapshots liste les instantanés du dépôt, du plus ancien au plus récent.
+// Un instantané illisible est une erreur: l'ignorer ferait supprimer ses blocs par Prune.
+func (r *Repository) ListSnapshots() ([]Snapshot, error) {
+	files, err := os.ReadDir(r.snapshotsDir())
+	if err != nil {
+		common.LogError("Impossible de lire les instantanés du dépôt %s: %v", r.Path, err)
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		snapshot, err := r.LoadSnapshot(strings.TrimSuffix(file.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// Restore restaure l'instantané id dans le répertoire target
+func (r *Repository) Restore(id, target string) error {
+	return r.RestoreFiltered(id, target, nil)
+}
+
+// RestoreFiltered restaure uniquement les entrées de l'instantané id pour lesquelles
+// filter renvoie true. Un filtre nil restaure tout l'instantané.
+func (r *Repository) RestoreFiltered(id, target string, filter func(path string) bool) error {
+	common.LogInfo("Restauration de l'instantané %s du dépôt %s vers %s.", id, r.Path, target)
+	snapshot, err := r.LoadSnapshot(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return fmt.Errorf("impossible de créer le répertoire de destination: %w", err)
+	}
+
+	for _, entry := range snapshot.Entries {
+		if filter != nil && !filter(entry.Path) {
+			continue
+		}
+		dest, err := safeJoin(target, entry.Path)
+		if err == nil {
+			err = common.CheckNoSymlinkAncestor(target, filepath.FromSlash(entry.Path))
+		}
+		if err != nil {
+			common.LogSecurity("Entrée suspecte ignorée dans l'instantané %s: %s", id, entry.Path)
+			return err
+		}
+		// Les répertoires parents d'une entrée retenue peuvent avoir été filtrés
+		if filter != nil {
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return fmt.Errorf("impossible de créer %s: %w", filepath.Dir(entry.Path), err)
+			}
+		}
+
+		switch entry.Type {
+		case EntryDir:
+			if err := os.MkdirAll(dest, 0700); err != nil {
+				return fmt.Errorf("impossible de créer %s: %w", entry.Path, err)
+			}
+		case EntrySymlink:
+			os.Remove(dest)
+			if err := os.Symlink(entry.Target, dest); err != nil {
+				return fmt.Errorf("impossible de créer le lien %s: %w", entry.Path, err)
+			}
+		case EntryFile:
+			if err := r.restoreFile(entry, dest); err != nil {
+				return fmt.Errorf("impossible de restaurer %s: %w", entry.Path, err)
+			}
+		}
+	}
+
+	// Appliquer permissions et dates des répertoires en partant des plus profonds,
+	// une fois leur contenu écrit
+	for i := len(snapshot.Entries) - 1; i >= 0; i-- {
+		entry := snapshot.Entries[i]
+		if entry.Type != EntryDir || (filter != nil && !filter(entry.Path)) {
+			continue
+		}
+		dest, _ := safeJoin(target, entry.Path)
+		// Une entrée suivante a pu remplacer le répertoire par un lien symbolique
+		if info, err := os.Lstat(dest); err != nil || !info.IsDir() {
+			continue
+		}
+		os.Chmod(dest, entry.Mode)
+		os.Chtimes(dest, entry.ModTime, entry.ModTime)
+	}
+
+	common.LogInfo("Instantané %s restauré dans %s.", id, target)
+	return nil
+}
+
+// restoreFile reconstitue un fichier à partir de ses blocs
+func (r *Repository) restoreFile(entry Entry, dest string) error {
+	// Remplacer le fichier plutôt que le réécrire, pour ne pas modifier ses autres liens physiques
+	os.Remove(dest)
+	file, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	for _, hash := range entry.Chunks {
+		data, err := r.readChunk(hash)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		if _, err := file.Write(data); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(dest, entry.Mode); err != nil {
+		return err
+	}
+	return os.Chtimes(dest, entry.ModTime, entry.ModTime)
+}
+
+// Walk parcourt le contenu de l'instantané id sans le restaurer, en appelant fn pour chaque
+// fichier régulier et lien symbolique. Le contenu des fichiers est reconstitué à la lecture.
+func (r *Repository) Walk(id string, fn manifest.EntryFunc) error {
+	snapshot, err := r.LoadSnapshot(id)
+	if err != nil {
+		return err
+	}
+	for _, entry := range snapshot.Entries {
+		switch entry.Type {
+		case EntryFile:
+			err = fn(entry.Path, entry.FileInfo(), "", &chunkReader{repo: r, chunks: entry.Chunks})
+		case EntrySymlink:
+			err = fn(entry.Path, entry.FileInfo(), entry.Target, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileInfo renvoie la description de l'entrée sous forme d'os.FileInfo
+func (e Entry) FileInfo() os.FileInfo {
+	return entryInfo{e}
+}
+
+// entryInfo expose une entrée d'instantané comme un os.FileInfo
+type entryInfo struct {
+	entry Entry
+}
+
+func (i entryInfo) Name() string       { return filepath.Base(i.entry.Path) }
+func (i entryInfo) Size() int64        { return i.entry.Size }
+func (i entryInfo) ModTime() time.Time { return i.entry.ModTime }
+func (i entryInfo) IsDir() bool        { return i.entry.Type == EntryDir }
+func (i entryInfo) Sys() interface{}   { return nil }
+
+func (i entryInfo) Mode() os.FileMode {
+	switch i.entry.Type {
+	case EntryDir:
+		return i.entry.Mode.Perm() | os.ModeDir
+	case EntrySymlink:
+		return i.entry.Mode.Perm() | os.ModeSymlink
+	}
+	return i.entry.Mode.Perm()
+}
+
+// chunkReader lit le contenu d'un fichier bloc par bloc
+type chunkReader struct {
+	repo   *Repository
+	chunks []string
+	buf    []byte
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if len(c.chunks) == 0 {
+			return 0, io.EOF
+		}
+		data, err := c.repo.readChunk(c.chunks[0])
+		if err != nil {
+			return 0, err
+		}
+		c.buf, c.chunks = data, c.chunks[1:]
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// Verify relit tous les blocs référencés par un instantané et contrôle leur empreinte.
+// L'instantané tient lieu de manifeste: un fichier dont un bloc manque ou est altéré,
+// ou dont la taille reconstituée diffère, est signalé comme corrompu.
+func (r *Repository) Verify(id string) (manifest.Report, error) {
+	var report manifest.Report
+	snapshot, err := r.LoadSnapshot(id)
+	if err != nil {
+		return report, err
+	}
+
+	for _, entry := range snapshot.Entries {
+		if entry.Type != EntryFile {
+			continue
+		}
+		report.Checked++
+		var size int64
+		var problem string
+		for _, hash := range entry.Chunks {
+			data, err := r.readChunk(hash)
+			if err != nil {
+				problem = err.Error()
+				break
+			}
+			size += int64(len(data))
+		}
+		if problem == "" && size != entry.Size {
+			problem = fmt.Sprintf("taille %d au lieu de %d", size, entry.Size)
+		}
+		if problem != "" {
+			report.Corrupted = append(report.Corrupted, manifest.Problem{Path: entry.Path, Reason: problem})
+		}
+	}
+	return report, nil
+}
+
+// DeleteSnapshot supprime un instantané du dépôt. Les blocs ne sont libérés que par Prune.
+func (r *Repository) DeleteSnapshot(id string) error {
+	if !common.IsValidName(id) || id == "" {
+		return fmt.Errorf("ID d'instantané invalide: %s", id)
+	}
+
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.Remove(r.snapshotPath(id)); err != nil && !os.IsNotExist(err) {
+		common.LogError("Impossible de supprimer l'instantané %s: %v", id, err)
+		return fmt.Errorf("impossible de supprimer l'instantané %s: %w", id, err)
+	}
+	common.LogSecurity("Instantané %s supprimé du dépôt %s.", id, r.Path)
+	return nil
+}
+
+// Prune supprime les blocs qui ne sont plus référencés par aucun instantané
+func (r *Repository) Prune() (PruneStats, error) {
+	var stats PruneStats
+
+	unlock, err := r.lock()
+	if err != nil {
+		return stats, err
+	}
+	defer unlock()
+
+	// Sans la liste complète des blocs référencés, aucun bloc ne peut être supprimé
+	snapshots, err := r.ListSnapshots()
+	if err != nil {
+		common.LogError("Nettoyage du dépôt %s annulé: %v", r.Path, err)
+		return stats, fmt.Errorf("nettoyage annulé, instantané illisible: %w", err)
+	}
+	referenced := make(map[string]struct{})
+	for _, snapshot := range snapshots {
+		for _, entry := range snapshot.Entries {
+			for _, hash := range entry.Chunks {
+				referenced[hash] = struct{}{}
+			}
+		}
+	}
+
+	err = filepath.Walk(r.chunksDir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if _, ok := referenced[info.Name()]; ok {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		stats.RemovedChunks++
+		stats.RemovedBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		common.LogError("Erreur lors du nettoyage du dépôt %s: %v", r.Path, err)
+		return stats, fmt.Errorf("erreur lors du nettoyage du dépôt: %w", err)
+	}
+
+	common.LogInfo("Nettoyage du dépôt %s: %d blocs supprimés (%s libérés).",
+		r.Path, stats.RemovedChunks, common.FormatSize(stats.RemovedBytes))
+	return stats, nil
+}
+
+// writeSnapshot enregistre un instantané de manière atomique
+func (r *Repository) writeSnapshot(snapshot Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("impossible de sérialiser l'instantané: %w", err)
+	}
+	path := r.snapshotPath(snapshot.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		common.LogError("Impossible d'écrire l'instantané %s: %v", snapshot.ID, err)
+		return fmt.Errorf("impossible d'écrire l'instantané: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("impossible d'écrire l'instantané: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) chunksDir() string {
+	return filepath.Join(r.Path, "chunks")
+}
+
+func (r *Repository) snapshotsDir() string {
+	return filepath.Join(r.Path, "snapshots")
+}
+
+func (r *Repository) snapshotPath(id string) string {
+	return filepath.Join(r.snapshotsDir(), id+".json")
+}
+
+func (r *Repository) chunkPath(hash string) string {
+	return filepath.Join(r.chunksDir(), hash[:2], hash)
+}
+
+// safeJoin joint un chemin relatif d'instantané à la cible en refusant toute sortie de celle-ci
+func safeJoin(target, rel string) (string, error) {
+	dest := filepath.Join(target, filepath.FromSlash(rel))
+	relCheck, err := filepath.Rel(target, dest)
+	if err != nil || relCheck == ".." || strings.HasPrefix(relCheck, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("chemin hors de la destination: %s", rel)
+	}
+	return dest, nil
+}
@@ -0,0 +1,237 @@
+package chunkstore
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRoundTripAndDeduplication(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "chunkstore_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "subdir"), 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(sourceDir, "node_modules"), 0755); err != nil {
+		t.Fatalf("Failed to create excluded dir: %v", err)
+	}
+
+	// Un fichier de plusieurs blocs et deux copies identiques
+	big := make([]byte, 3*maxChunkSize)
+	rand.New(rand.NewSource(1)).Read(big)
+	files := map[string][]byte{
+		"big.bin":           big,
+		"subdir/copy.bin":   big,
+		"subdir/small.txt":  []byte("small content"),
+		"node_modules/x.js": []byte("excluded"),
+		"debug.log":         []byte("excluded too"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), content, 0640); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	repo, err := Open(filepath.Join(tempDir, "repo"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	_, stats, err := repo.CreateSnapshot("first", "test", sourceDir, []string{"node_modules"}, []string{"*.log"})
+	if err != nil {
+		t.Fatalf("CreateSnapshot failed: %v", err)
+	}
+	if stats.Files != 3 {
+		t.Errorf("Expected 3 files in snapshot, got %d", stats.Files)
+	}
+	if stats.NewBytes >= stats.TotalSize {
+		t.Errorf("Expected identical files to be deduplicated, wrote %d of %d bytes", stats.NewBytes, stats.TotalSize)
+	}
+
+	_, stats, err = repo.CreateSnapshot("second", "test", sourceDir, []string{"node_modules"}, []string{"*.log"})
+	if err != nil {
+		t.Fatalf("Second CreateSnapshot failed: %v", err)
+	}
+	if stats.NewChunks != 0 {
+		t.Errorf("Expected no new chunks for unchanged source, got %d", stats.NewChunks)
+	}
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	if err := repo.Restore("second", restoreDir); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	for _, name := range []string{"big.bin", "subdir/copy.bin", "subdir/small.txt"} {
+		content, err := os.ReadFile(filepath.Join(restoreDir, name))
+		if err != nil {
+			t.Errorf("Restored file %s missing: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(content, files[name]) {
+			t.Errorf("Restored file %s has wrong content", name)
+		}
+	}
+	for _, name := range []string{"node_modules/x.js", "debug.log"} {
+		if _, err := os.Stat(filepath.Join(restoreDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Excluded file %s should not have been restored", name)
+		}
+	}
+
+	// Restauration sélective d'un seul fichier, sans ses voisins
+	partialDir := filepath.Join(tempDir, "partial")
+	only := func(path string) bool { return path == "subdir/small.txt" }
+	if err := repo.RestoreFiltered("second", partialDir, only); err != nil {
+		t.Fatalf("RestoreFiltered failed: %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(partialDir, "subdir/small.txt")); err != nil || !bytes.Equal(content, files["subdir/small.txt"]) {
+		t.Errorf("Expected subdir/small.txt to be restored, got %q (%v)", content, err)
+	}
+	for _, name := range []string{"big.bin", "subdir/copy.bin"} {
+		if _, err := os.Stat(filepath.Join(partialDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Filtered out file %s should not have been restored", name)
+		}
+	}
+
+	// Les blocs restent référencés par "second" après la suppression de "first"
+	if err := repo.DeleteSnapshot("first"); err != nil {
+		t.Fatalf("DeleteSnapshot failed: %v", err)
+	}
+	pruned, err := repo.Prune()
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if pruned.RemovedChunks != 0 {
+		t.Errorf("Expected no chunk removed while still referenced, got %d", pruned.RemovedChunks)
+	}
+
+	if err := repo.DeleteSnapshot("second"); err != nil {
+		t.Fatalf("DeleteSnapshot failed: %v", err)
+	}
+	pruned, err = repo.Prune()
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if pruned.RemovedChunks == 0 {
+		t.Errorf("Expected orphan chunks to be removed")
+	}
+}
+
+func TestPruneKeepsChunksOfUnreadableSnapshot(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("precious content"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	repo, err := Open(filepath.Join(tempDir, "repo"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, _, err := repo.CreateSnapshot("only", "test", sourceDir, nil, nil); err != nil {
+		t.Fatalf("CreateSnapshot failed: %v", err)
+	}
+
+	// Instantané tronqué: ses blocs ne sont plus connus
+	if err := os.WriteFile(repo.snapshotPath("only"), []byte(`{"id": "only", "entr`), 0600); err != nil {
+		t.Fatalf("Failed to truncate snapshot: %v", err)
+	}
+	if _, err := repo.ListSnapshots(); err == nil {
+		t.Errorf("Expected ListSnapshots to report the unreadable snapshot")
+	}
+	pruned, err := repo.Prune()
+	if err == nil {
+		t.Fatalf("Expected Prune to abort on an unreadable snapshot")
+	}
+	if pruned.RemovedChunks != 0 {
+		t.Errorf("Expected no chunk removed, got %d", pruned.RemovedChunks)
+	}
+
+	var chunks int
+	filepath.Walk(repo.chunksDir(), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			chunks++
+		}
+		return nil
+	})
+	if chunks == 0 {
+		t.Errorf("Chunks of the unreadable snapshot were deleted")
+	}
+}
+
+func TestPruneWaitsForRepositoryLock(t *testing.T) {
+	repo, err := Open(filepath.Join(t.TempDir(), "repo"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	// Verrou tenu par un autre processus, par exemple une sauvegarde du démon
+	file, err := os.OpenFile(filepath.Join(repo.Path, lockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatalf("Failed to open lock file: %v", err)
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatalf("Flock failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := repo.Prune()
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("Prune ran while the repository was locked")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Prune failed after the lock was released: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Prune never acquired the released lock")
+	}
+}
+
+func TestRestoreRefusesEntriesThroughSymlink(t *testing.T) {
+	tempDir := t.TempDir()
+	outside := filepath.Join(tempDir, "outside")
+	if err := os.MkdirAll(outside, 0755); err != nil {
+		t.Fatalf("Failed to create outside dir: %v", err)
+	}
+
+	repo, err := Open(filepath.Join(tempDir, "repo"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	// Instantané modifié dans un dépôt partagé: un lien vers l'extérieur, puis un fichier à travers
+	snapshot := Snapshot{ID: "evil", Name: "test", Entries: []Entry{
+		{Path: "link", Type: EntrySymlink, Mode: 0777, Target: outside},
+		{Path: "link/sub", Type: EntryDir, Mode: 0755},
+		{Path: "link/sub/file.txt", Type: EntryFile, Mode: 0644},
+	}}
+	if err := repo.writeSnapshot(snapshot); err != nil {
+		t.Fatalf("writeSnapshot failed: %v", err)
+	}
+
+	if err := repo.Restore("evil", filepath.Join(tempDir, "restore")); err == nil {
+		t.Errorf("Expected a file below a restored symlink to be refused")
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "sub")); !os.IsNotExist(err) {
+		t.Errorf("Restore wrote outside the target")
+	}
+}
@@ -0,0 +1,325 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/internal/backup"
+	"github.com/Noziop/s4v3my4ss/internal/journal"
+	"github.com/Noziop/s4v3my4ss/internal/watch"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+const (
+	// minRestartDelay est le délai avant de relancer une surveillance arrêtée, doublé à chaque échec
+	minRestartDelay = time.Second
+	// maxRestartDelay plafonne le délai entre deux relances d'une surveillance
+	maxRestartDelay = 5 * time.Minute
+	// stableAfter est la durée de fonctionnement après laquelle une surveillance est jugée
+	// stable: le délai de relance repart alors du minimum
+	stableAfter = time.Minute
+	// scheduleCheckEvery est la période de vérification des planifications. L'heure est relue
+	// à chaque vérification: un créneau manqué pendant une mise en veille est rattrapé au réveil.
+	scheduleCheckEvery = 30 * time.Second
+	// maxCatchUp limite la recherche du dernier créneau manqué
+	maxCatchUp = 7 * 24 * time.Hour
+)
+
+// Options contient les paramètres du démon
+type Options struct {
+	// MaxConcurrent est le nombre maximal de sauvegardes simultanées (1 si nul)
+	MaxConcurrent int
+	// WatchAll surveille les modifications de toutes les configurations, pas seulement
+	// de celles dont l'option Watch est activée
+	WatchAll bool
+	// StatePath est le fichier qui conserve les créneaux planifiés déjà exécutés (rien n'est
+	// conservé si vide)
+	StatePath string
+}
+
+// Daemon supervise les sauvegardes de plusieurs configurations: sauvegarde périodique selon
+// leur intervalle ou leur planification, et surveillance des modifications. Une configuration
+// n'a jamais deux sauvegardes en cours: une demande reçue pendant une sauvegarde est reportée
+// à sa fin.
+type Daemon struct {
+	configs []common.BackupConfig
+	opts    Options
+	sem     chan struct{} // Jetons de sauvegarde, limite le nombre de sauvegardes simultanées
+	wg      sync.WaitGroup
+	state   *state
+
+	mu      sync.Mutex
+	running map[string]bool // Configurations dont une sauvegarde est en cours
+	pending map[string]bool // Configurations à sauvegarder de nouveau à la fin de la sauvegarde en cours
+
+	// backup crée une sauvegarde (backup.CreateBackup par défaut)
+	backup func(config common.BackupConfig) error
+}
+
+// New crée un démon pour les configurations données
+func New(configs []common.BackupConfig, opts Options) *Daemon {
+	if opts.MaxConcurrent < 1 {
+		opts.MaxConcurrent = 1
+	}
+	return &Daemon{
+		configs: configs,
+		opts:    opts,
+		sem:     make(chan struct{}, opts.MaxConcurrent),
+		running: make(map[string]bool),
+		pending: make(map[string]bool),
+		state:   loadState(opts.StatePath),
+		backup: func(config common.BackupConfig) error {
+			bc := backup.FromConfig(config)
+			// Le journal n'est exploité que si la surveillance de la configuration le tient à jour
+			if backup.UsesChangeJournal(config) {
+				bc.Journal, _ = journal.For(config.Name)
+			}
+			return backup.CreateBackup(bc)
+		},
+	}
+}
+
+// Run supervise les configurations jusqu'à l'annulation de ctx, puis attend la fin des
+// sauvegardes en cours. Renvoie une erreur si aucune configuration n'est à superviser ou
+// si une planification est invalide.
+func (d *Daemon) Run(ctx context.Context) error {
+	schedules := make(map[string]*common.Schedule)
+	for _, config := range d.configs {
+		if config.Schedule == "" {
+			continue
+		}
+		schedule, err := common.ParseSchedule(config.Schedule)
+		if err != nil {
+			return fmt.Errorf("configuration %s: %w", config.Name, err)
+		}
+		schedules[config.Name] = schedule
+	}
+
+	supervised := 0
+	for _, config := range d.configs {
+		watched := config.Watch || d.opts.WatchAll
+		schedule := schedules[config.Name]
+		if config.Interval <= 0 && !watched && schedule == nil {
+			common.LogInfo("Configuration %s ignorée par le démon: ni intervalle, ni planification, ni surveillance.", config.Name)
+			continue
+		}
+		supervised++
+		if schedule != nil {
+			fmt.Printf("[%s] Sauvegarde planifiée: %s (prochaine le %s).\n", config.Name, schedule, schedule.Next(time.Now()).Format("02/01/2006 15:04"))
+			d.wg.Add(1)
+			go d.runSchedule(ctx, config, schedule)
+		}
+		if config.Interval > 0 {
+			fmt.Printf("[%s] Sauvegarde toutes les %d minute(s).\n", config.Name, config.Interval)
+			d.wg.Add(1)
+			go d.runInterval(ctx, config)
+		}
+		if watched {
+			fmt.Printf("[%s] Surveillance de %s.\n", config.Name, config.SourcePath)
+			d.wg.Add(1)
+			go d.runWatcher(ctx, config)
+		}
+	}
+	if supervised == 0 {
+		return fmt.Errorf("aucune configuration à superviser (définissez un intervalle, une planification, l'option watch ou utilisez --watch-all)")
+	}
+	common.LogInfo("Démon démarré: %d configuration(s) supervisée(s), %d sauvegarde(s) simultanée(s) au plus.", supervised, d.opts.MaxConcurrent)
+
+	<-ctx.Done()
+	common.LogInfo("Arrêt du démon demandé, attente de la fin des sauvegardes en cours.")
+	d.wg.Wait()
+	common.LogInfo("Démon arrêté.")
+	return nil
+}
+
+// runInterval déclenche une sauvegarde de la configuration à chaque intervalle
+func (d *Daemon) runInterval(ctx context.Context, config common.BackupConfig) {
+	defer d.wg.Done()
+	ticker := time.NewTicker(time.Duration(config.Interval) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.trigger(ctx, config, "intervalle")
+		}
+	}
+}
+
+// runSchedule déclenche une sauvegarde de la configuration à chaque créneau de sa planification,
+// à la manière d'anacron: un créneau manqué (machine éteinte ou en veille) est rattrapé dès que
+// possible, et plusieurs créneaux manqués ne donnent lieu qu'à une seule sauvegarde. Le créneau
+// est enregistré au déclenchement, il n'est donc jamais exécuté deux fois.
+func (d *Daemon) runSchedule(ctx context.Context, config common.BackupConfig, schedule *common.Schedule) {
+	defer d.wg.Done()
+	last := d.state.lastRun(config.Name)
+	if last.IsZero() {
+		// Premier démarrage: une sauvegarde existante plus récente que le dernier créneau suffit
+		last = latestBackupTime(config.Name)
+	}
+
+	check := func() {
+		// Heure murale: les minuteries ne tiennent pas compte du temps passé en veille
+		now := time.Now().Round(0)
+		slot := dueSlot(schedule, last, now)
+		if slot.IsZero() {
+			return
+		}
+		last = slot
+		if err := d.state.record(config.Name, slot); err != nil {
+			common.LogError("%v", err)
+		}
+		d.trigger(ctx, config, "planification du "+slot.Format("02/01/2006 15:04"))
+	}
+
+	check()
+	ticker := time.NewTicker(scheduleCheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+// dueSlot renvoie le créneau le plus récent, postérieur à last et passé à la date now, ou la
+// date zéro si aucun créneau n'est dû
+func dueSlot(schedule *common.Schedule, last, now time.Time) time.Time {
+	// Les créneaux sont des heures murales du fuseau courant: un créneau de l'heure répétée au
+	// passage à l'heure d'hiver n'est pas exécuté deux fois, quel que soit le fuseau de last
+	slot := schedule.Next(last.In(now.Location()))
+	if slot.IsZero() || slot.After(now) {
+		return time.Time{}
+	}
+	// Inutile de parcourir tous les créneaux d'une longue absence
+	if from := now.Add(-maxCatchUp); slot.Before(from) {
+		if recent := schedule.Next(from); !recent.IsZero() && !recent.After(now) {
+			slot = recent
+		}
+	}
+	for next := schedule.Next(slot); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+		slot = next
+	}
+	return slot
+}
+
+// latestBackupTime renvoie la date de la dernière sauvegarde d'une configuration (zéro si aucune)
+func latestBackupTime(name string) time.Time {
+	var latest time.Time
+	backups, err := common.ListBackups()
+	if err != nil {
+		common.LogWarning("Impossible de lister les sauvegardes de %s: %v", name, err)
+		return latest
+	}
+	for _, b := range backups {
+		if b.Name == name && b.Time.After(latest) {
+			latest = b.Time
+		}
+	}
+	return latest
+}
+
+// runWatcher surveille les modifications de la configuration et relance la surveillance,
+// avec un délai croissant, chaque fois qu'elle s'arrête
+func (d *Daemon) runWatcher(ctx context.Context, config common.BackupConfig) {
+	defer d.wg.Done()
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		err := watch.WatchChanges(ctx, config, func() { d.trigger(ctx, config, "modification") })
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) >= stableAfter {
+			delay = minRestartDelay
+		}
+		common.LogError("Surveillance de %s arrêtée: %v. Relance dans %v.", config.Name, err, delay)
+		fmt.Printf("[%s] Surveillance arrêtée (%v), relance dans %v.\n", config.Name, err, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = nextDelay(delay)
+	}
+}
+
+// nextDelay renvoie le délai de relance suivant: le double du précédent, plafonné
+func nextDelay(delay time.Duration) time.Duration {
+	if delay *= 2; delay > maxRestartDelay {
+		return maxRestartDelay
+	}
+	return delay
+}
+
+// trigger demande une sauvegarde de la configuration. Si une sauvegarde est déjà en cours,
+// une seule nouvelle sauvegarde est faite à sa fin, quel que soit le nombre de demandes.
+func (d *Daemon) trigger(ctx context.Context, config common.BackupConfig, reason string) {
+	d.mu.Lock()
+	if d.running[config.Name] {
+		d.pending[config.Name] = true
+		d.mu.Unlock()
+		return
+	}
+	if ctx.Err() != nil {
+		d.mu.Unlock()
+		return
+	}
+	d.running[config.Name] = true
+	d.wg.Add(1)
+	d.mu.Unlock()
+
+	go func() {
+		defer d.wg.Done()
+		for {
+			select {
+			case d.sem <- struct{}{}:
+			case <-ctx.Done():
+				d.finish(config.Name)
+				return
+			}
+			d.run(config, reason)
+			<-d.sem
+
+			d.mu.Lock()
+			again := d.pending[config.Name] && ctx.Err() == nil
+			d.pending[config.Name] = false
+			if !again {
+				d.running[config.Name] = false
+			}
+			d.mu.Unlock()
+			if !again {
+				return
+			}
+			reason = "modifications pendant la sauvegarde précédente"
+		}
+	}()
+}
+
+// finish marque la configuration comme n'ayant plus de sauvegarde en cours ni en attente
+func (d *Daemon) finish(name string) {
+	d.mu.Lock()
+	d.running[name] = false
+	d.pending[name] = false
+	d.mu.Unlock()
+}
+
+// run crée une sauvegarde de la configuration et en affiche le résultat
+func (d *Daemon) run(config common.BackupConfig, reason string) {
+	common.LogInfo("Sauvegarde de %s (%s).", config.Name, reason)
+	fmt.Printf("[%s] Sauvegarde (%s)...\n", config.Name, reason)
+	started := time.Now()
+	if err := d.backup(config); err != nil {
+		common.LogError("Échec de la sauvegarde de %s: %v", config.Name, err)
+		fmt.Printf("[%s] Échec de la sauvegarde: %v\n", config.Name, err)
+		return
+	}
+	fmt.Printf("[%s] Sauvegarde terminée en %v.\n", config.Name, time.Since(started).Round(time.Second))
+}
@@ -0,0 +1,181 @@
+package daemon
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// fakeBackups enregistre les sauvegardes demandées et le nombre maximal de sauvegardes simultanées
+type fakeBackups struct {
+	mu      sync.Mutex
+	runs    map[string]int
+	active  int
+	maxSeen int
+	release chan struct{}
+}
+
+func (f *fakeBackups) backup(config common.BackupConfig) error {
+	f.mu.Lock()
+	f.runs[config.Name]++
+	f.active++
+	if f.active > f.maxSeen {
+		f.maxSeen = f.active
+	}
+	f.mu.Unlock()
+
+	<-f.release
+
+	f.mu.Lock()
+	f.active--
+	f.mu.Unlock()
+	return nil
+}
+
+func TestTriggerLimitsAndCoalesces(t *testing.T) {
+	fake := &fakeBackups{runs: make(map[string]int), release: make(chan struct{})}
+	d := New(nil, Options{MaxConcurrent: 2})
+	d.backup = fake.backup
+	ctx := context.Background()
+
+	configs := []common.BackupConfig{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	for _, config := range configs {
+		d.trigger(ctx, config, "test")
+	}
+	// Demandes reçues pendant la sauvegarde de a: une seule nouvelle sauvegarde
+	for i := 0; i < 5; i++ {
+		d.trigger(ctx, configs[0], "test")
+	}
+
+	// Libérer les sauvegardes une à une jusqu'à ce que toutes soient terminées
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case fake.release <- struct{}{}:
+		case <-done:
+			finished = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("sauvegardes non terminées")
+		}
+	}
+
+	if fake.maxSeen > 2 {
+		t.Errorf("%d sauvegardes simultanées, want at most 2", fake.maxSeen)
+	}
+	if fake.runs["a"] != 2 || fake.runs["b"] != 1 || fake.runs["c"] != 1 {
+		t.Errorf("runs = %v, want a:2 b:1 c:1", fake.runs)
+	}
+}
+
+func TestTriggerAfterShutdown(t *testing.T) {
+	d := New(nil, Options{})
+	d.backup = func(common.BackupConfig) error {
+		t.Error("sauvegarde lancée après l'arrêt")
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d.trigger(ctx, common.BackupConfig{Name: "a"}, "test")
+	d.wg.Wait()
+}
+
+func TestRunWithoutSupervisedConfig(t *testing.T) {
+	d := New([]common.BackupConfig{{Name: "a"}}, Options{})
+	if err := d.Run(context.Background()); err == nil {
+		t.Error("Run() without interval nor watch succeeded, want error")
+	}
+}
+
+func TestNextDelay(t *testing.T) {
+	delay := minRestartDelay
+	for i := 0; i < 20; i++ {
+		delay = nextDelay(delay)
+	}
+	if delay != maxRestartDelay {
+		t.Errorf("delay = %v, want %v", delay, maxRestartDelay)
+	}
+	if got := nextDelay(time.Second); got != 2*time.Second {
+		t.Errorf("nextDelay(1s) = %v, want 2s", got)
+	}
+}
+
+func TestDueSlot(t *testing.T) {
+	schedule, err := common.ParseSchedule("0 18 * * 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Vendredi 4 octobre 2024
+	friday := time.Date(2024, 10, 4, 18, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name      string
+		last, now time.Time
+		want      time.Time
+	}{
+		{"avant le créneau", friday.Add(-24 * time.Hour), friday.Add(-time.Minute), time.Time{}},
+		{"créneau atteint", friday.Add(-24 * time.Hour), friday, friday},
+		{"créneau déjà exécuté", friday, friday.Add(time.Hour), time.Time{}},
+		// Machine en veille tout le week-end: une seule sauvegarde, pour le créneau le plus récent
+		{"rattrapage", friday.Add(-72 * time.Hour), friday.Add(70 * time.Hour), friday},
+		{"jamais exécuté", time.Time{}, friday.Add(time.Hour), friday},
+	}
+	for _, tt := range tests {
+		if got := dueSlot(schedule, tt.last, tt.now); !got.Equal(tt.want) {
+			t.Errorf("%s: dueSlot() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDueSlotDaylightSaving(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("Europe/Paris time zone unavailable: %v", err)
+	}
+	schedule, err := common.ParseSchedule("30 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC).In(paris)
+	}
+
+	tests := []struct {
+		name      string
+		last, now time.Time
+		want      time.Time
+	}{
+		// 02:30 n'existe pas le 31 mars: la sauvegarde a lieu au changement d'heure, à 03:00
+		{"heure sautée", utc(3, 30, 1, 30), utc(3, 31, 1, 0), utc(3, 31, 1, 0)},
+		// 02:30 a lieu deux fois le 27 octobre: une seule sauvegarde
+		{"heure répétée", utc(10, 27, 0, 30), utc(10, 27, 1, 45), time.Time{}},
+		// Le créneau enregistré en UTC est comparé en heure murale
+		{"état enregistré en UTC", utc(10, 27, 0, 30).UTC(), utc(10, 27, 1, 45), time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := dueSlot(schedule, tt.last, tt.now); !got.Equal(tt.want) {
+			t.Errorf("%s: dueSlot() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStatePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), StateFileName)
+	slot := time.Date(2024, 10, 4, 18, 0, 0, 0, time.Local)
+	if err := loadState(path).record("docs", slot); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadState(path).lastRun("docs"); !got.Equal(slot) {
+		t.Errorf("lastRun() after reload = %v, want %v", got, slot)
+	}
+	if got := loadState(filepath.Join(t.TempDir(), "missing.json")).lastRun("docs"); !got.IsZero() {
+		t.Errorf("lastRun() without state = %v, want zero", got)
+	}
+}
@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// StateFileName est le nom du fichier d'état du démon dans le répertoire de configuration
+const StateFileName = "daemon-state.json"
+
+// state conserve, d'un démarrage à l'autre, le dernier créneau planifié exécuté par configuration
+type state struct {
+	path string // Fichier d'état, vide pour ne rien enregistrer
+
+	mu       sync.Mutex
+	LastRuns map[string]time.Time `json:"lastRuns"`
+}
+
+// loadState lit le fichier d'état. Un fichier absent donne un état vide; un fichier illisible
+// est signalé et ignoré, les créneaux manqués étant alors déduits des sauvegardes existantes.
+func loadState(path string) *state {
+	s := &state{path: path, LastRuns: make(map[string]time.Time)}
+	if path == "" {
+		return s
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			common.LogWarning("Impossible de lire l'état du démon %s: %v", path, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		common.LogWarning("État du démon %s illisible, ignoré: %v", path, err)
+	}
+	if s.LastRuns == nil {
+		s.LastRuns = make(map[string]time.Time)
+	}
+	return s
+}
+
+// lastRun renvoie le dernier créneau exécuté pour une configuration (zéro si aucun)
+func (s *state) lastRun(name string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.LastRuns[name]
+}
+
+// record enregistre le dernier créneau exécuté pour une configuration
+func (s *state) record(name string, slot time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LastRuns[name] = slot
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Écriture dans un fichier temporaire renommé, pour ne jamais laisser d'état tronqué
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".daemon-state-*")
+	if err != nil {
+		return fmt.Errorf("impossible d'enregistrer l'état du démon: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("impossible d'enregistrer l'état du démon: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("impossible d'enregistrer l'état du démon: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("impossible d'enregistrer l'état du démon: %w", err)
+	}
+	return nil
+}
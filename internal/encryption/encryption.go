@@ -0,0 +1,332 @@
+// Package encryption fournit le chiffrement authentifié des sauvegardes au repos.
+//
+// Une clé AES-256 est dérivée de la phrase secrète avec Argon2id. Les données sont
+// chiffrées en AES-256-GCM par segments de 64 Kio: chaque segment a son propre nonce,
+// construit à partir d'un préfixe aléatoire, d'un compteur et d'un indicateur de dernier
+// segment, ce qui détecte toute modification, réorganisation ou troncature du flux.
+//
+// Format d'un fichier chiffré:
+//
+//	magic (8) | sel (16) | temps Argon2 (4) | mémoire Argon2 en Kio (4) | threads (1) | préfixe de nonce (7)
+//	segment chiffré 1 | segment chiffré 2 | ... | dernier segment (éventuellement vide)
+//
+// L'en-tête complet est authentifié comme donnée associée de chaque segment.
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	magic         = "S4V3ENC1"
+	saltSize      = 16
+	prefixSize    = 7
+	headerSize    = len(magic) + saltSize + 4 + 4 + 1 + prefixSize
+	segmentSize   = 64 * 1024
+	keySize       = 32
+	argonTime     = 3
+	argonMemory   = 64 * 1024 // Kio
+	argonThreads  = 4
+	maxArgonTime  = 16
+	maxArgonMemMB = 1024
+)
+
+// Extension est ajoutée au nom des archives chiffrées
+const Extension = ".enc"
+
+// ErrAuthentication est renvoyée lorsque des données chiffrées ont été altérées
+// ou que la phrase secrète est incorrecte.
+var ErrAuthentication = errors.New("échec de l'authentification des données chiffrées (phrase secrète incorrecte ou données altérées)")
+
+// kdfParams regroupe le sel et les paramètres Argon2id d'une clé
+type kdfParams struct {
+	salt    [saltSize]byte
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// Key est une clé de chiffrement dérivée d'une phrase secrète.
+// Une même clé (et donc un même sel) est utilisée pour tous les fichiers d'une sauvegarde,
+// afin de ne payer la dérivation qu'une seule fois.
+type Key struct {
+	params kdfParams
+	aead   cipher.AEAD
+}
+
+// NewKey dérive une nouvelle clé avec un sel aléatoire
+func NewKey(passphrase string) (*Key, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("phrase secrète vide")
+	}
+	params := kdfParams{time: argonTime, memory: argonMemory, threads: argonThreads}
+	if _, err := io.ReadFull(rand.Reader, params.salt[:]); err != nil {
+		return nil, fmt.Errorf("impossible de générer le sel: %w", err)
+	}
+	return deriveKey(passphrase, params)
+}
+
+// deriveKey dérive la clé AES correspondant aux paramètres
+func deriveKey(passphrase string, params kdfParams) (*Key, error) {
+	raw := argon2.IDKey([]byte(passphrase), params.salt[:], params.time, params.memory, params.threads, keySize)
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{params: params, aead: aead}, nil
+}
+
+// Keyring dérive et mémorise les clés nécessaires au déchiffrement.
+// Les fichiers d'une même sauvegarde partageant le même sel, la dérivation n'est faite qu'une fois.
+type Keyring struct {
+	passphrase string
+	mu         sync.Mutex
+	keys       map[kdfParams]*Key
+}
+
+// NewKeyring crée un trousseau pour déchiffrer avec une phrase secrète
+func NewKeyring(passphrase string) (*Keyring, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("phrase secrète vide")
+	}
+	return &Keyring{passphrase: passphrase, keys: make(map[kdfParams]*Key)}, nil
+}
+
+// key renvoie la clé correspondant aux paramètres, en la dérivant si nécessaire
+func (kr *Keyring) key(params kdfParams) (*Key, error) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if k, ok := kr.keys[params]; ok {
+		return k, nil
+	}
+	// SECURITY: borner les paramètres lus dans un fichier pour éviter un épuisement mémoire
+	if params.time == 0 || params.time > maxArgonTime || params.memory == 0 || params.memory > maxArgonMemMB*1024 || params.threads == 0 {
+		return nil, fmt.Errorf("paramètres de dérivation de clé invalides")
+	}
+	k, err := deriveKey(kr.passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+	kr.keys[params] = k
+	return k, nil
+}
+
+// nonce construit le nonce d'un segment
+func nonce(prefix []byte, counter uint32, last bool) []byte {
+	n := make([]byte, 12)
+	copy(n, prefix)
+	binary.BigEndian.PutUint32(n[prefixSize:], counter)
+	if last {
+		n[11] = 1
+	}
+	return n
+}
+
+// writer chiffre un flux segment par segment
+type writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	closed  bool
+}
+
+// NewWriter renvoie un flux qui chiffre vers w. Close doit être appelé pour écrire
+// le dernier segment; il ne ferme pas w.
+func (k *Key) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, k.params.salt[:]...)
+	var params [9]byte
+	binary.BigEndian.PutUint32(params[0:4], k.params.time)
+	binary.BigEndian.PutUint32(params[4:8], k.params.memory)
+	params[8] = k.params.threads
+	header = append(header, params[:]...)
+	prefix := make([]byte, prefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, fmt.Errorf("impossible de générer le nonce: %w", err)
+	}
+	header = append(header, prefix...)
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &writer{
+		w:      w,
+		aead:   k.aead,
+		header: header,
+		prefix: prefix,
+		buf:    make([]byte, 0, segmentSize),
+	}, nil
+}
+
+// Write chiffre les segments complets au fur et à mesure
+func (cw *writer) Write(p []byte) (int, error) {
+	if cw.closed {
+		return 0, fmt.Errorf("écriture dans un flux chiffré fermé")
+	}
+	written := 0
+	for len(p) > 0 {
+		// Un segment plein n'est émis que lorsqu'on sait qu'il n'est pas le dernier
+		if len(cw.buf) == segmentSize {
+			if err := cw.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(cw.buf[len(cw.buf):segmentSize], p)
+		cw.buf = cw.buf[:len(cw.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// flush chiffre et écrit le segment en attente
+func (cw *writer) flush(last bool) error {
+	if cw.counter == ^uint32(0) {
+		return fmt.Errorf("flux chiffré trop volumineux")
+	}
+	sealed := cw.aead.Seal(nil, nonce(cw.prefix, cw.counter, last), cw.buf, cw.header)
+	cw.counter++
+	cw.buf = cw.buf[:0]
+	_, err := cw.w.Write(sealed)
+	return err
+}
+
+// Close écrit le dernier segment
+func (cw *writer) Close() error {
+	if cw.closed {
+		return nil
+	}
+	cw.closed = true
+	return cw.flush(true)
+}
+
+// reader déchiffre un flux segment par segment
+type reader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+	sealed  []byte
+	plain   []byte
+	done    bool
+}
+
+// NewReader renvoie un flux qui déchiffre r. Une erreur est renvoyée par Read si les
+// données ont été altérées ou tronquées.
+func (kr *Keyring) NewReader(r io.Reader) (io.Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("en-tête de chiffrement illisible: %w", err)
+	}
+	if !bytes.Equal(header[:len(magic)], []byte(magic)) {
+		return nil, fmt.Errorf("données non chiffrées ou format de chiffrement inconnu")
+	}
+
+	var params kdfParams
+	off := len(magic)
+	copy(params.salt[:], header[off:off+saltSize])
+	off += saltSize
+	params.time = binary.BigEndian.Uint32(header[off:])
+	off += 4
+	params.memory = binary.BigEndian.Uint32(header[off:])
+	off += 4
+	params.threads = header[off]
+	off++
+
+	k, err := kr.key(params)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{
+		r:      bufio.NewReaderSize(r, segmentSize+k.aead.Overhead()+1),
+		aead:   k.aead,
+		header: header,
+		prefix: header[off : off+prefixSize],
+		sealed: make([]byte, segmentSize+k.aead.Overhead()),
+	}, nil
+}
+
+// Read renvoie les données déchiffrées
+func (cr *reader) Read(p []byte) (int, error) {
+	for len(cr.plain) == 0 {
+		if cr.done {
+			return 0, io.EOF
+		}
+		if err := cr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, cr.plain)
+	cr.plain = cr.plain[n:]
+	return n, nil
+}
+
+// next lit et authentifie le segment suivant
+func (cr *reader) next() error {
+	n, err := io.ReadFull(cr.r, cr.sealed)
+	if err == io.EOF {
+		return fmt.Errorf("flux chiffré tronqué: %w", ErrAuthentication)
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	// Le segment est le dernier s'il est incomplet ou si rien ne le suit
+	last := err == io.ErrUnexpectedEOF
+	if !last {
+		if _, perr := cr.r.Peek(1); perr == io.EOF {
+			last = true
+		} else if perr != nil {
+			return perr
+		}
+	}
+
+	plain, err := cr.aead.Open(cr.sealed[:0], nonce(cr.prefix, cr.counter, last), cr.sealed[:n], cr.header)
+	if err != nil {
+		return ErrAuthentication
+	}
+	cr.counter++
+	cr.plain = plain
+	cr.done = last
+	return nil
+}
+
+// IsEncrypted indique si r commence par un en-tête de chiffrement
+func IsEncrypted(r io.Reader) bool {
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, head); err != nil {
+		return false
+	}
+	return bytes.Equal(head, []byte(magic))
+}
+
+// PlaintextSize renvoie la taille des données claires d'un flux chiffré de taille size,
+// sans le déchiffrer
+func PlaintextSize(size int64) int64 {
+	const tagSize = 16 // Authentification AES-GCM de chaque segment
+	body := size - int64(headerSize)
+	if body < tagSize {
+		return 0
+	}
+	segments := (body + segmentSize + tagSize - 1) / (segmentSize + tagSize)
+	return body - segments*tagSize
+}
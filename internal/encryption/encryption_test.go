@@ -0,0 +1,153 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encrypt(t *testing.T, k *Key, plain []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := k.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(kr *Keyring, sealed []byte) ([]byte, error) {
+	r, err := kr.NewReader(bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncryptionRoundTripAndTampering(t *testing.T) {
+	key, err := NewKey("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("NewKey failed: %v", err)
+	}
+	keyring, err := NewKeyring("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+
+	for _, size := range []int{0, 10, segmentSize, segmentSize + 1, 3*segmentSize + 17} {
+		plain := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(plain)
+
+		sealed := encrypt(t, key, plain)
+		if got := PlaintextSize(int64(len(sealed))); got != int64(size) {
+			t.Errorf("PlaintextSize(%d) = %d, want %d", len(sealed), got, size)
+		}
+		got, err := decrypt(keyring, sealed)
+		if err != nil {
+			t.Fatalf("Decrypt of %d bytes failed: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("Decrypted content of %d bytes doesn't match", size)
+		}
+	}
+
+	sealed := encrypt(t, key, bytes.Repeat([]byte("backup"), segmentSize))
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[headerSize+100] ^= 1
+	if _, err := decrypt(keyring, tampered); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("Expected authentication error for tampered data, got %v", err)
+	}
+
+	// Troncature exactement à la fin d'un segment
+	truncated := sealed[:headerSize+segmentSize+key.aead.Overhead()]
+	if _, err := decrypt(keyring, truncated); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("Expected authentication error for truncated data, got %v", err)
+	}
+
+	wrong, err := NewKeyring("wrong passphrase")
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+	if _, err := decrypt(wrong, sealed); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("Expected authentication error for wrong passphrase, got %v", err)
+	}
+}
+
+func TestEncryptTreeNeverWritesPlaintext(t *testing.T) {
+	key, err := NewKey("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("NewKey failed: %v", err)
+	}
+	keyring, err := NewKeyring("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	secret := []byte("very secret plaintext")
+	files := map[string][]byte{
+		"secret.txt":     secret,
+		"sub/nested.txt": secret,
+		"cache/skip.txt": secret,
+	}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("secret.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(root, "dst")
+	skip := func(rel string, isDir bool) bool { return rel == "cache" }
+	recorded := make(map[string]string)
+	record := func(rel string, info os.FileInfo, target, sum string) { recorded[rel] = sum + target }
+	if err := key.EncryptTree(src, dst, skip, nil, record); err != nil {
+		t.Fatalf("EncryptTree failed: %v", err)
+	}
+
+	// Aucun fichier de la destination ne contient le texte en clair
+	filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		content, _ := os.ReadFile(path)
+		if bytes.Contains(content, secret) {
+			t.Errorf("Plaintext found in %s", path)
+		}
+		return nil
+	})
+	if _, err := os.Stat(filepath.Join(dst, "cache")); !os.IsNotExist(err) {
+		t.Errorf("Skipped directory was copied")
+	}
+	if len(recorded) != 3 || recorded["link"] != "secret.txt" || recorded["secret.txt"] == "" {
+		t.Errorf("Unexpected recorded entries: %v", recorded)
+	}
+
+	restored := filepath.Join(root, "restored")
+	if err := keyring.DecryptTree(dst, restored); err != nil {
+		t.Fatalf("DecryptTree failed: %v", err)
+	}
+	for _, name := range []string{"secret.txt", "sub/nested.txt"} {
+		if content, err := os.ReadFile(filepath.Join(restored, name)); err != nil || !bytes.Equal(content, secret) {
+			t.Errorf("Round trip of %s failed: %q (%v)", name, content, err)
+		}
+	}
+}
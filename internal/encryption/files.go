@@ -0,0 +1,245 @@
+package encryption
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// EncryptTree recopie l'arborescence src vers dst en chiffrant les fichiers réguliers au fil
+// de la lecture: aucun contenu en clair n'est jamais écrit dans dst. Répertoires et liens
+// symboliques sont recréés à l'identique. skip, si non nil, exclut un élément (et le contenu
+// d'un répertoire); reuse, si non nil, désigne pour un fichier inchangé sa version déjà chiffrée
+// (avec l'empreinte de son contenu), reprise par lien physique au lieu d'être chiffrée à nouveau;
+// record, si non nil, reçoit chaque élément copié avec, pour un fichier, l'empreinte SHA-256 de
+// son contenu en clair.
+func (k *Key) EncryptTree(src, dst string, skip func(rel string, isDir bool) bool, reuse func(rel string, info os.FileInfo) (path, sum string), record func(rel string, info os.FileInfo, target, sum string)) error {
+	type dirTimes struct {
+		path string
+		info os.FileInfo
+	}
+	var dirs []dirTimes
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." && skip != nil && skip(filepath.ToSlash(rel), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirTimes{path: target, info: info})
+			return nil
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+			if record != nil {
+				record(filepath.ToSlash(rel), info, link, "")
+			}
+		case info.Mode().IsRegular():
+			var sum string
+			if reuse != nil {
+				if previous, previousSum := reuse(filepath.ToSlash(rel), info); previous != "" {
+					os.Remove(target)
+					// Un lien impossible (autre système de fichiers) retombe sur le chiffrement
+					if os.Link(previous, target) == nil {
+						sum = previousSum
+					}
+				}
+			}
+			if sum == "" {
+				if sum, err = k.encryptFile(path, target, info); err != nil {
+					return fmt.Errorf("impossible de chiffrer %s: %w", path, err)
+				}
+			}
+			if record != nil {
+				record(filepath.ToSlash(rel), info, "", sum)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Appliquer permissions et dates des répertoires une fois leur contenu écrit
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Chmod(dirs[i].path, dirs[i].info.Mode().Perm())
+		os.Chtimes(dirs[i].path, dirs[i].info.ModTime(), dirs[i].info.ModTime())
+	}
+	return nil
+}
+
+// encryptFile chiffre src vers dst en conservant permissions et date de modification,
+// et renvoie l'empreinte SHA-256 hexadécimale du contenu en clair
+func (k *Key) encryptFile(src, dst string, info os.FileInfo) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	h := sha256.New()
+	err = writeAtomic(dst, info, func(out io.Writer) error {
+		w, err := k.NewWriter(out)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, io.TeeReader(in, h)); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DecryptFile déchiffre src vers dst en conservant permissions et date de modification
+func (kr *Keyring) DecryptFile(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeAtomic(dst, info, func(out io.Writer) error {
+		r, err := kr.NewReader(in)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, r)
+		return err
+	})
+}
+
+// OpenFile ouvre un fichier chiffré et renvoie un flux de son contenu en clair
+func (kr *Keyring) OpenFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := kr.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return decryptedFile{Reader: r, file: file}, nil
+}
+
+// decryptedFile associe un flux déchiffré au fichier à fermer
+type decryptedFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (d decryptedFile) Close() error {
+	return d.file.Close()
+}
+
+// DecryptTree recopie l'arborescence src vers dst en déchiffrant les fichiers réguliers.
+// Répertoires et liens symboliques sont recréés à l'identique.
+func (kr *Keyring) DecryptTree(src, dst string) error {
+	type dirTimes struct {
+		path string
+		info os.FileInfo
+	}
+	var dirs []dirTimes
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirTimes{path: target, info: info})
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			if err := kr.DecryptFile(path, target); err != nil {
+				return fmt.Errorf("impossible de déchiffrer %s: %w", path, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Appliquer permissions et dates des répertoires une fois leur contenu écrit
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Chmod(dirs[i].path, dirs[i].info.Mode().Perm())
+		os.Chtimes(dirs[i].path, dirs[i].info.ModTime(), dirs[i].info.ModTime())
+	}
+	return nil
+}
+
+// writeAtomic écrit dst via un fichier temporaire renommé à la fin, puis applique
+// les permissions et la date de modification de info.
+func writeAtomic(dst string, info os.FileInfo, fill func(out io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".saveme-crypt-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	err = fill(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, info.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Chtimes(tmpPath, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, dst)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
@@ -0,0 +1,255 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+const (
+	// Extension est l'extension des fichiers de journal
+	Extension = ".journal"
+	// MaxPaths est le nombre maximal de chemins enregistrés entre deux sauvegardes: au-delà,
+	// le journal est abandonné et la sauvegarde suivante analyse toute la source
+	MaxPaths = 100000
+)
+
+// Types d'enregistrements du fichier de journal, chacun suivi d'un chemin et d'un caractère NULL
+const (
+	recordBase = 'B' // Sauvegarde au début de laquelle le journal a été ouvert
+	recordPath = 'P' // Chemin modifié
+	recordTree = 'T' // Répertoire dont tout le contenu est à relire
+)
+
+// Change est un chemin modifié, relatif à la source
+type Change struct {
+	Path string
+	// Tree indique que tout le contenu du répertoire est à relire (répertoire créé ou renommé)
+	Tree bool
+}
+
+// Journal enregistre les chemins modifiés d'une configuration depuis le début de sa dernière
+// sauvegarde. Il n'est exploitable que si la surveillance a fonctionné sans interruption
+// depuis: il est vidé au démarrage et à l'arrêt de la surveillance, ainsi qu'en cas de perte
+// d'événements. Un journal nil n'enregistre rien.
+type Journal struct {
+	path string
+
+	mu     sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	active bool            // La surveillance est en cours
+	base   string          // Sauvegarde ouvrant le journal, vide si les modifications ne sont pas relevées
+	seen   map[Change]bool // Chemins déjà enregistrés
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Journal)
+)
+
+// For renvoie le journal d'une configuration, enregistré dans le répertoire de configuration
+// et partagé dans le processus entre la surveillance et les sauvegardes
+func For(name string) (*Journal, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if j, ok := registry[name]; ok {
+		return j, nil
+	}
+	configDir, err := common.GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	j := New(filepath.Join(configDir, "journals", name+Extension))
+	registry[name] = j
+	return j, nil
+}
+
+// New crée un journal enregistré dans le fichier path
+func New(path string) *Journal {
+	return &Journal{path: path, seen: make(map[Change]bool)}
+}
+
+// Start signale le démarrage de la surveillance. Les modifications antérieures sont inconnues:
+// le journal ne servira qu'à partir de la prochaine sauvegarde.
+func (j *Journal) Start() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.active = true
+	return j.reset("")
+}
+
+// Stop signale l'arrêt de la surveillance et supprime le journal
+func (j *Journal) Stop() {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.active = false
+	j.close()
+	j.base = ""
+	j.seen = make(map[Change]bool)
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		common.LogWarning("Impossible de supprimer le journal %s: %v", j.path, err)
+	}
+}
+
+// Invalidate abandonne le journal après une perte d'événements: la prochaine sauvegarde
+// analysera toute la source
+func (j *Journal) Invalidate() {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.active || j.base == "" {
+		return
+	}
+	common.LogWarning("Journal des modifications %s abandonné: la prochaine sauvegarde analysera toute la source.", j.path)
+	if err := j.reset(""); err != nil {
+		common.LogWarning("%v", err)
+	}
+}
+
+// Record enregistre un chemin modifié
+func (j *Journal) Record(change Change) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.active || j.base == "" || j.seen[change] {
+		return
+	}
+	if len(j.seen) >= MaxPaths {
+		common.LogWarning("Plus de %d chemins modifiés depuis la dernière sauvegarde: journal %s abandonné.", MaxPaths, j.path)
+		if err := j.reset(""); err != nil {
+			common.LogWarning("%v", err)
+		}
+		return
+	}
+	kind := byte(recordPath)
+	if change.Tree {
+		kind = recordTree
+	}
+	if err := j.write(kind, change.Path); err != nil {
+		common.LogWarning("Écriture impossible dans le journal %s, abandonné: %v", j.path, err)
+		j.reset("")
+		return
+	}
+	j.seen[change] = true
+}
+
+// Begin est appelée au début de la sauvegarde backupID, basée sur la sauvegarde parentID. Elle
+// renvoie les chemins modifiés depuis le début de parentID, ou false si le journal ne les couvre
+// pas tous (surveillance interrompue, événements perdus, autre sauvegarde parente). Le journal
+// relève ensuite les modifications depuis le début de backupID.
+func (j *Journal) Begin(backupID, parentID string) ([]Change, bool) {
+	if j == nil {
+		return nil, false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.active {
+		return nil, false
+	}
+
+	var changes []Change
+	ok := false
+	if parentID != "" && j.base == parentID {
+		var err error
+		if changes, err = j.read(); err != nil {
+			common.LogWarning("Journal des modifications %s inutilisable: %v", j.path, err)
+		} else {
+			ok = true
+		}
+	}
+	if err := j.reset(backupID); err != nil {
+		common.LogWarning("%v", err)
+		j.reset("")
+	}
+	return changes, ok
+}
+
+// read relit les chemins enregistrés dans le fichier de journal
+func (j *Journal) read() ([]Change, error) {
+	if err := j.w.Flush(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return nil, err
+	}
+	records := bytes.Split(data, []byte{0})
+	if len(records) < 2 || string(records[0]) != string(recordBase)+j.base {
+		return nil, fmt.Errorf("sauvegarde de départ absente")
+	}
+	var changes []Change
+	for _, record := range records[1 : len(records)-1] {
+		if len(record) < 2 {
+			return nil, fmt.Errorf("enregistrement invalide")
+		}
+		switch record[0] {
+		case recordPath:
+			changes = append(changes, Change{Path: string(record[1:])})
+		case recordTree:
+			changes = append(changes, Change{Path: string(record[1:]), Tree: true})
+		default:
+			return nil, fmt.Errorf("enregistrement inconnu: %q", record[0])
+		}
+	}
+	return changes, nil
+}
+
+// reset vide le fichier de journal et l'ouvre à partir du début de la sauvegarde base
+// (vide: les modifications ne sont plus relevées)
+func (j *Journal) reset(base string) error {
+	j.close()
+	j.base = ""
+	j.seen = make(map[Change]bool)
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return fmt.Errorf("impossible de créer le journal %s: %w", j.path, err)
+	}
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("impossible de créer le journal %s: %w", j.path, err)
+	}
+	j.file, j.w = file, bufio.NewWriter(file)
+	if base == "" {
+		return nil
+	}
+	if err := j.write(recordBase, base); err != nil {
+		return fmt.Errorf("impossible d'écrire le journal %s: %w", j.path, err)
+	}
+	j.base = base
+	return nil
+}
+
+// write ajoute un enregistrement au fichier de journal
+func (j *Journal) write(kind byte, value string) error {
+	if j.w == nil {
+		return fmt.Errorf("journal fermé")
+	}
+	j.w.WriteByte(kind)
+	j.w.WriteString(value)
+	return j.w.WriteByte(0)
+}
+
+// close ferme le fichier de journal
+func (j *Journal) close() {
+	if j.file == nil {
+		return
+	}
+	j.w.Flush()
+	j.file.Close()
+	j.file, j.w = nil, nil
+}
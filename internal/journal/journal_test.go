@@ -0,0 +1,88 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJournalCoversChangesSinceParent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journals", "docs"+Extension)
+	j := New(path)
+
+	// Surveillance non démarrée: rien n'est relevé
+	if _, ok := j.Begin("b0", ""); ok {
+		t.Fatal("Journal usable before the watcher started")
+	}
+	if err := j.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	// Aucune sauvegarde de départ: les modifications ne sont pas encore relevées
+	j.Record(Change{Path: "early.txt"})
+	if _, ok := j.Begin("b1", ""); ok {
+		t.Fatal("Journal usable for a backup without parent")
+	}
+
+	j.Record(Change{Path: "a file.txt"})
+	j.Record(Change{Path: "new dir", Tree: true})
+	j.Record(Change{Path: "a file.txt"})
+	changes, ok := j.Begin("b2", "b1")
+	want := []Change{{Path: "a file.txt"}, {Path: "new dir", Tree: true}}
+	if !ok || !reflect.DeepEqual(changes, want) {
+		t.Fatalf("Expected %v, got %v (usable: %t)", want, changes, ok)
+	}
+
+	// Autre sauvegarde parente (échec de b2 par exemple): analyse complète
+	j.Record(Change{Path: "b.txt"})
+	if _, ok := j.Begin("b3", "b1"); ok {
+		t.Error("Journal usable for another parent backup")
+	}
+
+	// Perte d'événements
+	j.Record(Change{Path: "c.txt"})
+	j.Invalidate()
+	if _, ok := j.Begin("b4", "b3"); ok {
+		t.Error("Journal usable after lost events")
+	}
+	if changes, ok := j.Begin("b5", "b4"); !ok || len(changes) != 0 {
+		t.Errorf("Expected an empty usable journal, got %v (usable: %t)", changes, ok)
+	}
+
+	j.Stop()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Journal file kept after Stop: %v", err)
+	}
+	if _, ok := j.Begin("b6", "b5"); ok {
+		t.Error("Journal usable after the watcher stopped")
+	}
+}
+
+func TestJournalOverflow(t *testing.T) {
+	j := New(filepath.Join(t.TempDir(), "big"+Extension))
+	if err := j.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer j.Stop()
+	j.Begin("b1", "")
+	for i := 0; i <= MaxPaths; i++ {
+		j.Record(Change{Path: fmt.Sprintf("file-%d", i)})
+	}
+	if _, ok := j.Begin("b2", "b1"); ok {
+		t.Error("Journal usable after too many changes")
+	}
+}
+
+func TestNilJournal(t *testing.T) {
+	var j *Journal
+	if err := j.Start(); err != nil {
+		t.Errorf("Start on nil journal: %v", err)
+	}
+	j.Record(Change{Path: "a"})
+	j.Invalidate()
+	if _, ok := j.Begin("b1", "b0"); ok {
+		t.Error("Nil journal reported as usable")
+	}
+	j.Stop()
+}
@@ -0,0 +1,269 @@
+// Package manifest décrit le contenu attendu d'une sauvegarde (chemins, tailles, permissions,
+// dates et empreintes SHA-256) et permet de vérifier qu'une sauvegarde est toujours intacte.
+package manifest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/internal/encryption"
+)
+
+// manifestVersion est la version du format de manifeste
+const manifestVersion = 1
+
+// Extension est le suffixe des fichiers de manifeste, écrits à côté de la sauvegarde
+const Extension = ".manifest.json"
+
+// Types d'entrées d'un manifeste
+const (
+	EntryFile    = "file"
+	EntrySymlink = "symlink"
+)
+
+// Entry décrit un fichier ou un lien symbolique de la sauvegarde
+type Entry struct {
+	Path    string      `json:"path"`
+	Type    string      `json:"type"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	SHA256  string      `json:"sha256,omitempty"`
+	Target  string      `json:"target,omitempty"` // Cible d'un lien symbolique
+}
+
+// Manifest liste le contenu d'une sauvegarde
+type Manifest struct {
+	Version  int       `json:"version"`
+	BackupID string    `json:"backupId"`
+	Created  time.Time `json:"created"`
+	Entries  []Entry   `json:"entries"`
+}
+
+// EntryFunc est appelée pour chaque élément du contenu d'une sauvegarde. rel est le chemin
+// relatif avec des slashes, target la cible d'un lien symbolique et content le contenu
+// d'un fichier régulier (nil pour les autres types).
+type EntryFunc func(rel string, info os.FileInfo, target string, content io.Reader) error
+
+// WalkFunc parcourt le contenu d'une sauvegarde en appelant fn pour chaque élément
+type WalkFunc func(fn EntryFunc) error
+
+// New crée un manifeste vide pour une sauvegarde
+func New(backupID string) *Manifest {
+	return &Manifest{Version: manifestVersion, BackupID: backupID, Created: time.Now()}
+}
+
+// Add ajoute un élément au manifeste. sum est l'empreinte SHA-256 hexadécimale du contenu
+// d'un fichier régulier. Les répertoires et fichiers spéciaux sont ignorés.
+func (m *Manifest) Add(rel string, info os.FileInfo, target, sum string) {
+	entry, ok := newEntry(rel, info, target)
+	if !ok {
+		return
+	}
+	entry.SHA256 = sum
+	m.Entries = append(m.Entries, entry)
+}
+
+// AddContent ajoute un élément au manifeste en calculant l'empreinte de son contenu.
+// La taille enregistrée est celle du contenu lu, qui peut différer de info.Size()
+// pour un fichier chiffré.
+func (m *Manifest) AddContent(rel string, info os.FileInfo, target string, content io.Reader) error {
+	entry, err := readEntry(rel, info, target, content)
+	if err != nil || entry == nil {
+		return err
+	}
+	m.Entries = append(m.Entries, *entry)
+	return nil
+}
+
+// Build crée le manifeste d'une sauvegarde à partir de son contenu. Avec le manifeste
+// d'une sauvegarde précédente, les fichiers dont la taille, les permissions et la date
+// n'ont pas changé reprennent leur empreinte sans être relus, comme le fait rsync.
+func Build(backupID string, walk WalkFunc, previous *Manifest) (*Manifest, error) {
+	m := New(backupID)
+	known := make(map[string]Entry)
+	if previous != nil {
+		for _, e := range previous.Entries {
+			known[e.Path] = e
+		}
+	}
+
+	err := walk(func(rel string, info os.FileInfo, target string, content io.Reader) error {
+		if prev, ok := known[rel]; ok && prev.Unchanged(info) {
+			m.Entries = append(m.Entries, prev)
+			return nil
+		}
+		return m.AddContent(rel, info, target, content)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Save écrit le manifeste. Avec une clé, le manifeste est chiffré: il révélerait sinon
+// les noms et empreintes des fichiers d'une sauvegarde chiffrée.
+func (m *Manifest) Save(path string, key *encryption.Key) error {
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Path < m.Entries[j].Path })
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".saveme-manifest-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if key != nil {
+		var w io.WriteCloser
+		if w, err = key.NewWriter(tmp); err == nil {
+			if _, err = w.Write(data); err == nil {
+				err = w.Close()
+			}
+		}
+	} else {
+		_, err = tmp.Write(data)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("impossible d'écrire le manifeste %s: %w", path, err)
+	}
+	return nil
+}
+
+// Load lit un manifeste, en le déchiffrant si nécessaire avec keyring
+func Load(path string, keyring *encryption.Keyring) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("impossible de lire le manifeste %s: %w", path, err)
+	}
+	if encryption.IsEncrypted(bytes.NewReader(data)) {
+		if keyring == nil {
+			return nil, fmt.Errorf("le manifeste %s est chiffré: phrase secrète requise", path)
+		}
+		r, err := keyring.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("impossible de déchiffrer le manifeste %s: %w", path, err)
+		}
+		if data, err = io.ReadAll(r); err != nil {
+			return nil, fmt.Errorf("impossible de déchiffrer le manifeste %s: %w", path, err)
+		}
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("manifeste %s invalide: %w", path, err)
+	}
+	if m.Version > manifestVersion {
+		return nil, fmt.Errorf("version de manifeste non prise en charge: %d", m.Version)
+	}
+	return &m, nil
+}
+
+// WalkDir parcourt une sauvegarde stockée sous forme de répertoire. open permet de
+// transformer le contenu des fichiers (déchiffrement); nil lit les fichiers tels quels.
+func WalkDir(root string, open func(path string) (io.ReadCloser, error)) WalkFunc {
+	if open == nil {
+		open = func(path string) (io.ReadCloser, error) { return os.Open(path) }
+	}
+	return func(fn EntryFunc) error {
+		return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			switch {
+			case info.Mode()&os.ModeSymlink != 0:
+				target, err := os.Readlink(path)
+				if err != nil {
+					return err
+				}
+				return fn(rel, info, target, nil)
+			case info.Mode().IsRegular():
+				rc, err := open(path)
+				if err != nil {
+					// L'erreur est transmise via le contenu pour être signalée sur ce fichier
+					return fn(rel, info, "", errReader{err})
+				}
+				defer rc.Close()
+				return fn(rel, info, "", rc)
+			}
+			return nil
+		})
+	}
+}
+
+// Unchanged indique si le fichier régulier décrit par info a la taille, les permissions et la
+// date de l'entrée, et peut donc reprendre son empreinte sans être relu
+func (e Entry) Unchanged(info os.FileInfo) bool {
+	return e.Type == EntryFile && info.Mode().IsRegular() &&
+		e.Size == info.Size() && e.Mode == info.Mode().Perm() && e.ModTime.Equal(info.ModTime())
+}
+
+// newEntry crée l'entrée correspondant à un élément, ou renvoie false s'il n'est pas suivi
+func newEntry(rel string, info os.FileInfo, target string) (Entry, bool) {
+	entry := Entry{
+		Path:    rel,
+		Mode:    info.Mode().Perm(),
+		ModTime: info.ModTime(),
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		entry.Type = EntrySymlink
+		entry.Target = target
+	case info.Mode().IsRegular():
+		entry.Type = EntryFile
+		entry.Size = info.Size()
+	default:
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// readEntry crée l'entrée d'un élément en lisant son contenu, ou renvoie nil s'il n'est pas suivi
+func readEntry(rel string, info os.FileInfo, target string, content io.Reader) (*Entry, error) {
+	entry, ok := newEntry(rel, info, target)
+	if !ok {
+		return nil, nil
+	}
+	if content != nil && entry.Type == EntryFile {
+		h := sha256.New()
+		n, err := io.Copy(h, content)
+		if err != nil {
+			return nil, err
+		}
+		entry.Size = n
+		entry.SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	return &entry, nil
+}
+
+// errReader est un flux dont la lecture échoue toujours avec err
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,81 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyDetectsMissingCorruptedAndExtraFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "manifest_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	backupDir := filepath.Join(tempDir, "backup")
+	if err := os.MkdirAll(filepath.Join(backupDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create backup dir: %v", err)
+	}
+	files := map[string]string{
+		"keep.txt":     "unchanged",
+		"sub/gone.txt": "will be removed",
+		"sub/bad.txt":  "original content",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(backupDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	if err := os.Symlink("keep.txt", filepath.Join(backupDir, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	m, err := Build("test", WalkDir(backupDir, nil), nil)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	manifestPath := filepath.Join(tempDir, "backup"+Extension)
+	if err := m.Save(manifestPath, nil); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := Load(manifestPath, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded.Entries) != 4 {
+		t.Fatalf("Expected 4 entries, got %d", len(loaded.Entries))
+	}
+
+	report, err := Verify(loaded, WalkDir(backupDir, nil))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !report.OK() || report.Checked != 4 {
+		t.Fatalf("Expected intact backup with 4 checked entries, got %+v", report)
+	}
+
+	// Même taille, contenu différent
+	badPath := filepath.Join(backupDir, "sub", "bad.txt")
+	info, _ := os.Stat(badPath)
+	if err := os.WriteFile(badPath, []byte("tampered content"), 0644); err != nil {
+		t.Fatalf("Failed to tamper file: %v", err)
+	}
+	os.Chtimes(badPath, info.ModTime(), info.ModTime())
+	os.Remove(filepath.Join(backupDir, "sub", "gone.txt"))
+	os.WriteFile(filepath.Join(backupDir, "new.txt"), []byte("extra"), 0644)
+
+	report, err = Verify(loaded, WalkDir(backupDir, nil))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "sub/gone.txt" {
+		t.Errorf("Expected sub/gone.txt to be missing, got %v", report.Missing)
+	}
+	if len(report.Corrupted) != 1 || report.Corrupted[0].Path != "sub/bad.txt" {
+		t.Errorf("Expected sub/bad.txt to be corrupted, got %v", report.Corrupted)
+	}
+	if len(report.Extra) != 1 || report.Extra[0] != "new.txt" {
+		t.Errorf("Expected new.txt to be extra, got %v", report.Extra)
+	}
+}
@@ -0,0 +1,103 @@
+package manifest
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// Problem décrit un écart entre le manifeste et le contenu d'une sauvegarde
+type Problem struct {
+	Path   string
+	Reason string
+}
+
+// Report est le résultat de la vérification d'une sauvegarde
+type Report struct {
+	// Checked est le nombre d'éléments du manifeste retrouvés et contrôlés
+	Checked int
+	// Missing liste les éléments du manifeste absents de la sauvegarde
+	Missing []string
+	// Corrupted liste les éléments dont le contenu ou les attributs diffèrent du manifeste
+	Corrupted []Problem
+	// Extra liste les éléments présents dans la sauvegarde mais absents du manifeste
+	Extra []string
+}
+
+// OK indique si la sauvegarde correspond exactement au manifeste
+func (r Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Corrupted) == 0 && len(r.Extra) == 0
+}
+
+// Verify compare le contenu d'une sauvegarde à son manifeste. Une erreur de lecture
+// d'un élément (données chiffrées altérées, archive endommagée) est signalée comme
+// une corruption tant que le parcours peut continuer.
+func Verify(m *Manifest, walk WalkFunc) (Report, error) {
+	var report Report
+	expected := make(map[string]Entry, len(m.Entries))
+	for _, e := range m.Entries {
+		expected[e.Path] = e
+	}
+	seen := make(map[string]bool, len(m.Entries))
+
+	err := walk(func(rel string, info os.FileInfo, target string, content io.Reader) error {
+		actual, err := readEntry(rel, info, target, content)
+		want, known := expected[rel]
+		if err != nil {
+			if !known {
+				report.Extra = append(report.Extra, rel)
+				return nil
+			}
+			seen[rel] = true
+			report.Corrupted = append(report.Corrupted, Problem{Path: rel, Reason: fmt.Sprintf("lecture impossible: %v", err)})
+			return nil
+		}
+		if actual == nil {
+			return nil
+		}
+		if !known {
+			report.Extra = append(report.Extra, rel)
+			return nil
+		}
+		seen[rel] = true
+		report.Checked++
+		if reason := compare(want, *actual); reason != "" {
+			report.Corrupted = append(report.Corrupted, Problem{Path: rel, Reason: reason})
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for _, e := range m.Entries {
+		if !seen[e.Path] {
+			report.Missing = append(report.Missing, e.Path)
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Extra)
+	sort.Slice(report.Corrupted, func(i, j int) bool { return report.Corrupted[i].Path < report.Corrupted[j].Path })
+	return report, nil
+}
+
+// compare renvoie la raison d'un écart entre deux entrées, ou une chaîne vide
+func compare(want, got Entry) string {
+	switch {
+	case want.Type != got.Type:
+		return fmt.Sprintf("type %s au lieu de %s", got.Type, want.Type)
+	case want.Type == EntrySymlink && want.Target != got.Target:
+		return fmt.Sprintf("cible %s au lieu de %s", got.Target, want.Target)
+	case want.Size != got.Size:
+		return fmt.Sprintf("taille %d au lieu de %d", got.Size, want.Size)
+	case want.SHA256 != got.SHA256:
+		return "contenu modifié (empreinte SHA-256 différente)"
+	case want.Type == EntryFile && want.Mode != got.Mode:
+		return fmt.Sprintf("permissions %v au lieu de %v", got.Mode, want.Mode)
+	case want.Type == EntryFile && !want.ModTime.Truncate(time.Second).Equal(got.ModTime.Truncate(time.Second)):
+		return fmt.Sprintf("date de modification %s au lieu de %s", got.ModTime.Format(time.RFC3339), want.ModTime.Format(time.RFC3339))
+	}
+	return ""
+}
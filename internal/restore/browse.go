@@ -0,0 +1,154 @@
+package restore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// errStopWalk interrompt le parcours d'une sauvegarde une fois l'élément cherché trouvé
+var errStopWalk = errors.New("parcours terminé")
+
+// FileEntry décrit un fichier ou un lien symbolique contenu dans une sauvegarde
+type FileEntry struct {
+	Path    string      `json:"path"`
+	Mode    os.FileMode `json:"mode"`
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"modTime"`
+	Target  string      `json:"target,omitempty"` // Cible d'un lien symbolique
+}
+
+// ListFiles renvoie les fichiers de la sauvegarde situés sous dir (tous si dir est vide),
+// triés par chemin, sans extraire ni restaurer la sauvegarde
+func ListFiles(backupID, dir string) ([]FileEntry, error) {
+	info, err := findBackupByID(backupID)
+	if err != nil {
+		return nil, fmt.Errorf("impossible de trouver la sauvegarde: %w", err)
+	}
+	walk, err := WalkContent(info)
+	if err != nil {
+		return nil, err
+	}
+	dir = cleanBackupPath(dir)
+
+	var entries []FileEntry
+	err = walk(func(rel string, fi os.FileInfo, target string, content io.Reader) error {
+		if dir != "" && !isPathOrChild(rel, dir) {
+			return nil
+		}
+		entries = append(entries, FileEntry{Path: rel, Mode: fi.Mode(), Size: fi.Size(), ModTime: fi.ModTime(), Target: target})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("impossible de lire le contenu de la sauvegarde: %w", err)
+	}
+	if dir != "" && len(entries) == 0 {
+		return nil, fmt.Errorf("'%s' introuvable dans la sauvegarde %s", dir, backupID)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// ReadFile écrit dans w le contenu du fichier path de la sauvegarde, sans extraire ni
+// restaurer la sauvegarde
+func ReadFile(backupID, path string, w io.Writer) error {
+	info, err := findBackupByID(backupID)
+	if err != nil {
+		return fmt.Errorf("impossible de trouver la sauvegarde: %w", err)
+	}
+	return ReadBackupFile(info, path, w)
+}
+
+// ReadBackupFile écrit dans w le contenu du fichier path d'une sauvegarde locale. Dans une
+// sauvegarde en répertoire le fichier est lu directement, sinon l'archive ou l'instantané
+// est parcouru jusqu'à lui.
+func ReadBackupFile(info common.BackupInfo, path string, w io.Writer) error {
+	path = cleanBackupPath(path)
+	if path == "" {
+		return fmt.Errorf("la racine de la sauvegarde est un répertoire")
+	}
+	if !info.Compression && info.Format != common.FormatChunks && info.RemoteServer == nil {
+		return readDirectoryFile(info, path, w)
+	}
+
+	walk, err := WalkContent(info)
+	if err != nil {
+		return err
+	}
+	found, isDir := false, false
+	err = walk(func(rel string, fi os.FileInfo, target string, content io.Reader) error {
+		if rel != path {
+			isDir = isDir || isPathOrChild(rel, path)
+			return nil
+		}
+		found = true
+		if content == nil {
+			return fmt.Errorf("'%s' est un lien symbolique vers %s", path, target)
+		}
+		if _, err := io.Copy(w, content); err != nil {
+			return fmt.Errorf("impossible de lire '%s': %w", path, err)
+		}
+		return errStopWalk
+	})
+	switch {
+	case errors.Is(err, errStopWalk):
+		return nil
+	case err != nil:
+		return err
+	case isDir:
+		return fmt.Errorf("'%s' est un répertoire", path)
+	case !found:
+		return fmt.Errorf("'%s' introuvable dans la sauvegarde %s", path, info.ID)
+	}
+	return nil
+}
+
+// readDirectoryFile lit un fichier d'une sauvegarde en répertoire, déchiffré si nécessaire
+func readDirectoryFile(info common.BackupInfo, path string, w io.Writer) error {
+	full := filepath.Join(info.BackupPath, filepath.FromSlash(path))
+	fi, err := os.Lstat(full)
+	switch {
+	case os.IsNotExist(err):
+		return fmt.Errorf("'%s' introuvable dans la sauvegarde %s", path, info.ID)
+	case err != nil:
+		return err
+	case fi.IsDir():
+		return fmt.Errorf("'%s' est un répertoire", path)
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, _ := os.Readlink(full)
+		return fmt.Errorf("'%s' est un lien symbolique vers %s", path, target)
+	}
+
+	keyring, err := keyringFor(info)
+	if err != nil {
+		return err
+	}
+	var file io.ReadCloser
+	if keyring != nil {
+		file, err = keyring.OpenFile(full)
+	} else {
+		file, err = os.Open(full)
+	}
+	if err != nil {
+		return fmt.Errorf("impossible d'ouvrir '%s': %w", path, err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("impossible de lire '%s': %w", path, err)
+	}
+	return nil
+}
+
+// cleanBackupPath normalise un chemin saisi par l'utilisateur en chemin relatif à la racine
+// d'une sauvegarde ("" pour la racine)
+func cleanBackupPath(path string) string {
+	path = filepath.ToSlash(filepath.Clean("/" + path))
+	return strings.TrimPrefix(path, "/")
+}
@@ -0,0 +1,57 @@
+package restore
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/internal/wrappers"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+func TestListAndReadArchive(t *testing.T) {
+	source := t.TempDir()
+	writeTestFile(t, filepath.Join(source, "etc", "app.conf"), "port = 8080\n")
+	writeTestFile(t, filepath.Join(source, "notes.txt"), "hello")
+
+	for _, ext := range []string{".tar.gz", ".zip"} {
+		archive := filepath.Join(t.TempDir(), "docs_20240102"+ext)
+		format, _ := wrappers.FormatFromPath(archive)
+		cw, err := wrappers.NewCompressionWrapper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cw.Compress(source, archive, format); err != nil {
+			t.Fatalf("Compress(%s) error = %v", ext, err)
+		}
+
+		common.BackupInfoDir = t.TempDir()
+		info := common.BackupInfo{ID: "docs_20240102", Name: "docs", BackupPath: archive, Compression: true, Time: time.Now()}
+		if err := common.SaveBackupInfo(info); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := ListFiles(info.ID, "etc")
+		if err != nil {
+			t.Fatalf("ListFiles(%s) error = %v", ext, err)
+		}
+		if len(entries) != 1 || entries[0].Path != "etc/app.conf" || entries[0].Size != 12 {
+			t.Errorf("ListFiles(%s) = %+v, want etc/app.conf (12 bytes)", ext, entries)
+		}
+
+		var out bytes.Buffer
+		if err := ReadFile(info.ID, "/etc/app.conf", &out); err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", ext, err)
+		}
+		if out.String() != "port = 8080\n" {
+			t.Errorf("ReadFile(%s) = %q", ext, out.String())
+		}
+		if err := ReadFile(info.ID, "etc", &out); err == nil {
+			t.Errorf("ReadFile(%s) of a directory succeeded, want error", ext)
+		}
+		if err := ReadFile(info.ID, "missing.txt", &out); err == nil {
+			t.Errorf("ReadFile(%s) of a missing file succeeded, want error", ext)
+		}
+	}
+}
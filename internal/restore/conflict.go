@@ -0,0 +1,168 @@
+package restore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// ConflictPolicy indique que faire d'un fichier restauré qui existe déjà, différent, dans la destination
+type ConflictPolicy string
+
+const (
+	ConflictOverwrite ConflictPolicy = "overwrite"  // Remplacer le fichier existant (par défaut)
+	ConflictSkipNewer ConflictPolicy = "skip-newer" // Garder le fichier existant s'il est plus récent
+	ConflictKeepBoth  ConflictPolicy = "keep-both"  // Garder le fichier existant, restaurer à côté sous un autre nom
+	ConflictFail      ConflictPolicy = "fail"       // Annuler la restauration au premier conflit
+)
+
+// ConflictPolicies liste les politiques de conflit acceptées
+var ConflictPolicies = []ConflictPolicy{ConflictOverwrite, ConflictSkipNewer, ConflictKeepBoth, ConflictFail}
+
+// ParseConflictPolicy convertit le nom d'une politique de conflit
+func ParseConflictPolicy(value string) (ConflictPolicy, error) {
+	for _, policy := range ConflictPolicies {
+		if string(policy) == value {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("politique de conflit inconnue: %q (attendu: overwrite, skip-newer, keep-both ou fail)", value)
+}
+
+// FileAction est le sort d'un fichier de la destination à l'issue d'une restauration
+type FileAction string
+
+const (
+	FileCreated     FileAction = "created"     // Absent de la destination, restauré
+	FileOverwritten FileAction = "overwritten" // Remplacé par la version de la sauvegarde
+	FileSkipped     FileAction = "skipped"     // Conservé car plus récent que la sauvegarde
+	FileKeptBoth    FileAction = "kept-both"   // Conservé, la version de la sauvegarde restaurée à côté
+)
+
+// FileDecision décrit le sort d'un fichier restauré
+type FileDecision struct {
+	Path     string     `json:"path"`
+	Action   FileAction `json:"action"`
+	Restored string     `json:"restored,omitempty"` // Nom de la copie restaurée à côté (keep-both)
+}
+
+// ConflictError signale un conflit avec la politique ConflictFail
+type ConflictError struct {
+	Path string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflit sur '%s': le fichier existe déjà et diffère de la sauvegarde", e.Path)
+}
+
+// restoredSuffix renvoie le suffixe des copies restaurées à côté des fichiers existants
+func restoredSuffix(backupTime time.Time) string {
+	return ".restored-" + backupTime.Format("2006-01-02_15-04-05")
+}
+
+// resolveConflicts compare le répertoire de préparation, qui contient la destination
+// et les fichiers restaurés par-dessus, à la destination encore intacte. Les fichiers
+// en conflit sont traités selon policy; le sort de chaque fichier modifié est renvoyé.
+func resolveConflicts(staging, target string, policy ConflictPolicy, backupTime time.Time) ([]FileDecision, error) {
+	if policy == "" {
+		policy = ConflictOverwrite
+	}
+	var decisions []FileDecision
+	// Copies à renommer après le parcours, pour ne pas les revoir pendant celui-ci
+	type rename struct {
+		staged, original string
+		info             os.FileInfo
+	}
+	var renames []rename
+
+	err := filepath.Walk(staging, func(path string, staged os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if staged.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(staging, path)
+		if err != nil {
+			return err
+		}
+		original := filepath.Join(target, rel)
+		current, err := os.Lstat(original)
+		switch {
+		case os.IsNotExist(err):
+			decisions = append(decisions, FileDecision{Path: filepath.ToSlash(rel), Action: FileCreated})
+			return nil
+		case err != nil:
+			return err
+		case current.IsDir() || sameFile(staged, path, current, original):
+			return nil
+		}
+
+		decision := FileDecision{Path: filepath.ToSlash(rel), Action: FileOverwritten}
+		switch policy {
+		case ConflictFail:
+			return &ConflictError{Path: decision.Path}
+		case ConflictSkipNewer:
+			if current.ModTime().After(staged.ModTime()) {
+				decision.Action = FileSkipped
+				if err := putBack(original, path, current); err != nil {
+					return err
+				}
+			}
+		case ConflictKeepBoth:
+			decision.Action = FileKeptBoth
+			decision.Restored = decision.Path + restoredSuffix(backupTime)
+			renames = append(renames, rename{path, original, current})
+		}
+		decisions = append(decisions, decision)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range renames {
+		if err := os.Rename(r.staged, r.staged+restoredSuffix(backupTime)); err != nil {
+			return nil, fmt.Errorf("impossible de renommer la copie restaurée: %w", err)
+		}
+		if err := putBack(r.original, r.staged, r.info); err != nil {
+			return nil, err
+		}
+	}
+	common.LogInfo("Conflits de restauration traités (%s): %d fichier(s) modifié(s).", policy, len(decisions))
+	return decisions, nil
+}
+
+// sameFile indique si la restauration a laissé un fichier tel qu'il était dans la destination
+func sameFile(staged os.FileInfo, stagedPath string, current os.FileInfo, currentPath string) bool {
+	if os.SameFile(staged, current) {
+		return true
+	}
+	if staged.Mode()&os.ModeSymlink != 0 || current.Mode()&os.ModeSymlink != 0 {
+		a, errA := os.Readlink(stagedPath)
+		b, errB := os.Readlink(currentPath)
+		return errA == nil && errB == nil && a == b
+	}
+	return staged.Mode() == current.Mode() && staged.Size() == current.Size() && staged.ModTime().Equal(current.ModTime())
+}
+
+// putBack remet dans le répertoire de préparation, à la place dest, le fichier existant original
+func putBack(original, dest string, info os.FileInfo) error {
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(original)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, dest)
+	}
+	if err := os.Link(original, dest); err != nil {
+		return copyFile(original, dest, info)
+	}
+	return nil
+}
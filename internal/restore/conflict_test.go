@@ -0,0 +1,103 @@
+package restore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stageRestore prépare une destination contenant old.txt (plus ancien que la sauvegarde),
+// new.txt (plus récent) et same.txt, puis simule la restauration de la sauvegarde par-dessus
+func stageRestore(t *testing.T, backupTime time.Time) (target, staging string) {
+	t.Helper()
+	target = filepath.Join(t.TempDir(), "work")
+	for name, age := range map[string]time.Duration{"old.txt": -time.Hour, "new.txt": time.Hour, "same.txt": 0} {
+		path := filepath.Join(target, name)
+		writeTestFile(t, path, "current "+name)
+		modTime := backupTime.Add(age)
+		os.Chtimes(path, modTime, modTime)
+	}
+
+	staging, err := prepareStaging(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"old.txt", "new.txt", "added.txt"} {
+		path := filepath.Join(staging, name)
+		os.Remove(path)
+		writeTestFile(t, path, "backup "+name)
+		os.Chtimes(path, backupTime, backupTime)
+	}
+	return target, staging
+}
+
+func decisionsByPath(files []FileDecision) map[string]FileDecision {
+	byPath := make(map[string]FileDecision)
+	for _, f := range files {
+		byPath[f.Path] = f
+	}
+	return byPath
+}
+
+func TestResolveConflicts(t *testing.T) {
+	backupTime := time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local)
+
+	t.Run("overwrite", func(t *testing.T) {
+		target, staging := stageRestore(t, backupTime)
+		files, err := resolveConflicts(staging, target, ConflictOverwrite, backupTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := decisionsByPath(files)
+		if len(files) != 3 || got["old.txt"].Action != FileOverwritten || got["new.txt"].Action != FileOverwritten || got["added.txt"].Action != FileCreated {
+			t.Errorf("decisions = %+v", files)
+		}
+		if s := readTestFile(t, filepath.Join(staging, "new.txt")); s != "backup new.txt" {
+			t.Errorf("new.txt = %q, want backup version", s)
+		}
+	})
+
+	t.Run("skip-newer", func(t *testing.T) {
+		target, staging := stageRestore(t, backupTime)
+		files, err := resolveConflicts(staging, target, ConflictSkipNewer, backupTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := decisionsByPath(files)
+		if got["old.txt"].Action != FileOverwritten || got["new.txt"].Action != FileSkipped {
+			t.Errorf("decisions = %+v", files)
+		}
+		if s := readTestFile(t, filepath.Join(staging, "new.txt")); s != "current new.txt" {
+			t.Errorf("new.txt = %q, want current version", s)
+		}
+	})
+
+	t.Run("keep-both", func(t *testing.T) {
+		target, staging := stageRestore(t, backupTime)
+		files, err := resolveConflicts(staging, target, ConflictKeepBoth, backupTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored := "old.txt" + restoredSuffix(backupTime)
+		if got := decisionsByPath(files)["old.txt"]; got.Action != FileKeptBoth || got.Restored != restored {
+			t.Errorf("old.txt decision = %+v", got)
+		}
+		if s := readTestFile(t, filepath.Join(staging, "old.txt")); s != "current old.txt" {
+			t.Errorf("old.txt = %q, want current version", s)
+		}
+		if s := readTestFile(t, filepath.Join(staging, restored)); s != "backup old.txt" {
+			t.Errorf("%s = %q, want backup version", restored, s)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		target, staging := stageRestore(t, backupTime)
+		_, err := resolveConflicts(staging, target, ConflictFail, backupTime)
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("resolveConflicts() error = %v, want ConflictError", err)
+		}
+	})
+}
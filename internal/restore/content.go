@@ -0,0 +1,143 @@
+package restore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Noziop/s4v3my4ss/internal/chunkstore"
+	"github.com/Noziop/s4v3my4ss/internal/encryption"
+	"github.com/Noziop/s4v3my4ss/internal/manifest"
+	"github.com/Noziop/s4v3my4ss/internal/wrappers"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// cachedKeyring conserve le trousseau de la phrase secrète courante, pour ne dériver la clé
+// d'une sauvegarde qu'une seule fois par processus
+var (
+	keyringMu     sync.Mutex
+	cachedKeyring *encryption.Keyring
+	cachedSecret  string
+)
+
+// keyringFor renvoie le trousseau permettant de déchiffrer une sauvegarde, ou nil si elle est en clair
+func keyringFor(info common.BackupInfo) (*encryption.Keyring, error) {
+	if !info.Encrypted {
+		return nil, nil
+	}
+	common.LogSecurity("Détection d'une sauvegarde chiffrée (%s). Déchiffrement...", info.ID)
+	passphrase, err := common.EncryptionPassphrase()
+	if err != nil {
+		common.LogError("Impossible de déchiffrer la sauvegarde %s: %v", info.ID, err)
+		return nil, fmt.Errorf("impossible de déchiffrer la sauvegarde: %w", err)
+	}
+
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	if cachedKeyring == nil || cachedSecret != passphrase {
+		keyring, err := encryption.NewKeyring(passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("impossible de déchiffrer la sauvegarde: %w", err)
+		}
+		cachedKeyring, cachedSecret = keyring, passphrase
+	}
+	return cachedKeyring, nil
+}
+
+// archivePath renvoie le chemin de l'archive d'une sauvegarde compressée.
+// Les anciennes métadonnées enregistraient le chemin sans extension.
+func archivePath(info common.BackupInfo) string {
+	if _, ok := wrappers.FormatFromPath(info.BackupPath); ok {
+		return info.BackupPath
+	}
+	return info.BackupPath + ".tar.gz"
+}
+
+// legacyArchivePrefix renvoie le répertoire sous lequel les anciennes archives plaçaient
+// les fichiers sauvegardés (nom de l'archive sans extension, suivi d'un slash)
+func legacyArchivePrefix(info common.BackupInfo) string {
+	return filepath.Base(strings.TrimSuffix(info.BackupPath, ".tar.gz")) + "/"
+}
+
+// walkBackup renvoie une fonction de parcours du contenu d'une sauvegarde locale
+// (répertoire, archive ou dépôt de blocs), sans extraction et déchiffré à la volée
+func walkBackup(info common.BackupInfo, keyring *encryption.Keyring) (manifest.WalkFunc, error) {
+	if info.RemoteServer != nil {
+		return nil, fmt.Errorf("le contenu d'une sauvegarde distante ne peut pas être parcouru")
+	}
+
+	switch {
+	case info.Format == common.FormatChunks:
+		repo, err := chunkstore.Open(info.BackupPath)
+		if err != nil {
+			return nil, fmt.Errorf("impossible d'ouvrir le dépôt: %w", err)
+		}
+		return func(fn manifest.EntryFunc) error {
+			return repo.Walk(info.ID, fn)
+		}, nil
+
+	case info.Compression:
+		path := archivePath(info)
+		if !common.FileExists(path) {
+			return nil, fmt.Errorf("fichier de sauvegarde compressé introuvable: %s", path)
+		}
+		cw, err := wrappers.NewCompressionWrapper()
+		if err != nil {
+			return nil, err
+		}
+		cw.Keyring = keyring
+		return func(fn manifest.EntryFunc) error {
+			return cw.WalkArchive(path, fn)
+		}, nil
+
+	default:
+		if !common.DirExists(info.BackupPath) {
+			return nil, fmt.Errorf("répertoire de sauvegarde introuvable: %s", info.BackupPath)
+		}
+		var open func(path string) (io.ReadCloser, error)
+		if keyring != nil {
+			open = keyring.OpenFile
+		}
+		return manifest.WalkDir(info.BackupPath, open), nil
+	}
+}
+
+// WalkContent renvoie une fonction de parcours du contenu d'une sauvegarde locale, sans
+// extraction: les chemins sont relatifs à sa racine, les tailles et contenus ceux des fichiers en clair
+func WalkContent(info common.BackupInfo) (manifest.WalkFunc, error) {
+	keyring, err := keyringFor(info)
+	if err != nil {
+		return nil, err
+	}
+	walk, err := walkBackup(info, keyring)
+	if err != nil {
+		return nil, err
+	}
+	// Dans un répertoire chiffré, la taille des fichiers est celle du contenu chiffré
+	encryptedDir := keyring != nil && !info.Compression && info.Format != common.FormatChunks
+	legacyPrefix := legacyArchivePrefix(info)
+
+	return func(fn manifest.EntryFunc) error {
+		return walk(func(rel string, fi os.FileInfo, target string, content io.Reader) error {
+			if info.Compression {
+				rel = strings.TrimPrefix(rel, legacyPrefix)
+			}
+			if encryptedDir && fi.Mode().IsRegular() {
+				fi = plainInfo{fi}
+			}
+			return fn(rel, fi, target, content)
+		})
+	}, nil
+}
+
+// plainInfo présente un fichier chiffré avec la taille de son contenu en clair
+type plainInfo struct {
+	os.FileInfo
+}
+
+func (p plainInfo) Size() int64 {
+	return encryption.PlaintextSize(p.FileInfo.Size())
+}
@@ -0,0 +1,156 @@
+package restore
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// diffContext est le nombre de lignes de contexte autour de chaque modification
+const diffContext = 3
+
+// maxDiffLines limite la taille des fichiers comparés ligne à ligne
+const maxDiffLines = 5000
+
+// diffOp est une ligne du résultat de la comparaison: ' ' commune, '-' supprimée, '+' ajoutée
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// isText indique si un contenu peut être comparé comme du texte
+func isText(data []byte) bool {
+	return !bytes.ContainsRune(data, 0) && utf8.Valid(data)
+}
+
+// splitLines découpe un texte en lignes, sans le saut de ligne final
+func splitLines(data []byte) []string {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// unifiedDiff renvoie la différence entre deux textes au format unifié,
+// ou une chaîne vide s'ils sont identiques ou trop longs pour être comparés
+func unifiedDiff(oldName, newName string, oldData, newData []byte) string {
+	a, b := splitLines(oldData), splitLines(newData)
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return ""
+	}
+	ops := diffLines(a, b)
+
+	var changes []int
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Regrouper les modifications proches en blocs avec leur contexte
+	for i := 0; i < len(changes); {
+		start := changes[i] - diffContext
+		if start < 0 {
+			start = 0
+		}
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*diffContext {
+			j++
+		}
+		end := changes[j] + diffContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		writeHunk(&out, ops, start, end)
+		i = j + 1
+	}
+	return out.String()
+}
+
+// writeHunk écrit le bloc ops[start:end] avec son en-tête de numéros de ligne
+func writeHunk(out *strings.Builder, ops []diffOp, start, end int) {
+	// Numéros des premières lignes du bloc dans chaque version
+	oldLine, newLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			oldLine++
+		}
+		if op.kind != '-' {
+			newLine++
+		}
+	}
+	oldCount, newCount := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	if oldCount == 0 {
+		oldLine--
+	}
+	if newCount == 0 {
+		newLine--
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+	for _, op := range ops[start:end] {
+		out.WriteByte(op.kind)
+		out.WriteString(op.line)
+		out.WriteByte('\n')
+	}
+}
+
+// diffLines compare deux listes de lignes par plus longue sous-séquence commune
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] est la longueur de la plus longue sous-séquence commune de a[i:] et b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
@@ -0,0 +1,40 @@
+package restore
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	old := []byte("a\nb\nc\nd\ne\nf\ng\nh\n")
+	new := []byte("a\nb\nc\nD\ne\nf\ng\nh\ni\n")
+
+	got := unifiedDiff("old", "new", old, new)
+	want := "--- old\n+++ new\n" +
+		"@@ -1,8 +1,9 @@\n a\n b\n c\n-d\n+D\n e\n f\n g\n h\n+i\n"
+	if got != want {
+		t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := unifiedDiff("old", "new", old, old); got != "" {
+		t.Errorf("unifiedDiff() of identical contents = %q, want empty", got)
+	}
+}
+
+func TestUnifiedDiffSeparateHunks(t *testing.T) {
+	old := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n")
+	new := []byte("one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n")
+
+	want := "--- old\n+++ new\n" +
+		"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+		"@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n"
+	if got := unifiedDiff("old", "new", old, new); got != want {
+		t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestIsText(t *testing.T) {
+	if !isText([]byte("héllo\n")) {
+		t.Error("isText() = false for UTF-8 text")
+	}
+	if isText([]byte{'a', 0, 'b'}) {
+		t.Error("isText() = true for binary content")
+	}
+}
@@ -0,0 +1,75 @@
+package restore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/internal/wrappers"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// ExportInfoName est le nom, dans une archive exportée, du fichier décrivant la sauvegarde
+const ExportInfoName = ".saveme-backup.json"
+
+// ExportBackup écrit dans w une archive autonome du contenu d'une sauvegarde, quel que soit
+// son stockage (répertoire, archive, dépôt de blocs, chiffrée ou distante). La description
+// de la sauvegarde est ajoutée en tête de l'archive sous ExportInfoName.
+func ExportBackup(backupID string, w io.Writer, format wrappers.CompressionFormat) error {
+	info, err := findBackupByID(backupID)
+	if err != nil {
+		return fmt.Errorf("impossible de trouver la sauvegarde: %w", err)
+	}
+	common.LogInfo("Export de la sauvegarde %s au format %s.", backupID, format)
+	startTime := time.Now()
+
+	local := info
+	if info.RemoteServer != nil {
+		var cleanup func()
+		if local, cleanup, err = fetchRemote(info); err != nil {
+			return err
+		}
+		defer cleanup()
+	}
+	walk, err := WalkContent(local)
+	if err != nil {
+		return err
+	}
+
+	aw, err := wrappers.NewArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("impossible d'encoder la description de la sauvegarde: %w", err)
+	}
+	if err := aw.AddBytes(ExportInfoName, append(data, '\n'), info.Time); err != nil {
+		return fmt.Errorf("erreur lors de l'écriture de l'archive: %w", err)
+	}
+
+	count := 0
+	err = walk(func(rel string, fi os.FileInfo, target string, content io.Reader) error {
+		if rel == ExportInfoName {
+			common.LogWarning("'%s' de la sauvegarde %s ignoré: nom réservé à la description de l'export.", rel, backupID)
+			return nil
+		}
+		count++
+		if err := aw.Add(rel, fi, target, content); err != nil {
+			return fmt.Errorf("erreur lors de l'export de '%s': %w", rel, err)
+		}
+		return nil
+	})
+	if err != nil {
+		common.LogError("Erreur lors de l'export de la sauvegarde %s: %v", backupID, err)
+		return err
+	}
+	if err := aw.Close(); err != nil {
+		return fmt.Errorf("erreur lors de l'écriture de l'archive: %w", err)
+	}
+
+	common.LogInfo("Export de %d élément(s) terminé en %v.", count, formatDuration(time.Since(startTime)))
+	return nil
+}
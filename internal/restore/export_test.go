@@ -0,0 +1,66 @@
+package restore
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/internal/wrappers"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+func TestExportBackup(t *testing.T) {
+	backupDir := t.TempDir()
+	writeTestFile(t, filepath.Join(backupDir, "etc", "app.conf"), "port = 8080\n")
+	writeTestFile(t, filepath.Join(backupDir, "notes.txt"), "hello")
+	if err := os.Symlink("notes.txt", filepath.Join(backupDir, "latest")); err != nil {
+		t.Fatal(err)
+	}
+
+	common.BackupInfoDir = t.TempDir()
+	info := common.BackupInfo{ID: "docs_20240102", Name: "docs", BackupPath: backupDir, Time: time.Now()}
+	if err := common.SaveBackupInfo(info); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, format := range wrappers.ExportFormats {
+		archive := filepath.Join(t.TempDir(), "export"+format.Extension())
+		out, err := os.Create(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ExportBackup(info.ID, out, format); err != nil {
+			t.Fatalf("ExportBackup(%s) error = %v", name, err)
+		}
+		out.Close()
+
+		cw, err := wrappers.NewCompressionWrapper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string)
+		err = cw.WalkArchive(archive, func(rel string, fi os.FileInfo, target string, content io.Reader) error {
+			if content == nil {
+				got[rel] = "-> " + target
+				return nil
+			}
+			data, err := io.ReadAll(content)
+			got[rel] = string(data)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("WalkArchive(%s) error = %v", name, err)
+		}
+
+		if got["etc/app.conf"] != "port = 8080\n" || got["notes.txt"] != "hello" || got["latest"] != "-> notes.txt" {
+			t.Errorf("export %s content = %v", name, got)
+		}
+		var exported common.BackupInfo
+		if err := json.Unmarshal([]byte(got[ExportInfoName]), &exported); err != nil || exported.ID != info.ID {
+			t.Errorf("export %s %s = %q (%v), want backup info", name, ExportInfoName, got[ExportInfoName], err)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package restore
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// OwnerMapping indique à qui attribuer les fichiers restaurés, par exemple pour restaurer
+// l'arborescence d'un autre utilisateur ou d'une autre machine dans son propre répertoire
+type OwnerMapping struct {
+	Users  map[int]int // UID d'origine -> UID attribué (--map-owner)
+	Groups map[int]int // GID d'origine -> GID attribué (--map-group)
+	// NormalizeModes remplace les permissions d'origine par 0755 pour les répertoires et les
+	// fichiers exécutables, 0644 pour les autres fichiers (setuid, setgid et sticky retirés)
+	NormalizeModes bool
+
+	owner *ownerIDs // Propriétaire de tous les fichiers restaurés (--owner), prioritaire
+}
+
+// ownerIDs est un couple propriétaire et groupe
+type ownerIDs struct {
+	uid, gid int
+}
+
+// MapUser ajoute une correspondance "origine:attribué" entre deux utilisateurs, désignés
+// par leur nom ou leur UID
+func (m *OwnerMapping) MapUser(spec string) error {
+	from, to, err := splitMapping(spec, lookupUID)
+	if err != nil {
+		return fmt.Errorf("correspondance d'utilisateurs invalide %q: %w", spec, err)
+	}
+	if m.Users == nil {
+		m.Users = make(map[int]int)
+	}
+	m.Users[from] = to
+	return nil
+}
+
+// MapGroup ajoute une correspondance "origine:attribué" entre deux groupes, désignés
+// par leur nom ou leur GID
+func (m *OwnerMapping) MapGroup(spec string) error {
+	from, to, err := splitMapping(spec, lookupGID)
+	if err != nil {
+		return fmt.Errorf("correspondance de groupes invalide %q: %w", spec, err)
+	}
+	if m.Groups == nil {
+		m.Groups = make(map[int]int)
+	}
+	m.Groups[from] = to
+	return nil
+}
+
+// SetOwner attribue tous les fichiers restaurés à un utilisateur et à son groupe principal:
+// "self" pour l'utilisateur courant, sinon un nom ou un UID
+func (m *OwnerMapping) SetOwner(spec string) error {
+	if spec == "self" {
+		m.owner = &ownerIDs{uid: os.Getuid(), gid: os.Getgid()}
+		return nil
+	}
+	u, err := lookupUser(spec)
+	if err != nil {
+		return err
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("groupe principal de '%s' inconnu", spec)
+	}
+	m.owner = &ownerIDs{uid: uid, gid: gid}
+	return nil
+}
+
+// IsZero indique qu'aucune correspondance ni normalisation n'est demandée
+func (m OwnerMapping) IsZero() bool {
+	return m.owner == nil && len(m.Users) == 0 && len(m.Groups) == 0 && !m.NormalizeModes
+}
+
+// keepsOwners indique si la restauration doit reproduire les propriétaires de la sauvegarde
+// avant l'application des correspondances. Seul root peut le faire; inutile si un propriétaire
+// unique est imposé.
+func (m OwnerMapping) keepsOwners() bool {
+	return m.IsZero() || (m.owner == nil && os.Geteuid() == 0)
+}
+
+// target renvoie le propriétaire et le groupe à attribuer à un fichier
+func (m OwnerMapping) target(uid, gid int) (int, int) {
+	if m.owner != nil {
+		return m.owner.uid, m.owner.gid
+	}
+	if to, ok := m.Users[uid]; ok {
+		uid = to
+	}
+	if to, ok := m.Groups[gid]; ok {
+		gid = to
+	}
+	return uid, gid
+}
+
+// normalizedMode renvoie les permissions normalisées d'un fichier ou d'un répertoire
+func normalizedMode(mode os.FileMode) os.FileMode {
+	if mode.IsDir() || mode&0100 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+// applyOwnership applique les correspondances de propriétaires et la normalisation des
+// permissions aux éléments restaurés dans le répertoire de préparation. Les fichiers
+// identiques à ceux de la destination (non restaurés ou conservés) ne sont pas modifiés.
+func applyOwnership(staging, target string, m OwnerMapping) error {
+	changed := 0
+	err := filepath.Walk(staging, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, err := filepath.Rel(staging, path)
+			if err != nil {
+				return err
+			}
+			original := filepath.Join(target, rel)
+			// Un fichier non restauré est partagé avec la destination: le modifier la modifierait aussi
+			if current, err := os.Lstat(original); err == nil && sameFile(info, path, current, original) {
+				return nil
+			}
+		}
+
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("propriétaire de %s inconnu", path)
+		}
+		uid, gid := m.target(int(stat.Uid), int(stat.Gid))
+		modified := false
+		if uid != int(stat.Uid) || gid != int(stat.Gid) {
+			if err := os.Lchown(path, uid, gid); err != nil {
+				return fmt.Errorf("impossible d'attribuer %s à %d:%d: %w", path, uid, gid, err)
+			}
+			modified = true
+		}
+		if m.NormalizeModes && info.Mode()&os.ModeSymlink == 0 {
+			if mode := normalizedMode(info.Mode()); info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky) != mode {
+				if err := os.Chmod(path, mode); err != nil {
+					return fmt.Errorf("impossible de modifier les permissions de %s: %w", path, err)
+				}
+				modified = true
+			}
+		}
+		if modified {
+			changed++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	common.LogInfo("Propriétaires et permissions ajustés sur %d élément(s) restauré(s).", changed)
+	return nil
+}
+
+// splitMapping décompose une correspondance "origine:attribué"
+func splitMapping(spec string, lookup func(string) (int, error)) (int, int, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return 0, 0, fmt.Errorf("format attendu: origine:attribué")
+	}
+	from, err := lookup(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := lookup(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return from, to, nil
+}
+
+// lookupUser cherche un utilisateur par son nom ou son UID
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		if u, err := user.LookupId(name); err == nil {
+			return u, nil
+		}
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("utilisateur inconnu: %s", name)
+	}
+	return u, nil
+}
+
+// lookupUID renvoie l'UID d'un utilisateur désigné par son nom ou son UID. Un UID absent
+// de la machine est accepté: c'est le cas des fichiers venant d'une autre machine.
+func lookupUID(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil && id >= 0 {
+		return id, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, fmt.Errorf("utilisateur inconnu: %s", name)
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGID renvoie le GID d'un groupe désigné par son nom ou son GID
+func lookupGID(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil && id >= 0 {
+		return id, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, fmt.Errorf("groupe inconnu: %s", name)
+	}
+	return strconv.Atoi(g.Gid)
+}
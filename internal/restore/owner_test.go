@@ -0,0 +1,91 @@
+package restore
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestOwnerMappingTarget(t *testing.T) {
+	var m OwnerMapping
+	if err := m.MapUser("1000:1001"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.MapGroup("100:101"); err != nil {
+		t.Fatal(err)
+	}
+	if uid, gid := m.target(1000, 100); uid != 1001 || gid != 101 {
+		t.Errorf("target(1000, 100) = %d:%d, want 1001:101", uid, gid)
+	}
+	if uid, gid := m.target(42, 43); uid != 42 || gid != 43 {
+		t.Errorf("target(42, 43) = %d:%d, want unchanged", uid, gid)
+	}
+
+	if err := m.SetOwner("self"); err != nil {
+		t.Fatal(err)
+	}
+	if uid, gid := m.target(1000, 100); uid != os.Getuid() || gid != os.Getgid() {
+		t.Errorf("target with --owner self = %d:%d, want %d:%d", uid, gid, os.Getuid(), os.Getgid())
+	}
+
+	for _, spec := range []string{"1000", "1000:", ":1001", "no-such-user-xyz:1000"} {
+		if err := m.MapUser(spec); err == nil {
+			t.Errorf("MapUser(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestApplyOwnership(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "work")
+	writeTestFile(t, filepath.Join(target, "kept.sh"), "#!/bin/sh\n")
+	os.Chmod(filepath.Join(target, "kept.sh"), 0700)
+
+	staging, err := prepareStaging(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := filepath.Join(staging, "bin", "run.sh")
+	writeTestFile(t, restored, "#!/bin/sh\n")
+	os.Chmod(restored, 04750)
+	writeTestFile(t, filepath.Join(staging, "notes.txt"), "hello")
+	os.Chmod(filepath.Join(staging, "notes.txt"), 0600)
+	if err := completeStaging(staging, target); err != nil {
+		t.Fatal(err)
+	}
+
+	m := OwnerMapping{NormalizeModes: true}
+	if os.Geteuid() == 0 {
+		if err := m.MapUser("0:1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := applyOwnership(staging, target, m); err != nil {
+		t.Fatalf("applyOwnership() error = %v", err)
+	}
+
+	for path, want := range map[string]os.FileMode{
+		restored:                            0755,
+		filepath.Join(staging, "notes.txt"): 0644,
+		filepath.Join(staging, "bin"):       os.ModeDir | 0755,
+		// Partagé avec la destination, non restauré: inchangé
+		filepath.Join(staging, "kept.sh"): 0700,
+	} {
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != want {
+			t.Errorf("mode of %s = %v, want %v", path, info.Mode(), want)
+		}
+		if os.Geteuid() == 0 {
+			wantUID := uint32(1)
+			if filepath.Base(path) == "kept.sh" {
+				wantUID = 0
+			}
+			if uid := info.Sys().(*syscall.Stat_t).Uid; uid != wantUID {
+				t.Errorf("owner of %s = %d, want %d", path, uid, wantUID)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package restore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/internal/chunkstore"
+	"github.com/Noziop/s4v3my4ss/internal/encryption"
+	"github.com/Noziop/s4v3my4ss/internal/manifest"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// timeLayouts sont les formats de date acceptés pour une restauration à un instant donné
+var timeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/2006",
+}
+
+// ParseTime interprète une date saisie par l'utilisateur, dans le fuseau local.
+// Une date sans heure désigne la fin de la journée.
+func ParseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		if err != nil {
+			continue
+		}
+		if !strings.Contains(layout, "15") {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("date invalide: %q (format attendu: AAAA-MM-JJ HH:MM)", value)
+}
+
+// FindBackupAt renvoie la dernière sauvegarde de la configuration name réalisée à l'instant at ou avant
+func FindBackupAt(name string, at time.Time) (common.BackupInfo, error) {
+	candidates, err := backupsAt(name, at)
+	if err != nil {
+		return common.BackupInfo{}, err
+	}
+	common.LogInfo("Sauvegarde %s retenue pour '%s' au %s.", candidates[0].ID, name, at.Format("02/01/2006 15:04:05"))
+	return candidates[0], nil
+}
+
+// FindFileVersionAt renvoie la dernière sauvegarde de la configuration name, réalisée
+// à l'instant at ou avant, qui contient l'élément rel (chemin relatif à la racine de la sauvegarde)
+func FindFileVersionAt(name, rel string, at time.Time) (common.BackupInfo, error) {
+	candidates, err := backupsAt(name, at)
+	if err != nil {
+		return common.BackupInfo{}, err
+	}
+	rel = filepath.ToSlash(filepath.Clean(strings.TrimPrefix(rel, "/")))
+
+	var keyring *encryption.Keyring
+	for _, b := range candidates {
+		if b.Encrypted && keyring == nil {
+			passphrase, err := common.EncryptionPassphrase()
+			if err != nil {
+				return common.BackupInfo{}, fmt.Errorf("impossible de lire le contenu d'une sauvegarde chiffrée: %w", err)
+			}
+			if keyring, err = encryption.NewKeyring(passphrase); err != nil {
+				return common.BackupInfo{}, err
+			}
+		}
+		found, err := containsPath(b, rel, keyring)
+		if err != nil {
+			common.LogWarning("Impossible de lire le contenu de la sauvegarde %s: %v", b.ID, err)
+			continue
+		}
+		if found {
+			common.LogInfo("Version de '%s' retenue: sauvegarde %s.", rel, b.ID)
+			return b, nil
+		}
+	}
+	return common.BackupInfo{}, fmt.Errorf("aucune sauvegarde de '%s' antérieure au %s ne contient '%s'", name, at.Format("02/01/2006 15:04"), rel)
+}
+
+// backupsAt renvoie les sauvegardes de la configuration name réalisées à l'instant at
+// ou avant, de la plus récente à la plus ancienne
+func backupsAt(name string, at time.Time) ([]common.BackupInfo, error) {
+	backups, err := common.ListBackups()
+	if err != nil {
+		return nil, fmt.Errorf("impossible de lister les sauvegardes: %w", err)
+	}
+	candidates := selectBackupsAt(backups, name, at)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("aucune sauvegarde de '%s' au %s ou avant", name, at.Format("02/01/2006 15:04"))
+	}
+	return candidates, nil
+}
+
+// selectBackupsAt filtre et trie les sauvegardes d'une configuration antérieures à at
+func selectBackupsAt(backups []common.BackupInfo, name string, at time.Time) []common.BackupInfo {
+	var candidates []common.BackupInfo
+	for _, b := range backups {
+		if b.Name == name && !b.Time.After(at) {
+			candidates = append(candidates, b)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Time.After(candidates[j].Time) })
+	return candidates
+}
+
+// isPathOrChild indique si path désigne rel ou un élément du répertoire rel
+func isPathOrChild(path, rel string) bool {
+	return path == rel || strings.HasPrefix(path, rel+"/")
+}
+
+// containsPath indique si une sauvegarde contient l'élément rel (fichier ou répertoire), d'après son manifeste,
+// l'instantané du dépôt ou à défaut le répertoire de la sauvegarde
+func containsPath(b common.BackupInfo, rel string, keyring *encryption.Keyring) (bool, error) {
+	if b.Format == common.FormatChunks {
+		repo, err := chunkstore.Open(b.BackupPath)
+		if err != nil {
+			return false, err
+		}
+		snapshot, err := repo.LoadSnapshot(b.ID)
+		if err != nil {
+			return false, err
+		}
+		for _, entry := range snapshot.Entries {
+			if isPathOrChild(entry.Path, rel) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if b.ManifestPath != "" {
+		m, err := manifest.Load(b.ManifestPath, keyring)
+		if err != nil {
+			return false, err
+		}
+		for _, entry := range m.Entries {
+			if isPathOrChild(entry.Path, rel) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	// Sauvegardes antérieures aux manifestes: seul un répertoire local peut être consulté
+	if b.Compression || b.RemoteServer != nil {
+		return false, fmt.Errorf("contenu inconnu sans manifeste")
+	}
+	_, err := os.Lstat(filepath.Join(b.BackupPath, filepath.FromSlash(rel)))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,53 @@
+package restore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+func TestParseTime(t *testing.T) {
+	expected := time.Date(2026, 10, 1, 14, 0, 0, 0, time.Local)
+	for _, value := range []string{"2026-10-01 14:00", "2026-10-01T14:00", "01/10/2026 14:00", "2026-10-01 14:00:00"} {
+		got, err := ParseTime(value)
+		if err != nil {
+			t.Errorf("ParseTime(%q) failed: %v", value, err)
+			continue
+		}
+		if !got.Equal(expected) {
+			t.Errorf("ParseTime(%q) = %v, expected %v", value, got, expected)
+		}
+	}
+
+	// Une date seule désigne la fin de la journée
+	got, err := ParseTime("2026-10-01")
+	if err != nil {
+		t.Fatalf("ParseTime failed: %v", err)
+	}
+	if want := time.Date(2026, 10, 1, 23, 59, 59, 0, time.Local); !got.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	if _, err := ParseTime("hier"); err == nil {
+		t.Error("Expected an error for an invalid date")
+	}
+}
+
+func TestSelectBackupsAt(t *testing.T) {
+	at := time.Date(2026, 10, 1, 14, 0, 0, 0, time.UTC)
+	backups := []common.BackupInfo{
+		{ID: "proj_1", Name: "proj", Time: at.Add(-48 * time.Hour)},
+		{ID: "proj_3", Name: "proj", Time: at.Add(time.Minute)},
+		{ID: "other_1", Name: "other", Time: at.Add(-time.Hour)},
+		{ID: "proj_2", Name: "proj", Time: at},
+	}
+
+	candidates := selectBackupsAt(backups, "proj", at)
+	if len(candidates) != 2 {
+		t.Fatalf("Expected 2 candidates, got %d: %+v", len(candidates), candidates)
+	}
+	if candidates[0].ID != "proj_2" || candidates[1].ID != "proj_1" {
+		t.Errorf("Expected [proj_2 proj_1], got [%s %s]", candidates[0].ID, candidates[1].ID)
+	}
+}
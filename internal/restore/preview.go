@@ -0,0 +1,162 @@
+package restore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// maxDiffSize est la taille maximale d'un fichier texte pour afficher sa différence
+const maxDiffSize = 64 * 1024
+
+// PreviewAction est l'effet d'une restauration sur un élément de la destination
+type PreviewAction string
+
+const (
+	PreviewCreate    PreviewAction = "create"    // Élément absent de la destination
+	PreviewOverwrite PreviewAction = "overwrite" // Élément existant qui serait remplacé
+	PreviewUnchanged PreviewAction = "unchanged" // Élément identique (taille et date), laissé tel quel
+)
+
+// PreviewEntry décrit l'effet de la restauration sur un fichier ou lien symbolique
+type PreviewEntry struct {
+	Action        PreviewAction `json:"action"`
+	Path          string        `json:"path"`
+	Size          int64         `json:"size"`                    // Taille dans la sauvegarde
+	ModTime       time.Time     `json:"modTime"`                 // Date dans la sauvegarde
+	TargetSize    int64         `json:"targetSize,omitempty"`    // Taille actuelle dans la destination
+	TargetModTime *time.Time    `json:"targetModTime,omitempty"` // Date actuelle dans la destination
+	Diff          string        `json:"diff,omitempty"`          // Différence unifiée (actuel -> sauvegarde)
+}
+
+// Preview décrit ce qu'une restauration modifierait dans la destination, sans rien écrire
+type Preview struct {
+	BackupID    string         `json:"backupId"`
+	Target      string         `json:"target"`
+	Entries     []PreviewEntry `json:"entries"`
+	Created     int            `json:"created"`
+	Overwritten int            `json:"overwritten"`
+	Unchanged   int            `json:"unchanged"`
+}
+
+// PreviewRestore compare le contenu d'une sauvegarde à la destination de restauration.
+// Avec withDiff, la différence des petits fichiers texte remplacés est jointe au résultat.
+func PreviewRestore(backupID, targetPath string, opts Options, withDiff bool) (Preview, error) {
+	preview := Preview{BackupID: backupID}
+	info, err := findBackupByID(backupID)
+	if err != nil {
+		return preview, fmt.Errorf("impossible de trouver la sauvegarde: %w", err)
+	}
+	if targetPath == "" {
+		targetPath = info.SourcePath
+	}
+	if !common.IsValidPath(targetPath) {
+		return preview, fmt.Errorf("chemin de destination invalide ou non sécurisé: %s", targetPath)
+	}
+	preview.Target = targetPath
+	common.LogInfo("Aperçu de la restauration de %s vers %s.", backupID, targetPath)
+
+	walk, err := WalkContent(info)
+	if err != nil {
+		return preview, err
+	}
+
+	err = walk(func(rel string, fi os.FileInfo, target string, content io.Reader) error {
+		if !common.IsIncluded(rel, opts.Only) {
+			return nil
+		}
+		entry := PreviewEntry{Path: rel, Size: fi.Size(), ModTime: fi.ModTime()}
+
+		var data []byte
+		if content != nil && withDiff && fi.Size() <= maxDiffSize {
+			var readErr error
+			if data, readErr = io.ReadAll(content); readErr != nil {
+				return fmt.Errorf("impossible de lire %s: %w", rel, readErr)
+			}
+		}
+
+		dest := filepath.Join(targetPath, filepath.FromSlash(rel))
+		current, err := os.Lstat(dest)
+		switch {
+		case os.IsNotExist(err):
+			entry.Action = PreviewCreate
+			preview.Created++
+		case err != nil:
+			return err
+		default:
+			modTime := current.ModTime()
+			entry.TargetSize = current.Size()
+			entry.TargetModTime = &modTime
+			if sameContent(fi, target, entry, current, dest) {
+				entry.Action = PreviewUnchanged
+				preview.Unchanged++
+			} else {
+				entry.Action = PreviewOverwrite
+				preview.Overwritten++
+				if withDiff && data != nil {
+					entry.Diff = fileDiff(rel, dest, current, data)
+				}
+			}
+		}
+		preview.Entries = append(preview.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		common.LogError("Erreur lors de l'aperçu de la restauration de %s: %v", backupID, err)
+		return preview, fmt.Errorf("erreur lors de l'aperçu de la restauration: %w", err)
+	}
+	return preview, nil
+}
+
+// sameContent applique le test rapide de rsync: même type, même taille et même date à la seconde
+func sameContent(fi os.FileInfo, target string, entry PreviewEntry, current os.FileInfo, dest string) bool {
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if current.Mode()&os.ModeSymlink == 0 {
+			return false
+		}
+		link, err := os.Readlink(dest)
+		return err == nil && link == target
+	}
+	return current.Mode().IsRegular() && current.Size() == entry.Size && current.ModTime().Unix() == entry.ModTime.Unix()
+}
+
+// fileDiff renvoie la différence entre le fichier actuel et sa version sauvegardée,
+// si les deux sont des textes de taille raisonnable
+func fileDiff(rel, dest string, current os.FileInfo, data []byte) string {
+	if !current.Mode().IsRegular() || current.Size() > maxDiffSize || !isText(data) {
+		return ""
+	}
+	existing, err := os.ReadFile(dest)
+	if err != nil || !isText(existing) {
+		return ""
+	}
+	return unifiedDiff("a/"+rel+" (actuel)", "b/"+rel+" (sauvegarde)", existing, data)
+}
+
+// Print affiche le détail et le résumé de l'aperçu. Les éléments inchangés ne sont pas détaillés.
+func (p Preview) Print(w io.Writer) {
+	for _, e := range p.Entries {
+		switch e.Action {
+		case PreviewCreate:
+			fmt.Fprintf(w, "%-10s %s (%s)\n", "Créé", e.Path, common.FormatSize(e.Size))
+		case PreviewOverwrite:
+			delta := e.Size - e.TargetSize
+			sign := "+"
+			if delta < 0 {
+				sign, delta = "-", -delta
+			}
+			fmt.Fprintf(w, "%-10s %s (%s -> %s, %s%s, modifié le %s -> %s)\n", "Écrasé", e.Path,
+				common.FormatSize(e.TargetSize), common.FormatSize(e.Size), sign, common.FormatSize(delta),
+				e.TargetModTime.Format("02/01/2006 15:04:05"), e.ModTime.Format("02/01/2006 15:04:05"))
+			if e.Diff != "" {
+				fmt.Fprint(w, e.Diff)
+			}
+		}
+	}
+	fmt.Fprintf(w, "\nAperçu de la restauration de %s vers %s\n", p.BackupID, p.Target)
+	fmt.Fprintf(w, "%d créé(s), %d écrasé(s), %d inchangé(s).\n", p.Created, p.Overwritten, p.Unchanged)
+}
@@ -7,21 +7,61 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Noziop/s4v3my4ss/internal/chunkstore"
 	"github.com/Noziop/s4v3my4ss/internal/wrappers"
 	"github.com/Noziop/s4v3my4ss/pkg/common"
 )
 
-// RestoreBackup restaure une sauvegarde avec l'ID spécifié vers le chemin de destination
+// Options contient les paramètres d'une restauration
+type Options struct {
+	// Only limite la restauration aux chemins et motifs donnés (tout si vide).
+	// Les motifs sont relatifs à la racine de la sauvegarde et acceptent "*" et "**".
+	Only []string
+	// Conflict indique que faire des fichiers existants qui diffèrent de la sauvegarde
+	// (ConflictOverwrite si vide)
+	Conflict ConflictPolicy
+	// Owners attribue les fichiers restaurés à d'autres utilisateurs et normalise leurs permissions
+	Owners OwnerMapping
+}
+
+// Result décrit une restauration mise en place: la copie de retour arrière du contenu
+// précédent et le sort de chaque fichier modifié dans une destination existante
+type Result struct {
+	*Rollback
+	Files []FileDecision
+}
+
+// RestoreBackup restaure une sauvegarde avec l'ID spécifié vers le chemin de destination,
+// sans conserver de copie de retour arrière
 func RestoreBackup(backupID string, targetPath string) error {
+	result, err := RestoreBackupWithOptions(backupID, targetPath, Options{})
+	if err != nil {
+		return err
+	}
+	return result.Commit()
+}
+
+// RestoreBackupWithOptions restaure une sauvegarde vers le chemin de destination selon opts.
+// La restauration est préparée à côté de la destination puis mise en place d'un seul coup:
+// en cas d'échec, la destination reste intacte. Le contenu précédent est conservé dans la
+// copie de retour arrière renvoyée, à valider (Commit) ou annuler (Undo) par l'appelant.
+// Les fichiers existants qui diffèrent de la sauvegarde sont traités selon opts.Conflict, puis
+// propriétaires et permissions des fichiers restaurés ajustés selon opts.Owners.
+func RestoreBackupWithOptions(backupID string, targetPath string, opts Options) (*Result, error) {
 	common.LogInfo("Début de la restauration de la sauvegarde %s vers %s.", backupID, targetPath)
+	for _, pattern := range opts.Only {
+		if !common.IsValidExcludePattern(pattern) {
+			common.LogError("Motif de restauration invalide: %s", pattern)
+			return nil, fmt.Errorf("motif de restauration invalide: %s", pattern)
+		}
+	}
 	// Chercher la sauvegarde correspondante
 	backupInfo, err := findBackupByID(backupID)
 	if err != nil {
 		common.LogError("Impossible de trouver la sauvegarde %s: %v", backupID, err)
-		return fmt.Errorf("impossible de trouver la sauvegarde: %w", err)
+		return nil, fmt.Errorf("impossible de trouver la sauvegarde: %w", err)
 	}
 
-	// Créer le répertoire de destination si nécessaire
 	if targetPath == "" {
 		// Si aucun chemin de destination n'est spécifié, utiliser le chemin d'origine
 		targetPath = backupInfo.SourcePath
@@ -30,61 +70,94 @@ func RestoreBackup(backupID string, targetPath string) error {
 	// SECURITY: Valider le chemin de destination avant toute opération de fichier.
 	if !common.IsValidPath(targetPath) {
 		common.LogError("Chemin de destination invalide ou non sécurisé: %s", targetPath)
-		return fmt.Errorf("chemin de destination invalide ou non sécurisé: %s", targetPath)
+		return nil, fmt.Errorf("chemin de destination invalide ou non sécurisé: %s", targetPath)
 	}
 	// SECURITY: Vérifier si le chemin de destination est autorisé par la configuration de sécurité.
 	if !common.AppConfig.Security.IsPathAllowed(targetPath) {
 		common.LogSecurity("Tentative de restauration vers un chemin non autorisé: %s", targetPath)
-		return fmt.Errorf("le chemin de destination '%s' n'est pas autorisé par la politique de sécurité", targetPath)
+		return nil, fmt.Errorf("le chemin de destination '%s' n'est pas autorisé par la politique de sécurité", targetPath)
 	}
 
-	// Confirmer le remplacement si le répertoire existe déjà
-	if common.DirExists(targetPath) {
-		fmt.Printf("⚠️  Attention: Le répertoire '%s' existe déjà.\n", targetPath)
-		fmt.Printf("Toutes les données existantes seront écrasées.\n")
-		fmt.Print("Voulez-vous continuer? [o/N]: ")
-		
-		var response string
-		fmt.Scanln(&response)
-		
-		if !strings.EqualFold(response, "o") && !strings.EqualFold(response, "oui") {
-			common.LogInfo("Restauration annulée par l'utilisateur.")
-			return fmt.Errorf("restauration annulée par l'utilisateur")
+	// Le répertoire remplacé est celui désigné par un éventuel lien symbolique
+	targetPath = filepath.Clean(targetPath)
+	if resolved, err := filepath.EvalSymlinks(targetPath); err == nil {
+		targetPath = resolved
+	}
+
+	if opts.Conflict != "" {
+		if _, err := ParseConflictPolicy(string(opts.Conflict)); err != nil {
+			return nil, err
 		}
-	} else {
-		// Créer le répertoire s'il n'existe pas
-		if err := os.MkdirAll(targetPath, 0755); err != nil {
-			common.LogError("Impossible de créer le répertoire de destination %s: %v", targetPath, err)
-			return fmt.Errorf("impossible de créer le répertoire de destination: %w", err)
+	}
+	_, statErr := os.Stat(targetPath)
+	targetExists := statErr == nil
+
+	staging, err := prepareStaging(targetPath)
+	if err != nil {
+		common.LogError("Impossible de préparer la restauration vers %s: %v", targetPath, err)
+		return nil, err
+	}
+	common.LogInfo("Restauration préparée dans %s.", staging)
+
+	err = restoreInto(backupInfo, staging, opts)
+	if err == nil && targetExists {
+		err = completeStaging(staging, targetPath)
+	}
+	// Les fichiers modifiés sont comparés à la destination, encore intacte
+	var files []FileDecision
+	if err == nil && targetExists {
+		files, err = resolveConflicts(staging, targetPath, opts.Conflict, backupInfo.Time)
+	}
+	if err == nil && !opts.Owners.IsZero() {
+		err = applyOwnership(staging, targetPath, opts.Owners)
+	}
+	if err != nil {
+		if cleanErr := os.RemoveAll(staging); cleanErr != nil {
+			common.LogError("Erreur lors du nettoyage de %s: %v", staging, cleanErr)
 		}
-		common.LogInfo("Répertoire de destination %s créé.", targetPath)
+		common.LogInfo("Restauration interrompue, %s n'a pas été modifié.", targetPath)
+		return nil, err
+	}
+
+	rollback, err := swapIn(staging, targetPath)
+	if err != nil {
+		os.RemoveAll(staging)
+		common.LogError("Impossible de mettre en place la restauration dans %s: %v", targetPath, err)
+		return nil, err
+	}
+	if rollback.Path != "" {
+		common.LogInfo("Contenu précédent de %s conservé dans %s.", targetPath, rollback.Path)
+	}
+	return &Result{Rollback: rollback, Files: files}, nil
+}
+
+// restoreInto restaure le contenu d'une sauvegarde dans le répertoire targetPath
+func restoreInto(backupInfo common.BackupInfo, targetPath string, opts Options) error {
+	backupID := backupInfo.ID
+
+	// Les sauvegardes stockées sur un serveur distant sont lues avec rsync
+	if backupInfo.RemoteServer != nil {
+		return restoreFromRemote(backupInfo, targetPath, opts)
 	}
 
 	// Chemin de la sauvegarde
 	backupPath := backupInfo.BackupPath
 
+	// Les sauvegardes dédupliquées sont reconstituées directement depuis leur dépôt
+	if backupInfo.Format == common.FormatChunks {
+		return restoreFromRepository(backupInfo, targetPath, opts)
+	}
+
 	// SECURITY: Gérer le chiffrement si la sauvegarde est chiffrée
-	if backupInfo.Encrypted {
-		common.LogSecurity("Détection d'une sauvegarde chiffrée (%s). Tentative de déchiffrement...", backupID)
-		// Ici, vous intégreriez la logique de déchiffrement.
-		// Par exemple, en utilisant une bibliothèque de chiffrement et la clé AppConfig.EncryptionKey.
-		// Pour l'instant, c'est un placeholder.
-		common.LogError("Le déchiffrement n'est pas encore implémenté pour la sauvegarde %s.", backupID)
-		return fmt.Errorf("le déchiffrement n'est pas encore implémenté")
+	keyring, err := keyringFor(backupInfo)
+	if err != nil {
+		return err
 	}
 
 	// Vérifier si la sauvegarde est compressée
 	if backupInfo.Compression {
-		// Vérifier l'existence du fichier tar.gz
-		var compressedPath string
-		
-		// Vérifier si le chemin se termine déjà par .tar.gz
-		if strings.HasSuffix(backupPath, ".tar.gz") {
-			compressedPath = backupPath  // Utiliser directement le chemin existant
-		} else {
-			compressedPath = backupPath + ".tar.gz"  // Sinon ajouter l'extension
-		}
-		
+		// Vérifier l'existence de l'archive
+		compressedPath := archivePath(backupInfo)
 		if !common.FileExists(compressedPath) {
 			common.LogError("Fichier de sauvegarde compressé introuvable: %s", compressedPath)
 			return fmt.Errorf("fichier de sauvegarde compressé introuvable: %s", compressedPath)
@@ -98,10 +171,11 @@ func RestoreBackup(backupID string, targetPath string) error {
 			common.LogError("Impossible d'initialiser le module de décompression: %v", err)
 			return fmt.Errorf("impossible d'initialiser le module de décompression: %w", err)
 		}
+		compressor.Keyring = keyring
 		
 		// Décompresser dans un répertoire temporaire
 		tempDir := filepath.Join(common.TempDir, "restore_"+backupID)
-		if err := os.MkdirAll(tempDir, 0755); err != nil {
+		if err := os.MkdirAll(tempDir, 0700); err != nil {
 			common.LogError("Impossible de créer le répertoire temporaire %s: %v", tempDir, err)
 			return fmt.Errorf("impossible de créer le répertoire temporaire: %w", err)
 		}
@@ -116,27 +190,33 @@ func RestoreBackup(backupID string, targetPath string) error {
 			common.LogInfo("Répertoire temporaire %s nettoyé.", tempDir)
 		}()
 		
-		// Décompresser la sauvegarde
-		if err := compressor.Decompress(compressedPath, tempDir); err != nil {
+		// Décompresser la sauvegarde, en n'extrayant que les entrées demandées
+		var filter func(name string) bool
+		if len(opts.Only) > 0 {
+			// Les anciennes archives placent les fichiers sous un répertoire portant l'ID de la sauvegarde
+			legacyPrefix := legacyArchivePrefix(backupInfo)
+			filter = func(name string) bool {
+				return common.IsIncluded(name, opts.Only) || common.IsIncluded(strings.TrimPrefix(name, legacyPrefix), opts.Only)
+			}
+		}
+		if err := compressor.DecompressFiltered(compressedPath, tempDir, filter); err != nil {
 			common.LogError("Erreur lors de la décompression de %s: %v", compressedPath, err)
 			return fmt.Errorf("erreur lors de la décompression: %w", err)
 		}
 		common.LogInfo("Décompression de %s terminée avec succès dans %s.", compressedPath, tempDir)
 		
 		// Mettre à jour le chemin de la sauvegarde avec le chemin du répertoire décompressé
-		// Rechercher le répertoire décompressé (souvent le seul sous-répertoire)
 		entries, err := os.ReadDir(tempDir)
-		if err != nil || len(entries) == 0 {
+		if err != nil {
 			common.LogError("Erreur lors de l'accès au répertoire décompressé %s: %v", tempDir, err)
 			return fmt.Errorf("erreur lors de l'accès au répertoire décompressé: %w", err)
 		}
 		
-		// Utiliser le premier répertoire trouvé
-		for _, entry := range entries {
-			if entry.IsDir() {
-				backupPath = filepath.Join(tempDir, entry.Name())
-				break
-			}
+		// Les archives contiennent directement les fichiers sauvegardés. Les anciennes
+		// archives les plaçaient dans un unique répertoire portant l'ID de la sauvegarde.
+		backupPath = tempDir
+		if len(entries) == 1 && entries[0].IsDir() && entries[0].Name() == filepath.Base(strings.TrimSuffix(backupInfo.BackupPath, ".tar.gz")) {
+			backupPath = filepath.Join(tempDir, entries[0].Name())
 		}
 	} else {
 		// Vérifier l'existence du répertoire de sauvegarde
@@ -144,6 +224,27 @@ func RestoreBackup(backupID string, targetPath string) error {
 			common.LogError("Répertoire de sauvegarde introuvable: %s", backupPath)
 			return fmt.Errorf("répertoire de sauvegarde introuvable: %s", backupPath)
 		}
+		
+		// Déchiffrer la sauvegarde dans un répertoire temporaire avant la restauration
+		if keyring != nil {
+			tempDir := filepath.Join(common.TempDir, "restore_"+backupID)
+			if err := os.MkdirAll(tempDir, 0700); err != nil {
+				common.LogError("Impossible de créer le répertoire temporaire %s: %v", tempDir, err)
+				return fmt.Errorf("impossible de créer le répertoire temporaire: %w", err)
+			}
+			defer func() {
+				if err := os.RemoveAll(tempDir); err != nil {
+					common.LogError("Erreur lors du nettoyage du répertoire temporaire %s: %v", tempDir, err)
+				}
+			}()
+			
+			if err := keyring.DecryptTree(backupPath, tempDir); err != nil {
+				common.LogError("Erreur lors du déchiffrement de %s: %v", backupPath, err)
+				return fmt.Errorf("erreur lors du déchiffrement: %w", err)
+			}
+			common.LogInfo("Sauvegarde %s déchiffrée dans %s.", backupID, tempDir)
+			backupPath = tempDir
+		}
 	}
 
 	common.LogInfo("Restauration de '%s' (%s) vers '%s'...", 
@@ -154,7 +255,7 @@ func RestoreBackup(backupID string, targetPath string) error {
 	startTime := time.Now()
 
 	// Restaurer la sauvegarde
-	if err := wrappers.RsyncRestore(backupPath, targetPath, nil); err != nil {
+	if err := wrappers.RsyncRestore(backupPath, targetPath, wrappers.RestoreOptions{Include: opts.Only, NoOwner: !opts.Owners.keepsOwners()}, nil); err != nil {
 		common.LogError("Erreur lors de la restauration avec rsync de %s vers %s: %v", backupPath, targetPath, err)
 		return fmt.Errorf("erreur lors de la restauration avec rsync: %w", err)
 	}
@@ -164,6 +265,95 @@ func RestoreBackup(backupID string, targetPath string) error {
 	return nil
 }
 
+// restoreFromRepository restaure un instantané stocké dans un dépôt de blocs
+func restoreFromRepository(backupInfo common.BackupInfo, targetPath string, opts Options) error {
+	repo, err := chunkstore.Open(backupInfo.BackupPath)
+	if err != nil {
+		common.LogError("Impossible d'ouvrir le dépôt %s: %v", backupInfo.BackupPath, err)
+		return fmt.Errorf("impossible d'ouvrir le dépôt: %w", err)
+	}
+
+	startTime := time.Now()
+	var filter func(path string) bool
+	if len(opts.Only) > 0 {
+		filter = func(path string) bool { return common.IsIncluded(path, opts.Only) }
+	}
+	if err := repo.RestoreFiltered(backupInfo.ID, targetPath, filter); err != nil {
+		common.LogError("Erreur lors de la restauration de l'instantané %s: %v", backupInfo.ID, err)
+		return fmt.Errorf("erreur lors de la restauration depuis le dépôt: %w", err)
+	}
+
+	common.LogInfo("Restauration terminée avec succès en %v.", formatDuration(time.Since(startTime)))
+	return nil
+}
+
+// restoreFromRemote restaure une sauvegarde stockée sur un serveur distant. Un répertoire en
+// clair est restauré directement; une archive ou un répertoire chiffré est d'abord récupéré
+// dans un répertoire temporaire, puis restauré comme une sauvegarde locale.
+func restoreFromRemote(backupInfo common.BackupInfo, targetPath string, opts Options) error {
+	server := backupInfo.RemoteServer
+	_, isArchive := wrappers.FormatFromPath(strings.TrimSuffix(backupInfo.BackupPath, "/"))
+
+	if !isArchive && !backupInfo.Encrypted {
+		common.LogInfo("Restauration de %s depuis le serveur %s (%s)...", backupInfo.ID, server.Name, server.IP)
+		// Pour une sauvegarde distante, la compression désigne celle du transfert rsync
+		rsyncOpts := wrappers.RestoreOptions{Include: opts.Only, Compression: backupInfo.Compression, NoOwner: !opts.Owners.keepsOwners()}
+		startTime := time.Now()
+		if err := wrappers.RsyncRestore(backupInfo.BackupPath, targetPath, rsyncOpts, server); err != nil {
+			common.LogError("Erreur lors de la restauration de %s depuis %s: %v", backupInfo.ID, server.Name, err)
+			return fmt.Errorf("erreur lors de la restauration depuis le serveur %s: %w", server.Name, err)
+		}
+		common.LogInfo("Restauration terminée avec succès en %v.", formatDuration(time.Since(startTime)))
+		return nil
+	}
+
+	local, cleanup, err := fetchRemote(backupInfo)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return restoreInto(local, targetPath, opts)
+}
+
+// fetchRemote récupère une sauvegarde distante dans un répertoire temporaire et renvoie la
+// description de cette copie locale, ainsi que la fonction qui la supprime
+func fetchRemote(backupInfo common.BackupInfo) (common.BackupInfo, func(), error) {
+	server := backupInfo.RemoteServer
+	_, isArchive := wrappers.FormatFromPath(strings.TrimSuffix(backupInfo.BackupPath, "/"))
+
+	fetchDir := filepath.Join(common.TempDir, "fetch_"+backupInfo.ID)
+	cleanup := func() {
+		if err := os.RemoveAll(fetchDir); err != nil {
+			common.LogError("Erreur lors du nettoyage du répertoire temporaire %s: %v", fetchDir, err)
+		}
+	}
+	localPath, err := wrappers.RsyncFetch(backupInfo.BackupPath, fetchDir, server)
+	if err != nil {
+		cleanup()
+		return common.BackupInfo{}, nil, fmt.Errorf("impossible de récupérer la sauvegarde depuis le serveur %s: %w", server.Name, err)
+	}
+	common.LogInfo("Sauvegarde %s récupérée dans %s.", backupInfo.ID, localPath)
+
+	local := backupInfo
+	local.BackupPath = localPath
+	local.RemoteServer = nil
+	local.Compression = isArchive
+	return local, cleanup, nil
+}
+
+// ResolveTarget renvoie la destination d'une restauration: targetPath, ou à défaut
+// l'emplacement d'origine de la sauvegarde
+func ResolveTarget(backupID, targetPath string) (string, error) {
+	if targetPath != "" {
+		return targetPath, nil
+	}
+	backupInfo, err := findBackupByID(backupID)
+	if err != nil {
+		return "", fmt.Errorf("impossible de trouver la sauvegarde: %w", err)
+	}
+	return backupInfo.SourcePath, nil
+}
+
 // GetAvailableBackups récupère la liste des sauvegardes disponibles
 func GetAvailableBackups() ([]common.BackupInfo, error) {
 	common.LogInfo("Récupération de la liste des sauvegardes disponibles.")
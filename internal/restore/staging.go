@@ -0,0 +1,274 @@
+package restore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// errExchangeUnsupported indique que le système ne sait pas échanger deux répertoires
+var errExchangeUnsupported = errors.New("échange de répertoires non pris en charge")
+
+// Rollback conserve le contenu qu'avait la destination avant d'être remplacée par une
+// restauration, le temps que l'utilisateur valide le résultat
+type Rollback struct {
+	Target string `json:"target"`
+	Path   string `json:"path,omitempty"` // Copie du contenu précédent, vide si la destination n'existait pas
+}
+
+// Commit valide la restauration et supprime la copie du contenu précédent
+func (r *Rollback) Commit() error {
+	if r == nil || r.Path == "" {
+		return nil
+	}
+	if err := os.RemoveAll(r.Path); err != nil {
+		common.LogError("Impossible de supprimer la copie de retour arrière %s: %v", r.Path, err)
+		return fmt.Errorf("impossible de supprimer la copie de retour arrière: %w", err)
+	}
+	common.LogInfo("Restauration de %s validée, copie de retour arrière %s supprimée.", r.Target, r.Path)
+	r.Path = ""
+	return nil
+}
+
+// Undo annule la restauration en remettant en place le contenu précédent de la destination
+func (r *Rollback) Undo() error {
+	if r == nil {
+		return nil
+	}
+	if r.Path == "" {
+		// La destination n'existait pas avant la restauration
+		if err := os.RemoveAll(r.Target); err != nil {
+			return fmt.Errorf("impossible de supprimer %s: %w", r.Target, err)
+		}
+		common.LogInfo("Restauration de %s annulée.", r.Target)
+		return nil
+	}
+
+	restored := stagingPath(r.Target)
+	if err := os.RemoveAll(restored); err != nil {
+		return fmt.Errorf("impossible de préparer le retour arrière: %w", err)
+	}
+	if err := replaceDir(r.Path, r.Target, restored); err != nil {
+		return fmt.Errorf("impossible de remettre en place %s: %w", r.Path, err)
+	}
+	if err := os.RemoveAll(restored); err != nil {
+		common.LogWarning("Impossible de supprimer le contenu restauré %s: %v", restored, err)
+	}
+	common.LogInfo("Restauration de %s annulée, contenu précédent remis en place.", r.Target)
+	r.Path = ""
+	return nil
+}
+
+// stagingPath renvoie le répertoire, à côté de la destination, dans lequel la restauration est préparée
+func stagingPath(target string) string {
+	return filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".saveme-staging")
+}
+
+// rollbackPath renvoie le répertoire, à côté de la destination, qui conserve son contenu précédent
+func rollbackPath(target string) string {
+	return filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".saveme-rollback")
+}
+
+// prepareStaging crée le répertoire vide dans lequel la restauration est préparée, à côté
+// de la destination pour que le remplacement final se fasse par renommage
+func prepareStaging(target string) (string, error) {
+	staging := stagingPath(target)
+	if err := recoverRollback(target); err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(rollbackPath(target)); err == nil {
+		return "", fmt.Errorf("une copie de retour arrière d'une restauration précédente existe déjà: %s (supprimez-la ou remettez-la en place)", rollbackPath(target))
+	}
+	// Reste d'une restauration interrompue: la destination n'a pas été modifiée
+	if err := os.RemoveAll(staging); err != nil {
+		return "", fmt.Errorf("impossible de supprimer %s: %w", staging, err)
+	}
+
+	perm := os.FileMode(0755)
+	info, err := os.Stat(target)
+	switch {
+	case os.IsNotExist(err):
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", fmt.Errorf("impossible de créer le répertoire de destination: %w", err)
+		}
+	case err != nil:
+		return "", err
+	case !info.IsDir():
+		return "", fmt.Errorf("la destination %s n'est pas un répertoire", target)
+	default:
+		perm = info.Mode().Perm() | 0700
+	}
+
+	if err := os.Mkdir(staging, perm); err != nil {
+		return "", fmt.Errorf("impossible de créer le répertoire de préparation: %w", err)
+	}
+	return staging, nil
+}
+
+// completeStaging ajoute au répertoire de préparation, une fois la restauration terminée, les
+// fichiers de la destination qu'elle n'a pas restaurés (absents de la sauvegarde ou non
+// sélectionnés), pour qu'ils soient conservés
+func completeStaging(staging, target string) error {
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		return nil
+	}
+	if err := linkMissing(target, staging); err != nil {
+		return fmt.Errorf("impossible de reprendre le contenu de %s: %w", target, err)
+	}
+	return nil
+}
+
+// recoverRollback remet en place la copie de retour arrière qu'une restauration interrompue
+// pendant le remplacement a laissée sans destination
+func recoverRollback(target string) error {
+	rollback := rollbackPath(target)
+	if _, err := os.Lstat(rollback); err != nil {
+		return nil
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		return nil
+	}
+	common.LogWarning("Restauration interrompue: remise en place de %s dans %s.", rollback, target)
+	if err := os.Rename(rollback, target); err != nil {
+		return fmt.Errorf("impossible de remettre en place %s: %w", rollback, err)
+	}
+	return nil
+}
+
+// swapIn remplace la destination par le répertoire de préparation. Le contenu précédent est
+// conservé dans la copie de retour arrière, et remis en place si le remplacement échoue.
+func swapIn(staging, target string) (*Rollback, error) {
+	rollback := &Rollback{Target: target}
+	if _, err := os.Lstat(target); os.IsNotExist(err) {
+		if err := os.Rename(staging, target); err != nil {
+			return nil, fmt.Errorf("impossible de mettre en place la restauration: %w", err)
+		}
+		return rollback, nil
+	}
+	rollback.Path = rollbackPath(target)
+	if err := replaceDir(staging, target, rollback.Path); err != nil {
+		return nil, fmt.Errorf("impossible de mettre en place la restauration dans %s (point de montage?): %w", target, err)
+	}
+	return rollback, nil
+}
+
+// replaceDir met le répertoire src à la place de dst, dont le contenu est déplacé dans old.
+// Les deux répertoires sont échangés en une seule opération (renameat2 avec RENAME_EXCHANGE),
+// dst existe donc à tout instant. Si le système ou le système de fichiers ne le permet pas,
+// dst est renommé en old puis src en dst: une interruption entre les deux laisse old sans
+// dst, ce que recoverRollback corrige au début de la restauration suivante.
+func replaceDir(src, dst, old string) error {
+	err := exchange(src, dst)
+	if err == nil {
+		// src contient désormais le contenu précédent de dst
+		if err := os.Rename(src, old); err != nil {
+			exchange(src, dst)
+			return err
+		}
+		return nil
+	}
+	if !errors.Is(err, errExchangeUnsupported) && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOSYS) {
+		return err
+	}
+
+	if err := os.Rename(dst, old); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		os.Rename(old, dst)
+		return err
+	}
+	return nil
+}
+
+// linkMissing reproduit dans dst les entrées de src qui n'y existent pas encore. Les fichiers
+// sont partagés par liens physiques, ou copiés si c'est impossible. Comme la restauration est
+// terminée, seuls des fichiers qu'elle n'a pas écrits sont partagés: ni leur contenu ni leurs
+// attributs ne sont modifiés ensuite, ce qui laisse intact le contenu de src.
+func linkMissing(src, dst string) error {
+	var dirs []string
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(dst, rel)
+
+		// Une entrée restaurée remplace celle de la destination, et tout son contenu
+		if existing, err := os.Lstat(dest); err == nil {
+			if info.IsDir() && !existing.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if err := os.Mkdir(dest, mode.Perm()|0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, rel)
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, dest)
+		case mode.IsRegular():
+			if err := os.Link(path, dest); err != nil {
+				return copyFile(path, dest, info)
+			}
+		default:
+			// Sockets, tubes et périphériques restent dans la copie de retour arrière
+			common.LogWarning("Fichier spécial non repris dans la restauration: %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Permissions et dates des répertoires créés, une fois leur contenu en place
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := os.Stat(filepath.Join(src, dirs[i]))
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(dst, dirs[i])
+		os.Chmod(dest, info.Mode().Perm())
+		os.Chtimes(dest, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+// copyFile copie un fichier régulier avec ses permissions et sa date de modification
+func copyFile(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,8 @@
+package restore
+
+import "golang.org/x/sys/unix"
+
+// exchange échange les répertoires a et b en une seule opération
+func exchange(a, b string) error {
+	return unix.Renameat2(unix.AT_FDCWD, a, unix.AT_FDCWD, b, unix.RENAME_EXCHANGE)
+}
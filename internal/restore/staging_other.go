@@ -0,0 +1,8 @@
+//go:build !linux
+
+package restore
+
+// exchange n'est disponible que sous Linux: le remplacement se fait en deux renommages
+func exchange(a, b string) error {
+	return errExchangeUnsupported
+}
@@ -0,0 +1,199 @@
+package restore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestStagingSwapAndUndo(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "data")
+	writeTestFile(t, filepath.Join(target, "kept.txt"), "kept")
+	writeTestFile(t, filepath.Join(target, "sub", "changed.txt"), "before")
+
+	staging, err := prepareStaging(target)
+	if err != nil {
+		t.Fatalf("prepareStaging() error = %v", err)
+	}
+	writeTestFile(t, filepath.Join(staging, "sub", "changed.txt"), "after")
+	if err := completeStaging(staging, target); err != nil {
+		t.Fatalf("completeStaging() error = %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(staging, "kept.txt")); got != "kept" {
+		t.Errorf("staging kept.txt = %q, want %q", got, "kept")
+	}
+	if got := readTestFile(t, filepath.Join(target, "sub", "changed.txt")); got != "before" {
+		t.Fatalf("target modified before swap: %q", got)
+	}
+
+	rollback, err := swapIn(staging, target)
+	if err != nil {
+		t.Fatalf("swapIn() error = %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(target, "sub", "changed.txt")); got != "after" {
+		t.Errorf("restored changed.txt = %q, want %q", got, "after")
+	}
+	if got := readTestFile(t, filepath.Join(rollback.Path, "sub", "changed.txt")); got != "before" {
+		t.Errorf("rollback changed.txt = %q, want %q", got, "before")
+	}
+
+	// Une seconde restauration est refusée tant que la précédente n'est pas validée
+	if _, err := prepareStaging(target); err == nil {
+		t.Error("prepareStaging() with a pending rollback succeeded, want error")
+	}
+
+	if err := rollback.Undo(); err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(target, "sub", "changed.txt")); got != "before" {
+		t.Errorf("changed.txt after undo = %q, want %q", got, "before")
+	}
+	if _, err := os.Lstat(rollbackPath(target)); !os.IsNotExist(err) {
+		t.Errorf("rollback copy still present after undo")
+	}
+}
+
+func TestStagingCommitNewTarget(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "new", "data")
+
+	staging, err := prepareStaging(target)
+	if err != nil {
+		t.Fatalf("prepareStaging() error = %v", err)
+	}
+	writeTestFile(t, filepath.Join(staging, "file.txt"), "content")
+
+	rollback, err := swapIn(staging, target)
+	if err != nil {
+		t.Fatalf("swapIn() error = %v", err)
+	}
+	if rollback.Path != "" {
+		t.Errorf("rollback.Path = %q for a new target, want empty", rollback.Path)
+	}
+	if err := rollback.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(target, "file.txt")); got != "content" {
+		t.Errorf("file.txt = %q, want %q", got, "content")
+	}
+}
+
+func TestStagingNeverSharesRestoredFiles(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "data")
+	writeTestFile(t, filepath.Join(target, "restored.txt"), "same content")
+	writeTestFile(t, filepath.Join(target, "kept", "file.txt"), "kept")
+
+	staging, err := prepareStaging(target)
+	if err != nil {
+		t.Fatalf("prepareStaging() error = %v", err)
+	}
+	// rsync -a applique permissions et dates sur place aux fichiers déjà présents
+	restored := filepath.Join(staging, "restored.txt")
+	writeTestFile(t, restored, "same content")
+	if err := completeStaging(staging, target); err != nil {
+		t.Fatalf("completeStaging() error = %v", err)
+	}
+	if err := os.Chmod(restored, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(target, "restored.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("target restored.txt mode = %o, want 644", info.Mode().Perm())
+	}
+	staged, err := os.Stat(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(info, staged) {
+		t.Error("restored file shares its inode with the target")
+	}
+
+	// Les fichiers non restaurés sont repris, sans être copiés
+	kept, err := os.Stat(filepath.Join(staging, "kept", "file.txt"))
+	if err != nil {
+		t.Fatalf("kept file missing from staging: %v", err)
+	}
+	original, err := os.Stat(filepath.Join(target, "kept", "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(kept, original) {
+		t.Error("kept file was copied instead of linked")
+	}
+}
+
+func TestReplaceDirKeepsTargetInPlace(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "data")
+	staging := filepath.Join(dir, "staging")
+	writeTestFile(t, filepath.Join(target, "file.txt"), "before")
+	writeTestFile(t, filepath.Join(staging, "file.txt"), "after")
+
+	if err := exchange(staging, target); errors.Is(err, errExchangeUnsupported) {
+		t.Skip("renameat2 not available")
+	} else if err != nil {
+		t.Fatalf("exchange() error = %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(target, "file.txt")); got != "after" {
+		t.Errorf("target file.txt after exchange = %q, want %q", got, "after")
+	}
+	if got := readTestFile(t, filepath.Join(staging, "file.txt")); got != "before" {
+		t.Errorf("staging file.txt after exchange = %q, want %q", got, "before")
+	}
+
+	old := filepath.Join(dir, "old")
+	if err := replaceDir(staging, target, old); err != nil {
+		t.Fatalf("replaceDir() error = %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(target, "file.txt")); got != "before" {
+		t.Errorf("target file.txt = %q, want %q", got, "before")
+	}
+	if got := readTestFile(t, filepath.Join(old, "file.txt")); got != "after" {
+		t.Errorf("old file.txt = %q, want %q", got, "after")
+	}
+	if _, err := os.Lstat(staging); !os.IsNotExist(err) {
+		t.Errorf("staging still present after replaceDir")
+	}
+}
+
+func TestPrepareStagingRecoversInterruptedSwap(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "data")
+	writeTestFile(t, filepath.Join(target, "file.txt"), "original")
+
+	// Interruption entre les deux renommages: la destination n'existe plus
+	if err := os.Rename(target, rollbackPath(target)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prepareStaging(target); err != nil {
+		t.Fatalf("prepareStaging() error = %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(target, "file.txt")); got != "original" {
+		t.Errorf("file.txt = %q, want %q", got, "original")
+	}
+	if _, err := os.Lstat(rollbackPath(target)); !os.IsNotExist(err) {
+		t.Errorf("rollback copy still present after recovery")
+	}
+}
@@ -0,0 +1,350 @@
+package serve
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/internal/restore"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// snapshotLayout est le format du nom de répertoire d'une sauvegarde: sa date
+const snapshotLayout = "2006-01-02_15-04-05"
+
+// allowedMethods sont les méthodes acceptées par le serveur, en lecture seule
+const allowedMethods = "OPTIONS, GET, HEAD, PROPFIND"
+
+// node est un fichier ou un répertoire de l'arborescence exposée
+type node struct {
+	name     string
+	dir      bool
+	size     int64
+	modTime  time.Time
+	children map[string]*node
+}
+
+// sortedChildren renvoie les éléments d'un répertoire triés par nom
+func (n *node) sortedChildren() []*node {
+	children := make([]*node, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+	return children
+}
+
+// index est l'arborescence d'une sauvegarde, construite à la première consultation
+type index struct {
+	once sync.Once
+	root *node
+	err  error
+}
+
+// Server expose les sauvegardes locales du catalogue en lecture seule, en HTTP et en WebDAV,
+// sous la forme /<configuration>/<date>/... Les sauvegardes ne sont jamais extraites:
+// les archives et dépôts sont lus directement.
+type Server struct {
+	mu      sync.Mutex
+	indexes map[string]*index // Par ID de sauvegarde; une sauvegarde ne change pas
+}
+
+// NewServer crée un serveur de consultation des sauvegardes
+func NewServer() *Server {
+	return &Server{indexes: make(map[string]*index)}
+}
+
+// ListenAndServe expose les sauvegardes sur l'adresse addr jusqu'à l'arrêt du programme
+func ListenAndServe(addr string) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           NewServer(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	common.LogInfo("Serveur de consultation des sauvegardes à l'écoute sur %s.", addr)
+	return server.ListenAndServe()
+}
+
+// IsLoopback indique si l'adresse d'écoute n'est joignable que depuis la machine locale
+func IsLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// resource est l'élément désigné par une URL: un nœud et, sous une sauvegarde, celle-ci
+type resource struct {
+	node   *node
+	backup *common.BackupInfo
+	rel    string // Chemin relatif à la racine de la sauvegarde
+}
+
+// ServeHTTP répond aux requêtes HTTP et WebDAV
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	common.LogInfo("%s %s depuis %s", r.Method, r.URL.Path, r.RemoteAddr)
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("DAV", "1")
+		w.Header().Set("Allow", allowedMethods)
+		w.Header().Set("MS-Author-Via", "DAV")
+		w.WriteHeader(http.StatusOK)
+		return
+	case http.MethodGet, http.MethodHead, "PROPFIND":
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, "Serveur en lecture seule", http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlPath := path.Clean("/" + r.URL.Path)
+	res, err := s.resolve(urlPath)
+	if err != nil {
+		common.LogError("Impossible de lire %s: %v", urlPath, err)
+		http.Error(w, "Erreur de lecture de la sauvegarde", http.StatusInternalServerError)
+		return
+	}
+	if res.node == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == "PROPFIND" {
+		s.propfind(w, r, urlPath, res)
+		return
+	}
+	if res.node.dir {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, hrefFor(urlPath, true), http.StatusMovedPermanently)
+			return
+		}
+		s.serveListing(w, r, urlPath, res.node)
+		return
+	}
+	s.serveFile(w, r, res)
+}
+
+// resolve trouve l'élément désigné par un chemin d'URL, ou un nœud nil s'il n'existe pas
+func (s *Server) resolve(urlPath string) (resource, error) {
+	var parts []string
+	if trimmed := strings.Trim(urlPath, "/"); trimmed != "" {
+		parts = strings.Split(trimmed, "/")
+	}
+
+	catalog, err := s.catalog()
+	if err != nil {
+		return resource{}, err
+	}
+	root := &node{name: "", dir: true, children: make(map[string]*node)}
+	for name, snapshots := range catalog {
+		config := &node{name: name, dir: true, children: make(map[string]*node)}
+		for snapshotName, b := range snapshots {
+			config.children[snapshotName] = &node{name: snapshotName, dir: true, modTime: b.Time}
+			if b.Time.After(config.modTime) {
+				config.modTime = b.Time
+			}
+		}
+		root.children[name] = config
+	}
+	if len(parts) < 2 {
+		current := root
+		for _, part := range parts {
+			if current = current.children[part]; current == nil {
+				return resource{}, nil
+			}
+		}
+		return resource{node: current}, nil
+	}
+
+	b, ok := catalog[parts[0]][parts[1]]
+	if !ok {
+		return resource{}, nil
+	}
+	current, err := s.index(b)
+	if err != nil {
+		return resource{}, err
+	}
+	for _, part := range parts[2:] {
+		if current = current.children[part]; current == nil {
+			return resource{}, nil
+		}
+	}
+	return resource{node: current, backup: &b, rel: strings.Join(parts[2:], "/")}, nil
+}
+
+// catalog renvoie les sauvegardes locales par configuration puis par nom de répertoire
+func (s *Server) catalog() (map[string]map[string]common.BackupInfo, error) {
+	backups, err := common.ListBackups()
+	if err != nil {
+		return nil, fmt.Errorf("impossible de lister les sauvegardes: %w", err)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.Before(backups[j].Time) })
+
+	catalog := make(map[string]map[string]common.BackupInfo)
+	for _, b := range backups {
+		// Le contenu des sauvegardes distantes n'est pas accessible sans les rapatrier
+		if b.RemoteServer != nil || b.Name == "" {
+			continue
+		}
+		if catalog[b.Name] == nil {
+			catalog[b.Name] = make(map[string]common.BackupInfo)
+		}
+		name := b.Time.Format(snapshotLayout)
+		if _, taken := catalog[b.Name][name]; taken {
+			name = b.ID
+		}
+		catalog[b.Name][name] = b
+	}
+	return catalog, nil
+}
+
+// index renvoie l'arborescence d'une sauvegarde, construite une seule fois
+func (s *Server) index(b common.BackupInfo) (*node, error) {
+	s.mu.Lock()
+	idx, ok := s.indexes[b.ID]
+	if !ok {
+		idx = &index{}
+		s.indexes[b.ID] = idx
+	}
+	s.mu.Unlock()
+
+	idx.once.Do(func() {
+		idx.root, idx.err = buildIndex(b)
+	})
+	return idx.root, idx.err
+}
+
+// buildIndex parcourt le contenu d'une sauvegarde pour en construire l'arborescence.
+// Les liens symboliques ne sont pas exposés.
+func buildIndex(b common.BackupInfo) (*node, error) {
+	common.LogInfo("Lecture du contenu de la sauvegarde %s.", b.ID)
+	walk, err := restore.WalkContent(b)
+	if err != nil {
+		return nil, err
+	}
+	root := &node{dir: true, modTime: b.Time, children: make(map[string]*node)}
+	err = walk(func(rel string, fi os.FileInfo, target string, content io.Reader) error {
+		if content == nil {
+			return nil
+		}
+		parts := strings.Split(rel, "/")
+		current := root
+		for _, part := range parts[:len(parts)-1] {
+			child := current.children[part]
+			if child == nil {
+				child = &node{name: part, dir: true, modTime: b.Time, children: make(map[string]*node)}
+				current.children[part] = child
+			}
+			current = child
+		}
+		name := parts[len(parts)-1]
+		current.children[name] = &node{name: name, size: fi.Size(), modTime: fi.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// serveFile envoie le contenu d'un fichier d'une sauvegarde
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, res resource) {
+	b := res.backup
+	// Les fichiers d'une sauvegarde en répertoire non chiffrée sont servis tels quels,
+	// avec prise en charge des requêtes partielles
+	if !b.Compression && !b.Encrypted && b.Format != common.FormatChunks {
+		file, err := os.Open(filepath.Join(b.BackupPath, filepath.FromSlash(res.rel)))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer file.Close()
+		http.ServeContent(w, r, res.node.name, res.node.modTime, file)
+		return
+	}
+
+	if contentType := mime.TypeByExtension(path.Ext(res.node.name)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(res.node.size))
+	w.Header().Set("Last-Modified", res.node.modTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "none")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := restore.ReadBackupFile(*b, res.rel, w); err != nil {
+		// L'en-tête est déjà envoyé: l'interruption du transfert signale l'erreur au client
+		common.LogError("Erreur lors de l'envoi de %s depuis %s: %v", res.rel, b.ID, err)
+	}
+}
+
+// listingTemplate est la page de contenu d'un répertoire
+var listingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Path}}</title></head>
+<body><h1>{{.Path}}</h1>
+<table>
+<tr><th align="left">Nom</th><th align="right">Taille</th><th align="left">Modifié le</th></tr>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>{{end}}
+{{range .Entries}}<tr><td><a href="{{.Href}}">{{.Name}}</a></td><td align="right">{{.Size}}</td><td>{{.ModTime}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+// listingEntry est une ligne de la page de contenu d'un répertoire
+type listingEntry struct {
+	Name, Href, Size, ModTime string
+}
+
+// serveListing affiche le contenu d'un répertoire
+func (s *Server) serveListing(w http.ResponseWriter, r *http.Request, urlPath string, n *node) {
+	var entries []listingEntry
+	for _, child := range n.sortedChildren() {
+		// "./" évite qu'un nom contenant ":" soit pris pour un schéma d'URL
+		entry := listingEntry{Name: child.name, Href: "./" + hrefFor(child.name, child.dir)}
+		if child.dir {
+			entry.Name += "/"
+		} else {
+			entry.Size = common.FormatSize(child.size)
+		}
+		if !child.modTime.IsZero() {
+			entry.ModTime = child.modTime.Format("02/01/2006 15:04")
+		}
+		entries = append(entries, entry)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := listingTemplate.Execute(w, struct {
+		Path    string
+		Entries []listingEntry
+	}{hrefFor(urlPath, true), entries}); err != nil {
+		common.LogError("Erreur lors de l'affichage de %s: %v", urlPath, err)
+	}
+}
+
+// hrefFor encode un chemin pour une URL, avec un slash final pour un répertoire
+func hrefFor(p string, dir bool) string {
+	if dir && !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return (&url.URL{Path: p}).EscapedPath()
+}
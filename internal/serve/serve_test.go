@@ -0,0 +1,85 @@
+package serve
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/internal/wrappers"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+func TestServeArchive(t *testing.T) {
+	source := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(source, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "etc", "app.conf"), []byte("port = 8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "docs_20240102.tar.gz")
+	cw, err := wrappers.NewCompressionWrapper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Compress(source, archive, wrappers.FormatTarGz); err != nil {
+		t.Fatal(err)
+	}
+	common.BackupInfoDir = t.TempDir()
+	when := time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local)
+	info := common.BackupInfo{ID: "docs_20240102", Name: "docs", BackupPath: archive, Compression: true, Time: when}
+	if err := common.SaveBackupInfo(info); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(NewServer())
+	defer server.Close()
+
+	get := func(method, path string, header map[string]string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get("GET", "/docs/2024-01-02_10-00-00/etc/app.conf", nil)
+	if resp.StatusCode != http.StatusOK || body != "port = 8080\n" {
+		t.Errorf("GET file = %d %q", resp.StatusCode, body)
+	}
+
+	resp, body = get("GET", "/docs/", nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "2024-01-02_10-00-00/") {
+		t.Errorf("GET listing = %d, missing snapshot: %s", resp.StatusCode, body)
+	}
+
+	resp, body = get("PROPFIND", "/docs/2024-01-02_10-00-00/etc/", map[string]string{"Depth": "1"})
+	if resp.StatusCode != http.StatusMultiStatus ||
+		!strings.Contains(body, "<D:href>/docs/2024-01-02_10-00-00/etc/app.conf</D:href>") ||
+		!strings.Contains(body, "<D:getcontentlength>12</D:getcontentlength>") {
+		t.Errorf("PROPFIND = %d %s", resp.StatusCode, body)
+	}
+
+	if resp, _ := get("PUT", "/docs/x", nil); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("PUT status = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+	if resp, _ := get("GET", "/docs/2024-01-02_10-00-00/missing", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET missing status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
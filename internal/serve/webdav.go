@@ -0,0 +1,85 @@
+package serve
+
+import (
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// multistatus est la réponse à une requête PROPFIND (RFC 4918)
+type multistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	DAV       string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href     string      `xml:"D:href"`
+	Propstat davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"D:prop"`
+	Status string  `xml:"D:status"`
+}
+
+type davProp struct {
+	DisplayName   string          `xml:"D:displayname"`
+	ResourceType  davResourceType `xml:"D:resourcetype"`
+	ContentLength *int64          `xml:"D:getcontentlength,omitempty"`
+	ContentType   string          `xml:"D:getcontenttype,omitempty"`
+	LastModified  string          `xml:"D:getlastmodified,omitempty"`
+}
+
+type davResourceType struct {
+	Collection *struct{} `xml:"D:collection"`
+}
+
+// propfind décrit un élément et, avec une profondeur de 1, le contenu d'un répertoire.
+// Toutes les propriétés sont renvoyées, quelle que soit la demande. Une profondeur infinie
+// est traitée comme une profondeur de 1, pour ne pas parcourir tout le catalogue.
+func (s *Server) propfind(w http.ResponseWriter, r *http.Request, urlPath string, res resource) {
+	status := multistatus{DAV: "DAV:"}
+	status.Responses = append(status.Responses, davEntry(urlPath, path.Base(urlPath), res.node))
+	if res.node.dir && r.Header.Get("Depth") != "0" {
+		for _, child := range res.node.sortedChildren() {
+			status.Responses = append(status.Responses, davEntry(path.Join(urlPath, child.name), child.name, child))
+		}
+	}
+
+	data, err := xml.Marshal(status)
+	if err != nil {
+		common.LogError("Erreur lors de la génération de la réponse WebDAV pour %s: %v", urlPath, err)
+		http.Error(w, "Erreur interne", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+// davEntry décrit les propriétés WebDAV d'un élément
+func davEntry(urlPath, name string, n *node) davResponse {
+	prop := davProp{DisplayName: name}
+	if !n.modTime.IsZero() {
+		prop.LastModified = n.modTime.UTC().Format(http.TimeFormat)
+	}
+	if n.dir {
+		prop.ResourceType.Collection = &struct{}{}
+	} else {
+		size := n.size
+		prop.ContentLength = &size
+		prop.ContentType = mime.TypeByExtension(path.Ext(name))
+		if prop.ContentType == "" {
+			prop.ContentType = "application/octet-stream"
+		}
+	}
+	return davResponse{
+		Href:     hrefFor(urlPath, n.dir),
+		Propstat: davPropstat{Prop: prop, Status: "HTTP/1.1 200 OK"},
+	}
+}
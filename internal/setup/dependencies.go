@@ -20,9 +20,7 @@ func CheckDependencies() {
 		desc    string
 	}{
 		{"rsync", "rsync", "Outil de synchronisation de fichiers"},
-		{"inotifywait", "inotify-tools", "Surveillance des fichiers et répertoires"},
 		{"jq", "jq", "Traitement JSON"},
-		{"tar", "tar", "Compression et archivage"},
 	}
 
 	for _, dep := range deps {
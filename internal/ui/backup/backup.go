@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 
+	corebackup "github.com/Noziop/s4v3my4ss/internal/backup"
 	"github.com/Noziop/s4v3my4ss/internal/ui/display"
 	"github.com/Noziop/s4v3my4ss/internal/ui/input"
 	"github.com/Noziop/s4v3my4ss/pkg/common"
@@ -18,8 +19,9 @@ func ManageBackupsInteractive() {
 		fmt.Printf("%sGestion des sauvegardes%s\n\n", display.ColorBold(), display.ColorReset())
 
 		fmt.Printf("  %s1.%s Lister les sauvegardes\n", display.ColorGreen(), display.ColorReset())
-		fmt.Printf("  %s2.%s Supprimer une sauvegarde\n", display.ColorGreen(), display.ColorReset())
-		fmt.Printf("  %s3.%s Nettoyer les anciennes sauvegardes\n", display.ColorGreen(), display.ColorReset())
+		fmt.Printf("  %s2.%s Afficher les détails d'une sauvegarde\n", display.ColorGreen(), display.ColorReset())
+		fmt.Printf("  %s3.%s Supprimer une sauvegarde\n", display.ColorGreen(), display.ColorReset())
+		fmt.Printf("  %s4.%s Nettoyer les anciennes sauvegardes\n", display.ColorGreen(), display.ColorReset())
 		fmt.Printf("  %s0.%s Retour au menu principal\n", display.ColorGreen(), display.ColorReset())
 
 		choice := input.ReadInput("Votre choix: ")
@@ -28,8 +30,10 @@ func ManageBackupsInteractive() {
 		case "1":
 			ListBackups()
 		case "2":
-			DeleteBackupInteractive()
+			ShowBackupDetailsInteractive()
 		case "3":
+			DeleteBackupInteractive()
+		case "4":
 			cleanOldBackups()
 		case "0":
 			common.LogInfo("Retour au menu principal depuis la gestion des sauvegardes.")
@@ -56,30 +60,126 @@ func ListBackups() {
 		input.DisplayMessage(false, "Aucune sauvegarde disponible.")
 		return	}
 
-	fmt.Printf("%-20s %-30s %-20s %-10s %-8s\n", "NOM", "CHEMIN SOURCE", "DATE", "TAILLE", "TYPE")
-	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf("%-20s %-30s %-20s %-10s %-10s %-8s\n", "NOM", "CHEMIN SOURCE", "DATE", "TAILLE", "COPIÉ", "TYPE")
+	fmt.Println(strings.Repeat("-", 111))
 
 	for _, b := range backups {
 		timeStr := b.Time.Format("02/01/2006 15:04")
 		sizeStr := display.FormatSize(b.Size)
 		typeStr := "Normal"
-		if b.IsIncremental {
+		if b.Format == common.FormatChunks {
+			typeStr = "Dédup."
+		} else if b.BackupType() == common.BackupModeDifferential {
+			typeStr = "Diff."
+		} else if b.IsIncremental {
 			typeStr = "Incr."
 		}
 		if b.Compression {
 			typeStr += " (C)"
 		}
+		if b.Encrypted {
+			typeStr += " (E)"
+		}
 
-		fmt.Printf("%-20s %-30s %-20s %-10s %-8s\n",
+		// Octets réellement copiés par rsync, les autres étant repris de la sauvegarde de base
+		copiedStr := "-"
+		if b.Stats != nil {
+			copiedStr = display.FormatSize(b.Stats.LiteralData)
+		}
+
+		fmt.Printf("%-20s %-30s %-20s %-10s %-10s %-8s\n",
 			display.TruncateString(b.Name, 20),
 			display.TruncateString(b.SourcePath, 30),
 			timeStr,
 			sizeStr,
+			copiedStr,
 			typeStr)
 	}
 	common.LogInfo("Liste des %d sauvegardes affichée.", len(backups))
 }
 
+// ShowBackupDetailsInteractive permet de choisir une sauvegarde et d'en afficher les détails
+func ShowBackupDetailsInteractive() {
+	backups, err := common.ListBackups()
+	if err != nil {
+		input.DisplayMessage(true, "Erreur lors de la récupération des sauvegardes: %v", err)
+		return
+	}
+
+	if len(backups) == 0 {
+		input.DisplayMessage(false, "Aucune sauvegarde disponible.")
+		return
+	}
+
+	fmt.Println("Sauvegardes disponibles:")
+	for i, b := range backups {
+		timeStr := b.Time.Format("02/01/2006 15:04:05")
+		fmt.Printf("%d. %s (%s) - %s\n", i+1, b.Name, b.SourcePath, timeStr)
+	}
+
+	idxStr := input.ReadInput("Sélectionnez une sauvegarde (numéro): ")
+	idx, err := strconv.Atoi(idxStr)
+	if err != nil || idx < 1 || idx > len(backups) {
+		input.DisplayMessage(true, "Choix invalide.")
+		return
+	}
+
+	printBackupDetails(backups[idx-1])
+}
+
+// ShowBackupDetails affiche les détails d'une sauvegarde, dont les statistiques du transfert
+func ShowBackupDetails(id string) {
+	common.LogInfo("Affichage des détails de la sauvegarde %s.", id)
+	backups, err := common.ListBackups()
+	if err != nil {
+		input.DisplayMessage(true, "Erreur lors de la récupération des sauvegardes: %v", err)
+		return
+	}
+
+	for _, b := range backups {
+		if b.ID == id {
+			printBackupDetails(b)
+			return
+		}
+	}
+	input.DisplayMessage(true, "Sauvegarde avec ID %s non trouvée.", id)
+}
+
+// printBackupDetails affiche les métadonnées d'une sauvegarde
+func printBackupDetails(b common.BackupInfo) {
+	fmt.Printf("\n%sSauvegarde %s%s\n", display.ColorBold(), b.ID, display.ColorReset())
+	fmt.Printf("  Configuration:  %s\n", b.Name)
+	fmt.Printf("  Source:         %s\n", b.SourcePath)
+	fmt.Printf("  Emplacement:    %s\n", b.BackupPath)
+	fmt.Printf("  Date:           %s\n", b.Time.Format("02/01/2006 15:04:05"))
+	fmt.Printf("  Type:           %s\n", b.BackupType())
+	if b.ParentID != "" {
+		fmt.Printf("  Base:           %s\n", b.ParentID)
+	}
+	fmt.Printf("  Taille:         %s\n", display.FormatSize(b.Size))
+	fmt.Printf("  Compressée:     %t\n", b.Compression)
+	fmt.Printf("  Chiffrée:       %t\n", b.Encrypted)
+
+	s := b.Stats
+	if s == nil {
+		fmt.Printf("\n%sAucune statistique de transfert enregistrée pour cette sauvegarde.%s\n", display.ColorYellow(), display.ColorReset())
+		return
+	}
+	fmt.Printf("\n%sTransfert%s\n", display.ColorBold(), display.ColorReset())
+	fmt.Printf("  Éléments examinés:   %d\n", s.Files)
+	fmt.Printf("  Éléments créés:      %d\n", s.CreatedFiles)
+	fmt.Printf("  Éléments supprimés:  %d\n", s.DeletedFiles)
+	fmt.Printf("  Fichiers transférés: %d (%s)\n", s.TransferredFiles, display.FormatSize(s.TransferredSize))
+	fmt.Printf("  Données copiées:     %s\n", display.FormatSize(s.LiteralData))
+	fmt.Printf("  Données reprises:    %s\n", display.FormatSize(s.MatchedData))
+	fmt.Printf("  Taille totale:       %s\n", display.FormatSize(s.TotalSize))
+	fmt.Printf("  Envoyé / reçu:       %s / %s\n", display.FormatSize(s.BytesSent), display.FormatSize(s.BytesReceived))
+	fmt.Printf("  Accélération:        %.2f\n", s.Speedup)
+	if s.Errors > 0 {
+		fmt.Printf("  %sErreurs:             %d%s\n", display.ColorRed(), s.Errors, display.ColorReset())
+	}
+}
+
 // DeleteBackupInteractive permet de supprimer une sauvegarde
 func DeleteBackupInteractive() {
 	common.LogInfo("Début de la suppression interactive de sauvegarde.")
@@ -124,7 +224,7 @@ func DeleteBackup(id string) {
 	common.LogInfo("Tentative de suppression de la sauvegarde avec ID: %s", id)
 	fmt.Printf("Suppression de la sauvegarde %s...\n", id)
 
-	err := common.DeleteBackup(id)
+	err := corebackup.DeleteBackup(id)
 	if err != nil {
 		input.DisplayMessage(true, "Erreur lors de la suppression: %v", err)
 		return
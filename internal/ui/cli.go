@@ -76,6 +76,18 @@ func HandleManageCommand(args []string) {
 	case "list":
 		common.LogInfo("Exécution de la sous-commande manage list.")
 		backup.ListBackups()
+	case "show":
+		common.LogInfo("Exécution de la sous-commande manage show.")
+		if len(args) < 2 {
+			common.LogError("Utilisation incorrecte de manage show: ID de sauvegarde manquant.")
+			fmt.Fprintln(os.Stderr, "Usage: " + common.CommandName + " manage show <backup_id>")
+			os.Exit(1)
+		}
+		if !common.IsValidName(args[1]) {
+			input.DisplayMessage(true, "ID de sauvegarde invalide: %s", args[1])
+			os.Exit(1)
+		}
+		backup.ShowBackupDetails(args[1])
 	case "delete":
 		common.LogInfo("Exécution de la sous-commande manage delete.")
 		if len(args) < 2 {
@@ -95,7 +107,7 @@ func HandleManageCommand(args []string) {
 	default:
 		common.LogWarning("Sous-commande manage inconnue: %s", subcommand)
 		fmt.Fprintln(os.Stderr, "Sous-commande inconnue:", subcommand)
-		fmt.Fprintln(os.Stderr, "Sous-commandes disponibles: list, delete, clean")
+		fmt.Fprintln(os.Stderr, "Sous-commandes disponibles: list, show, delete, clean")
 		os.Exit(1)
 	}
 }
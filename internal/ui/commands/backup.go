@@ -175,11 +175,38 @@ func ConfigureBackup() {
 	// Option pour une sauvegarde incrémentale
 	incrementalStr := input.ReadInput("Activer les sauvegardes incrémentales? (o/n): ")
 	incremental := strings.ToLower(incrementalStr) == "o"
+	mode := common.BackupModeFull
+	if incremental {
+		mode = common.BackupModeIncremental
+	} else {
+		// Option pour une sauvegarde différentielle, basée sur la dernière sauvegarde complète
+		differentialStr := input.ReadInput("Activer les sauvegardes différentielles? (o/n): ")
+		if strings.ToLower(differentialStr) == "o" {
+			mode = common.BackupModeDifferential
+		}
+	}
+	
+	// Règle de sauvegarde complète périodique
+	fullEveryRuns, fullEveryDays := 0, 0
+	if mode != common.BackupModeFull {
+		fullEveryRuns = input.ReadIntInput("Sauvegarde complète toutes les N exécutions (0 pour désactiver)", 0)
+		fullEveryDays = input.ReadIntInput("Sauvegarde complète tous les N jours (0 pour désactiver)", 0)
+	}
 	
 	// Compression
 	compressStr := input.ReadInput("Activer la compression? (o/n): ")
 	compression := strings.ToLower(compressStr) == "o"
 	
+	// Chiffrement
+	encryptStr := input.ReadInput("Chiffrer les sauvegardes? (o/n): ")
+	encrypt := strings.ToLower(encryptStr) == "o"
+	if encrypt {
+		if _, err := common.EncryptionPassphrase(); err != nil {
+			common.LogWarning("Chiffrement activé sans phrase secrète disponible: %v", err)
+			fmt.Printf("%sAttention: %v%s\n", display.ColorYellow(), err, display.ColorReset())
+		}
+	}
+	
 	// Répertoires à exclure
 	excludeDirsStr := input.ReadInput("Répertoires à exclure (séparés par des virgules): ")
 	var excludeDirs []string
@@ -229,10 +256,14 @@ func ConfigureBackup() {
 		Name:          name,
 		SourcePath:    sourcePath,
 		Compression:   compression,
+		Encrypt:       encrypt,
 		ExcludeDirs:   excludeDirs,
 		ExcludeFiles:  excludeFiles,
 		Interval:      interval,
 		IsIncremental: incremental,
+		Mode:          mode,
+		FullEveryRuns: fullEveryRuns,
+		FullEveryDays: fullEveryDays,
 		DestinationName: backupDestinationName,
 	}
 	
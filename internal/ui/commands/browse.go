@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Noziop/s4v3my4ss/internal/restore"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// HandleLsCommand traite la commande 'ls': liste le contenu d'une sauvegarde sans la restaurer
+func HandleLsCommand(args []string) {
+	common.LogInfo("Traitement de la commande 'ls' avec les arguments: %v", args)
+	lsCmd := flag.NewFlagSet("ls", flag.ExitOnError)
+	jsonOutput := lsCmd.Bool("json", false, "Afficher le résultat au format JSON.")
+	positional := parseInterspersed(lsCmd, args)
+
+	if len(positional) < 1 {
+		common.LogError("Utilisation incorrecte de la commande ls: ID de sauvegarde manquant.")
+		fmt.Fprintln(os.Stderr, "Usage: "+common.CommandName+" ls <id_sauvegarde> [chemin] [--json]")
+		os.Exit(1)
+	}
+	backupID := validBackupID(positional[0])
+	dir := ""
+	if len(positional) > 1 {
+		dir = positional[1]
+	}
+
+	entries, err := restore.ListFiles(backupID, dir)
+	if err != nil {
+		common.LogError("Impossible de lister la sauvegarde %s: %v", backupID, err)
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	var total int64
+	for _, e := range entries {
+		name := e.Path
+		if e.Target != "" {
+			name += " -> " + e.Target
+		}
+		fmt.Printf("%s %10s  %s  %s\n", e.Mode, common.FormatSize(e.Size), e.ModTime.Format("02/01/2006 15:04"), name)
+		total += e.Size
+	}
+	fmt.Printf("\n%d fichier(s), %s\n", len(entries), common.FormatSize(total))
+}
+
+// HandleCatCommand traite la commande 'cat': écrit un fichier d'une sauvegarde sur la sortie standard
+func HandleCatCommand(args []string) {
+	common.LogInfo("Traitement de la commande 'cat' avec les arguments: %v", args)
+	if len(args) < 2 {
+		common.LogError("Utilisation incorrecte de la commande cat: arguments manquants.")
+		fmt.Fprintln(os.Stderr, "Usage: "+common.CommandName+" cat <id_sauvegarde> <chemin>")
+		os.Exit(1)
+	}
+	backupID := validBackupID(args[0])
+
+	if err := restore.ReadFile(backupID, args[1], os.Stdout); err != nil {
+		common.LogError("Impossible de lire %s dans la sauvegarde %s: %v", args[1], backupID, err)
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// validBackupID vérifie l'ID de sauvegarde fourni en argument et quitte s'il est invalide
+func validBackupID(backupID string) string {
+	if !common.IsValidName(backupID) {
+		common.LogError("ID de sauvegarde invalide: %s", backupID)
+		fmt.Fprintf(os.Stderr, "Erreur: ID de sauvegarde invalide: %s\n", backupID)
+		os.Exit(1)
+	}
+	return backupID
+}
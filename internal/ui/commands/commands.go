@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Noziop/s4v3my4ss/internal/backup"
 	"github.com/Noziop/s4v3my4ss/internal/restore"
 	"github.com/Noziop/s4v3my4ss/internal/ui/display"
 	"github.com/Noziop/s4v3my4ss/internal/ui/input"
@@ -63,7 +66,7 @@ func ConfigureRemoteBackup(serverConfig common.RsyncServerConfig) {
 	sourcePath = filepath.Clean(sourcePath)
 	if !common.DirExists(sourcePath) {
 		common.LogError("Répertoire source '%s' n'existe pas pour la sauvegarde distante.", sourcePath)
-		fmt.Printf("%sErreur: Le répertoire '%s' n'existe pas.%s\n", display.ColorRed, sourcePath, display.ColorReset)
+		fmt.Printf("%sErreur: Le répertoire '%s' n'existe pas.%s\n", display.ColorRed(), sourcePath, display.ColorReset())
 		return
 	}
 	
@@ -117,7 +120,7 @@ func ConfigureRemoteBackup(serverConfig common.RsyncServerConfig) {
 			excludeDirs[i] = strings.TrimSpace(dir)
 			if !common.IsValidExcludePattern(excludeDirs[i]) { // Utilisation de common.IsValidExcludePattern
 				common.LogError("Modèle d'exclusion de répertoire invalide pour la sauvegarde distante: %s", excludeDirs[i])
-				fmt.Printf("%sModèle d'exclusion de répertoire invalide: %s%s\n", display.ColorRed, excludeDirs[i], display.ColorReset)
+				fmt.Printf("%sModèle d'exclusion de répertoire invalide: %s%s\n", display.ColorRed(), excludeDirs[i], display.ColorReset())
 				return
 			}
 		}
@@ -133,7 +136,7 @@ func ConfigureRemoteBackup(serverConfig common.RsyncServerConfig) {
 			excludeFiles[i] = strings.TrimSpace(file)
 			if !common.IsValidExcludePattern(excludeFiles[i]) { // Utilisation de common.IsValidExcludePattern
 				common.LogError("Modèle d'exclusion de fichier invalide pour la sauvegarde distante: %s", excludeFiles[i])
-				fmt.Printf("%sModèle d'exclusion de fichier invalide: %s%s\n", display.ColorRed, excludeFiles[i], display.ColorReset)
+				fmt.Printf("%sModèle d'exclusion de fichier invalide: %s%s\n", display.ColorRed(), excludeFiles[i], display.ColorReset())
 				return
 			}
 		}
@@ -170,7 +173,7 @@ func ConfigureRemoteBackup(serverConfig common.RsyncServerConfig) {
 	// Enregistrer la configuration
 	if err := common.AddBackupDirectory(backupConfig); err != nil {
 		common.LogError("Erreur lors de l'enregistrement de la configuration de sauvegarde distante %s: %v", backupConfig.Name, err)
-		fmt.Printf("%sErreur lors de l'enregistrement de la configuration: %v%s\n", display.ColorRed, err, display.ColorReset)
+		fmt.Printf("%sErreur lors de l'enregistrement de la configuration: %v%s\n", display.ColorRed(), err, display.ColorReset())
 		common.AppConfig.BackupDestination = prevDestination // Restaurer l'ancienne destination
 	} else {
 		common.LogInfo("Configuration de sauvegarde distante %s enregistrée avec succès.", backupConfig.Name)
@@ -191,16 +194,34 @@ func ConfigureRemoteBackup(serverConfig common.RsyncServerConfig) {
 				// Générer un ID unique pour la sauvegarde
 				backupID := common.GenerateBackupID(name)
 				
-				// Utiliser la fonction RsyncBackup pour effectuer la sauvegarde
-				if err := wrappers.RsyncBackup(sourcePath, destination, excludeDirs, excludeFiles, compression, &serverConfig); err != nil {
+				// Utiliser la fonction RsyncBackup pour effectuer la sauvegarde, basée sur une
+				// sauvegarde précédente du même serveur choisie comme pour une sauvegarde locale
+				rsyncOpts := wrappers.BackupOptions{
+					ExcludeDirs:  excludeDirs,
+					ExcludeFiles: excludeFiles,
+				}
+				backupType := common.BackupModeFull
+				parent, baseType, err := backup.SelectRemoteBase(backup.FromConfig(backupConfig), &serverConfig)
+				if err != nil {
+					common.LogInfo("Sauvegarde complète vers %s: %v", serverConfig.Name, err)
+				} else {
+					rsyncOpts.Incremental = true
+					rsyncOpts.LinkDest = parent.BackupPath
+					backupType = baseType
+					fmt.Printf("Sauvegarde basée sur %s.\n", parent.ID)
+				}
+				remotePath, stats, err := wrappers.RsyncBackup(sourcePath, destination, rsyncOpts, compression, &serverConfig)
+				if err != nil {
 					common.LogError("Erreur lors de la sauvegarde immédiate vers %s: %v", serverConfig.Name, err)
 					fmt.Printf("%sErreur lors de la sauvegarde: %v%s\n", display.ColorRed(), err, display.ColorReset())
 					return
 				}
 				
-				// Obtenir la taille du répertoire source comme approximation
-				size, err := common.GetDirSize(sourcePath)
-				if err != nil {
+				// La taille vient des statistiques de rsync, à défaut celle de la source sert d'approximation
+				var size int64
+				if stats != nil {
+					size = stats.TotalSize
+				} else if size, err = common.GetDirSize(sourcePath); err != nil {
 					common.LogError("Impossible de calculer la taille de la sauvegarde: %v", err)
 					fmt.Printf("Impossible de calculer la taille de la sauvegarde: %v\n", err)
 					size = 0
@@ -211,18 +232,23 @@ func ConfigureRemoteBackup(serverConfig common.RsyncServerConfig) {
 					ID:           backupID,
 					Name:         name,
 					SourcePath:   sourcePath,
-					BackupPath:   destination,
+					BackupPath:   remotePath,
 					Time:         time.Now(),
 					Size:         size,
-					IsIncremental: incremental,
+					IsIncremental: rsyncOpts.Incremental,
+					Type:          backupType,
 					Compression:   compression,
 					RemoteServer: &serverConfig, // Utiliser l'adresse de serverConfig pour obtenir un pointeur
+					Stats:        stats,
+				}
+				if rsyncOpts.Incremental {
+					backupInfo.ParentID = parent.ID
 				}
 				
 				// Sauvegarder les métadonnées
 				if err := common.SaveBackupInfo(backupInfo); err != nil {
 					common.LogError("Erreur lors de l'enregistrement des métadonnées pour %s: %v", backupInfo.ID, err)
-					fmt.Printf("%sErreur lors de l'enregistrement des métadonnées: %v%s\n", display.ColorRed, err, display.ColorReset)
+					fmt.Printf("%sErreur lors de l'enregistrement des métadonnées: %v%s\n", display.ColorRed(), err, display.ColorReset())
 					return
 				}
 				
@@ -268,7 +294,62 @@ func HandleWatchCommand(args []string) {
 	common.LogInfo("Surveillance démarrée avec succès pour %s.", config.Name)
 }
 
-// HandleRestoreCommand traite la commande 'restore' depuis la ligne de commande
+// HandleBackupCommand traite la commande 'backup': crée une sauvegarde immédiate d'une
+// configuration, ou simule seulement le transfert avec --dry-run
+func HandleBackupCommand(args []string) {
+	common.LogInfo("Traitement de la commande 'backup' avec les arguments: %v", args)
+	backupCmd := flag.NewFlagSet("backup", flag.ExitOnError)
+	dryRun := backupCmd.Bool("dry-run", false, "Afficher ce que la sauvegarde transférerait, sans rien écrire.")
+	jsonOutput := backupCmd.Bool("json", false, "Avec --dry-run, afficher le résultat au format JSON.")
+	backupCmd.Parse(args)
+
+	if backupCmd.NArg() < 1 {
+		common.LogError("Utilisation incorrecte de la commande backup: arguments manquants.")
+		fmt.Fprintln(os.Stderr, "Usage: " + common.CommandName + " backup [--dry-run [--json]] <nom_configuration>")
+		os.Exit(1)
+	}
+
+	name := backupCmd.Arg(0)
+	if !common.IsValidName(name) {
+		common.LogError("Nom de configuration invalide fourni pour backup: %s", name)
+		fmt.Fprintf(os.Stderr, "Erreur: Nom de configuration invalide: %s\n", name)
+		os.Exit(1)
+	}
+
+	config, found := common.GetBackupConfig(name)
+	if !found {
+		common.LogError("Configuration '%s' non trouvée pour la commande backup.", name)
+		fmt.Fprintf(os.Stderr, "Erreur: Configuration '%s' non trouvée\n", name)
+		os.Exit(1)
+	}
+
+	backupConfig := backup.FromConfig(config)
+	backupConfig.DryRun = *dryRun
+	if *dryRun && *jsonOutput {
+		report, err := backup.DryRunBackup(backupConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Erreur de simulation: %v\n", err)
+			os.Exit(1)
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if err := backup.CreateBackup(backupConfig); err != nil {
+		common.LogError("Erreur lors de la sauvegarde de %s: %v", config.Name, err)
+		fmt.Fprintf(os.Stderr, "Erreur de sauvegarde: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// HandleRestoreCommand traite la commande 'restore' depuis la ligne de commande.
+// Les options peuvent suivre l'ID: restore <id> --only 'src/**/*.go' --to /tmp/x.
+// Avec --at, le premier argument est un nom de configuration: restore myproject --at "2026-10-01 14:00".
 func HandleRestoreCommand(args []string) {
 	common.LogInfo("Traitement de la commande 'restore' avec les arguments: %v", args)
 	if len(args) < 1 {
@@ -277,34 +358,201 @@ func HandleRestoreCommand(args []string) {
 		return
 	}
 
-	backupID := args[0]
+	restoreCmd := flag.NewFlagSet("restore", flag.ExitOnError)
+	var only stringList
+	restoreCmd.Var(&only, "only", "Chemin ou motif à restaurer (\"*\" et \"**\" acceptés), répétable.")
+	to := restoreCmd.String("to", "", "Répertoire de destination (emplacement d'origine par défaut).")
+	at := restoreCmd.String("at", "", "Restaurer la configuration nommée telle qu'elle était à cette date (AAAA-MM-JJ HH:MM).")
+	preview := restoreCmd.Bool("preview", false, "Afficher les fichiers qui seraient créés, écrasés ou laissés intacts, sans rien restaurer.")
+	diff := restoreCmd.Bool("diff", false, "Avec --preview, afficher la différence des petits fichiers texte écrasés.")
+	jsonOutput := restoreCmd.Bool("json", false, "Avec --preview, afficher le résultat au format JSON.")
+	yes := restoreCmd.Bool("yes", false, "Ne poser aucune question: écraser la destination et valider la restauration sans délai d'annulation.")
+	force := restoreCmd.Bool("force", false, "Synonyme de --yes.")
+	rollbackTimeout := restoreCmd.Duration("rollback-timeout", defaultRollbackTimeout, "Délai pour annuler la restauration avant la suppression du contenu précédent.")
+	conflictFlag := restoreCmd.String("conflict", string(restore.ConflictOverwrite), "Fichiers existants différents de la sauvegarde: overwrite, skip-newer (garder les plus récents), keep-both (restaurer à côté) ou fail.")
+	var mapOwner, mapGroup stringList
+	restoreCmd.Var(&mapOwner, "map-owner", "Attribuer les fichiers d'un utilisateur à un autre (origine:attribué, noms ou UID), répétable.")
+	restoreCmd.Var(&mapGroup, "map-group", "Attribuer les fichiers d'un groupe à un autre (origine:attribué, noms ou GID), répétable.")
+	owner := restoreCmd.String("owner", "", "Attribuer tous les fichiers restaurés à un utilisateur ('self' pour soi-même).")
+	normalizeModes := restoreCmd.Bool("normalize-modes", false, "Remplacer les permissions d'origine par 0644 (0755 pour les répertoires et exécutables).")
+	positional := parseInterspersed(restoreCmd, args)
+
+	if len(positional) < 1 {
+		common.LogError("Utilisation incorrecte de la commande restore: ID de sauvegarde manquant.")
+		fmt.Fprintln(os.Stderr, "Usage: " + common.CommandName + " restore <id_sauvegarde> [--only <motif>]... [--to <chemin>] [--yes] [--conflict <politique>] [--owner self|<utilisateur>] [--map-owner a:b]... [--preview [--diff] [--json]]")
+		fmt.Fprintln(os.Stderr, "       " + common.CommandName + " restore <nom_configuration> --at <date> [--only <motif>]... [--to <chemin>]")
+		os.Exit(1)
+	}
+
+	backupID := positional[0]
 	if !common.IsValidName(backupID) { // Utilisation de common.IsValidName
 		common.LogError("ID de sauvegarde invalide fourni pour restore: %s", backupID)
 		fmt.Fprintf(os.Stderr, "Erreur: ID de sauvegarde invalide: %s\n", backupID)
 		os.Exit(1)
 	}
+	
+	// Restauration à un instant donné: choisir la sauvegarde de la configuration en vigueur à cette date
+	if *at != "" {
+		backupID = resolveBackupAt(backupID, *at, only)
+	}
 
-	target := ""
-	if len(args) > 1 {
-		target = args[1]
-		if !common.IsValidPath(target) { // Utilisation de common.IsValidPath
-			common.LogError("Chemin de destination invalide fourni pour restore: %s", target)
-			fmt.Fprintf(os.Stderr, "Erreur: Chemin de destination invalide: %s\n", target)
+	target := *to
+	if target == "" && len(positional) > 1 {
+		target = positional[1]
+	}
+	if !common.IsValidPath(target) { // Utilisation de common.IsValidPath
+		common.LogError("Chemin de destination invalide fourni pour restore: %s", target)
+		fmt.Fprintf(os.Stderr, "Erreur: Chemin de destination invalide: %s\n", target)
+		os.Exit(1)
+	}
+	for _, pattern := range only {
+		if !common.IsValidExcludePattern(pattern) {
+			fmt.Fprintf(os.Stderr, "Erreur: Motif de restauration invalide: %s\n", pattern)
 			os.Exit(1)
 		}
 	}
 
+	conflict, err := restore.ParseConflictPolicy(*conflictFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
+	owners, err := parseOwnerMapping(*owner, mapOwner, mapGroup, *normalizeModes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *preview {
+		report, err := restore.PreviewRestore(backupID, target, restore.Options{Only: only}, *diff)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Erreur d'aperçu: %v\n", err)
+			os.Exit(1)
+		}
+		if *jsonOutput {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
+			return
+		}
+		report.Print(os.Stdout)
+		return
+	}
+
+	assumeYes := *yes || *force
+	// Seule la politique par défaut remplace les fichiers existants sans les conserver
+	if !assumeYes && conflict == restore.ConflictOverwrite {
+		resolved, err := restore.ResolveTarget(backupID, target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+			os.Exit(1)
+		}
+		if common.DirExists(resolved) {
+			common.LogWarning("Répertoire de destination '%s' existe déjà. Demande de confirmation pour écrasement.", resolved)
+			fmt.Printf("⚠️  Attention: Le répertoire '%s' existe déjà.\n", resolved)
+			if !input.ConfirmAction("Les fichiers restaurés remplaceront les fichiers existants. Voulez-vous continuer?") {
+				common.LogInfo("Restauration annulée par l'utilisateur.")
+				fmt.Fprintln(os.Stderr, "Restauration annulée (utilisez --yes pour ne pas être interrogé).")
+				os.Exit(1)
+			}
+		}
+	}
+
 	common.LogInfo("Restauration de la sauvegarde '%s' vers '%s'.", backupID, target)
 	fmt.Printf("Restauration de la sauvegarde '%s' vers '%s'...\n", backupID, target)
 
-	if err := restore.RestoreBackup(backupID, target); err != nil {
+	result, err := restore.RestoreBackupWithOptions(backupID, target, restore.Options{Only: only, Conflict: conflict, Owners: owners})
+	if err != nil {
 		common.LogError("Erreur de restauration pour %s: %v", backupID, err)
 		fmt.Fprintf(os.Stderr, "Erreur de restauration: %v\n", err)
 		os.Exit(1)
 	}
 
+	printRestoreReport(result.Files)
 	common.LogInfo("Restauration terminée avec succès pour %s.", backupID)
 	fmt.Println("Restauration terminée avec succès.")
+
+	if assumeYes {
+		err = result.Commit()
+	} else {
+		err = confirmRestore(result.Rollback, *rollbackTimeout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
 }
 
+// parseOwnerMapping construit l'attribution des fichiers restaurés à partir des options de la ligne de commande
+func parseOwnerMapping(owner string, mapOwner, mapGroup []string, normalizeModes bool) (restore.OwnerMapping, error) {
+	mapping := restore.OwnerMapping{NormalizeModes: normalizeModes}
+	if owner != "" {
+		if err := mapping.SetOwner(owner); err != nil {
+			return mapping, err
+		}
+	}
+	for _, spec := range mapOwner {
+		if err := mapping.MapUser(spec); err != nil {
+			return mapping, err
+		}
+	}
+	for _, spec := range mapGroup {
+		if err := mapping.MapGroup(spec); err != nil {
+			return mapping, err
+		}
+	}
+	return mapping, nil
+}
 
+// resolveBackupAt renvoie l'ID de la sauvegarde de la configuration name à restaurer pour la date at.
+// Pour un fichier unique, c'est la dernière sauvegarde qui en contenait une version à cette date.
+func resolveBackupAt(name, at string, only []string) string {
+	when, err := restore.ParseTime(at)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
+
+	var info common.BackupInfo
+	if len(only) == 1 && !strings.ContainsAny(only[0], "*?") {
+		info, err = restore.FindFileVersionAt(name, only[0], when)
+	} else {
+		info, err = restore.FindBackupAt(name, when)
+	}
+	if err != nil {
+		common.LogError("Aucune sauvegarde de %s pour le %s: %v", name, at, err)
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Sauvegarde retenue: %s (%s)\n", info.ID, info.Time.Format("02/01/2006 15:04:05"))
+	return info.ID
+}
+
+// stringList est une option de ligne de commande répétable
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseInterspersed analyse les options d'un FlagSet placées avant ou après les
+// arguments positionnels, et renvoie ces derniers
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/Noziop/s4v3my4ss/internal/daemon"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// HandleDaemonCommand traite la commande 'daemon': supervise toutes les configurations
+// (intervalles, planifications et surveillance) jusqu'à la réception de SIGTERM ou SIGINT
+func HandleDaemonCommand(args []string) {
+	common.LogInfo("Traitement de la commande 'daemon' avec les arguments: %v", args)
+	daemonCmd := flag.NewFlagSet("daemon", flag.ExitOnError)
+	maxConcurrent := daemonCmd.Int("max-concurrent", 1, "Nombre maximal de sauvegardes simultanées.")
+	watchAll := daemonCmd.Bool("watch-all", false, "Surveiller les modifications de toutes les configurations.")
+	daemonCmd.Parse(args)
+
+	configs := common.AppConfig.BackupDirs
+	if len(configs) == 0 {
+		fmt.Fprintln(os.Stderr, "Erreur: aucune configuration de sauvegarde n'est définie.")
+		os.Exit(1)
+	}
+
+	// Les créneaux planifiés déjà exécutés sont conservés d'un démarrage à l'autre
+	configDir, err := common.GetConfigDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
+	opts := daemon.Options{
+		MaxConcurrent: *maxConcurrent,
+		WatchAll:      *watchAll,
+		StatePath:     filepath.Join(configDir, daemon.StateFileName),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// Un second signal interrompt immédiatement les sauvegardes en cours
+		stop()
+		fmt.Println("Arrêt demandé: fin des sauvegardes en cours (envoyez de nouveau le signal pour forcer l'arrêt).")
+	}()
+
+	fmt.Printf("Démon %s démarré pour %d configuration(s).\n", common.CommandName, len(configs))
+	d := daemon.New(configs, opts)
+	if err := d.Run(ctx); err != nil {
+		common.LogError("Erreur du démon: %v", err)
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Démon arrêté.")
+}
@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Noziop/s4v3my4ss/internal/restore"
+	"github.com/Noziop/s4v3my4ss/internal/wrappers"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// HandleExportCommand traite la commande 'export': écrit une sauvegarde sous forme d'archive
+// autonome dans un fichier ou sur la sortie standard
+func HandleExportCommand(args []string) {
+	common.LogInfo("Traitement de la commande 'export' avec les arguments: %v", args)
+	exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+	formatName := exportCmd.String("format", "tar.gz", "Format de l'archive: tar, tar.gz, tar.zst, tar.xz ou zip.")
+	output := exportCmd.String("o", "-", "Fichier de destination ('-' pour la sortie standard).")
+	positional := parseInterspersed(exportCmd, args)
+
+	if len(positional) != 1 {
+		common.LogError("Utilisation incorrecte de la commande export: ID de sauvegarde manquant.")
+		fmt.Fprintln(os.Stderr, "Usage: "+common.CommandName+" export <id_sauvegarde> [--format tar|tar.gz|tar.zst|tar.xz|zip] [-o fichier|-]")
+		os.Exit(1)
+	}
+	backupID := validBackupID(positional[0])
+	format, err := wrappers.ParseExportFormat(*formatName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *output == "-" {
+		// Une archive n'a rien à faire dans un terminal
+		if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprintln(os.Stderr, "Erreur: la sortie standard est un terminal; redirigez-la ou utilisez -o <fichier>.")
+			os.Exit(1)
+		}
+		if err := restore.ExportBackup(backupID, os.Stdout, format); err != nil {
+			fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := exportToFile(backupID, *output, format); err != nil {
+		common.LogError("Impossible d'exporter la sauvegarde %s vers %s: %v", backupID, *output, err)
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Sauvegarde %s exportée dans %s.\n", backupID, *output)
+}
+
+// exportToFile exporte une sauvegarde dans un fichier temporaire renommé une fois l'archive
+// complète, pour ne jamais laisser d'archive partielle. Le fichier n'est lisible que par
+// son propriétaire, comme les sauvegardes.
+func exportToFile(backupID, path string, format wrappers.CompressionFormat) error {
+	if !common.IsValidPath(path) {
+		return fmt.Errorf("chemin de destination invalide: %s", path)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".saveme-export-*")
+	if err != nil {
+		return fmt.Errorf("impossible de créer le fichier temporaire: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = restore.ExportBackup(backupID, tmp, format)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -2,8 +2,10 @@ package commands
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Noziop/s4v3my4ss/internal/restore"
 	"github.com/Noziop/s4v3my4ss/internal/ui/display"
@@ -11,6 +13,10 @@ import (
 	"github.com/Noziop/s4v3my4ss/pkg/common"
 )
 
+// defaultRollbackTimeout est le délai laissé pour annuler une restauration avant que la copie
+// du contenu précédent soit supprimée
+const defaultRollbackTimeout = 5 * time.Minute
+
 // RestoreBackupInteractive permet de restaurer une sauvegarde
 func RestoreBackupInteractive(isCLI bool) {
 	common.LogInfo("Début de la restauration interactive.")
@@ -56,11 +62,45 @@ func RestoreBackupInteractive(isCLI bool) {
 		return
 	}
 
+	// Restauration sélective: chemins ou motifs relatifs à la racine de la sauvegarde
+	var only []string
+	onlyStr := input.ReadAndValidateInput("Éléments à restaurer (chemins ou motifs séparés par des virgules, vide pour tout): ", common.IsValidExcludePattern, "Motif invalide.")
+	for _, pattern := range strings.Split(onlyStr, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			only = append(only, pattern)
+		}
+	}
+
+	opts := restore.Options{Only: only}
+
 	// Vérifier la destination
 	if common.DirExists(targetPath) {
-		common.LogWarning("Répertoire de destination '%s' existe déjà. Demande de confirmation pour écrasement.", targetPath)
-		overwriteStr := input.ReadInput(fmt.Sprintf("Le répertoire '%s' existe déjà. Écraser? (o/n): ", targetPath))
-		if strings.ToLower(overwriteStr) != "o" {
+		// Montrer ce qui serait perdu avant de demander la confirmation
+		if input.ConfirmAction(fmt.Sprintf("Le répertoire '%s' existe déjà. Afficher un aperçu des modifications?", targetPath)) {
+			preview, err := restore.PreviewRestore(backup.ID, targetPath, opts, true)
+			if err != nil {
+				input.DisplayMessage(true, "Aperçu impossible: %v", err)
+			} else {
+				preview.Print(os.Stdout)
+			}
+		}
+		common.LogWarning("Répertoire de destination '%s' existe déjà. Demande de la politique de conflit.", targetPath)
+		fmt.Printf("Le répertoire '%s' existe déjà. Que faire des fichiers existants qui diffèrent de la sauvegarde?\n", targetPath)
+		fmt.Println("1. Les écraser")
+		fmt.Println("2. Garder ceux qui sont plus récents que la sauvegarde")
+		fmt.Println("3. Les garder et restaurer la sauvegarde à côté (.restored-<date>)")
+		fmt.Println("4. Annuler la restauration au premier conflit")
+		fmt.Println("0. Annuler")
+		switch input.ReadInput("Votre choix: ") {
+		case "1":
+			opts.Conflict = restore.ConflictOverwrite
+		case "2":
+			opts.Conflict = restore.ConflictSkipNewer
+		case "3":
+			opts.Conflict = restore.ConflictKeepBoth
+		case "4":
+			opts.Conflict = restore.ConflictFail
+		default:
 			common.LogInfo("Restauration annulée par l'utilisateur.")
 			fmt.Println("Restauration annulée.")
 			return
@@ -70,10 +110,59 @@ func RestoreBackupInteractive(isCLI bool) {
 	common.LogInfo("Restauration de la sauvegarde '%s' vers '%s'.", backup.Name, targetPath)
 	fmt.Printf("Restauration de la sauvegarde '%s' vers '%s'...\n", backup.Name, targetPath)
 
-	if err := restore.RestoreBackup(backup.ID, targetPath); err != nil {
+	result, err := restore.RestoreBackupWithOptions(backup.ID, targetPath, opts)
+	if err != nil {
 		input.DisplayMessage(true, "Erreur lors de la restauration: %v", err)
 		return
 	}
 
+	printRestoreReport(result.Files)
 	input.DisplayMessage(false, "Restauration terminée avec succès.")
-}
\ No newline at end of file
+	if err := confirmRestore(result.Rollback, defaultRollbackTimeout); err != nil {
+		input.DisplayMessage(true, "%v", err)
+	}
+}
+
+// confirmRestore demande à l'utilisateur de valider une restauration qui a remplacé un
+// répertoire existant. Le contenu précédent est remis en place s'il refuse; sans réponse
+// avant l'expiration du délai, la restauration est validée et la copie supprimée.
+func confirmRestore(rollback *restore.Rollback, timeout time.Duration) error {
+	if rollback.Path == "" {
+		return nil
+	}
+	fmt.Printf("Le contenu précédent de '%s' est conservé dans '%s'.\n", rollback.Target, rollback.Path)
+	answer, ok := input.ReadInputTimeout(fmt.Sprintf("Conserver la restauration? (o/n, validée automatiquement dans %v): ", timeout), timeout)
+	if !ok {
+		common.LogInfo("Aucune réponse dans le délai de %v, restauration de %s validée.", timeout, rollback.Target)
+	}
+	if ok && strings.ToLower(answer) == "n" {
+		if err := rollback.Undo(); err != nil {
+			return fmt.Errorf("impossible d'annuler la restauration: %w", err)
+		}
+		fmt.Println("Restauration annulée, contenu précédent remis en place.")
+		return nil
+	}
+	return rollback.Commit()
+}
+
+// printRestoreReport affiche le sort de chaque fichier modifié par une restauration
+func printRestoreReport(files []restore.FileDecision) {
+	counts := make(map[restore.FileAction]int)
+	for _, f := range files {
+		counts[f.Action]++
+		switch f.Action {
+		case restore.FileCreated:
+			fmt.Printf("%-10s %s\n", "Créé", f.Path)
+		case restore.FileOverwritten:
+			fmt.Printf("%s%-10s%s %s\n", display.ColorYellow(), "Écrasé", display.ColorReset(), f.Path)
+		case restore.FileSkipped:
+			fmt.Printf("%-10s %s (plus récent que la sauvegarde)\n", "Ignoré", f.Path)
+		case restore.FileKeptBoth:
+			fmt.Printf("%-10s %s (version sauvegardée: %s)\n", "Conservé", f.Path, f.Restored)
+		}
+	}
+	if len(files) > 0 {
+		fmt.Printf("\n%d créé(s), %d écrasé(s), %d ignoré(s), %d restauré(s) à côté.\n",
+			counts[restore.FileCreated], counts[restore.FileOverwritten], counts[restore.FileSkipped], counts[restore.FileKeptBoth])
+	}
+}
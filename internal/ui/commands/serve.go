@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Noziop/s4v3my4ss/internal/serve"
+	"github.com/Noziop/s4v3my4ss/internal/ui/display"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// HandleServeCommand traite la commande 'serve': expose les sauvegardes en lecture seule
+// en HTTP et WebDAV
+func HandleServeCommand(args []string) {
+	common.LogInfo("Traitement de la commande 'serve' avec les arguments: %v", args)
+	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := serveCmd.String("listen", "127.0.0.1:8080", "Adresse et port d'écoute.")
+	serveCmd.Parse(args)
+
+	// SECURITY: le serveur n'a pas d'authentification, il ne doit être exposé qu'à un réseau de confiance
+	if !serve.IsLoopback(*listen) {
+		common.LogSecurity("Serveur de consultation exposé hors de la machine locale: %s", *listen)
+		fmt.Printf("%sAttention: les sauvegardes seront accessibles sans authentification depuis le réseau (%s).%s\n",
+			display.ColorYellow(), *listen, display.ColorReset())
+	}
+
+	fmt.Printf("Sauvegardes consultables sur http://%s/ (HTTP et WebDAV, lecture seule). Ctrl+C pour arrêter.\n", *listen)
+	if err := serve.ListenAndServe(*listen); err != nil {
+		common.LogError("Erreur du serveur de consultation: %v", err)
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
+}
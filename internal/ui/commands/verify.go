@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Noziop/s4v3my4ss/internal/backup"
+	"github.com/Noziop/s4v3my4ss/internal/ui/display"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// HandleVerifyCommand traite la commande verify: relit une sauvegarde et la compare à son manifeste
+func HandleVerifyCommand(args []string) {
+	common.LogInfo("Traitement de la commande 'verify' avec les arguments: %v", args)
+	if len(args) < 1 {
+		common.LogError("Utilisation incorrecte de la commande verify: arguments manquants.")
+		fmt.Fprintln(os.Stderr, "Usage: "+common.CommandName+" verify <id_sauvegarde>")
+		os.Exit(1)
+	}
+
+	backupID := args[0]
+	if !common.IsValidName(backupID) {
+		common.LogError("ID de sauvegarde invalide fourni pour verify: %s", backupID)
+		fmt.Fprintf(os.Stderr, "Erreur: ID de sauvegarde invalide: %s\n", backupID)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Vérification de la sauvegarde '%s'...\n", backupID)
+	report, err := backup.VerifyBackup(backupID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erreur de vérification: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, path := range report.Missing {
+		fmt.Printf("%sManquant:%s  %s\n", display.ColorRed(), display.ColorReset(), path)
+	}
+	for _, problem := range report.Corrupted {
+		fmt.Printf("%sCorrompu:%s  %s (%s)\n", display.ColorRed(), display.ColorReset(), problem.Path, problem.Reason)
+	}
+	for _, path := range report.Extra {
+		fmt.Printf("%sEn trop:%s   %s\n", display.ColorYellow(), display.ColorReset(), path)
+	}
+
+	if !report.OK() {
+		fmt.Printf("\n%sSauvegarde altérée:%s %d manquant(s), %d corrompu(s), %d en trop sur %d élément(s) contrôlé(s).\n",
+			display.ColorRed(), display.ColorReset(), len(report.Missing), len(report.Corrupted), len(report.Extra), report.Checked)
+		os.Exit(1)
+	}
+	fmt.Printf("%sSauvegarde intacte:%s %d élément(s) contrôlé(s).\n", display.ColorGreen(), display.ColorReset(), report.Checked)
+}
@@ -79,6 +79,7 @@ func WatchDirectoryInteractive() {
 		// Mode continu avec prompt pour retourner au menu
 		fmt.Println("Mode surveillance continue. Appuyez sur Ctrl+C pour arrêter.")
 		fmt.Println("Les sauvegardes continueront même si vous quittez ce prompt.")
+		fmt.Printf("Pour une surveillance permanente, indépendante de ce terminal, utilisez '%s daemon'.\n", common.CommandName)
 		
 		// Lancer la surveillance en arrière-plan
 		go watch.StartWatch(config)
@@ -77,17 +77,22 @@ func displayFullConfig() {
 	// Afficher les répertoires sauvegardés
 	display.DisplayConfigList(common.AppConfig.BackupDirs, "Répertoires sauvegardés", func(i int, item interface{}) string {
 		dir := item.(common.BackupConfig)
-		incr := "Non"
-		if dir.IsIncremental {
-			incr = "Oui"
-		}
 		comp := "Non"
 		if dir.Compression {
 			comp = "Oui"
 		}
 		
 		out := fmt.Sprintf("%d. %s (%s)\n", i+1, dir.Name, dir.SourcePath)
-		out += fmt.Sprintf("   Compression: %s, Incrémental: %s, Intervalle: %d min\n", comp, incr, dir.Interval)
+		out += fmt.Sprintf("   Compression: %s, Mode: %s, Intervalle: %d min\n", comp, modeLabel(dir), dir.Interval)
+		if len(dir.PreHooks) > 0 || len(dir.PostHooks) > 0 {
+			out += fmt.Sprintf("   Hooks: %d avant, %d après la sauvegarde\n", len(dir.PreHooks), len(dir.PostHooks))
+		}
+		if dir.Encrypt {
+			out += "   Chiffrement: Oui\n"
+		}
+		if dir.Schedule != "" {
+			out += fmt.Sprintf("   Planification: %s\n", dir.Schedule)
+		}
 
 		// Afficher les exclusions si présentes
 		if len(dir.ExcludeDirs) > 0 || len(dir.ExcludeFiles) > 0 {
@@ -136,16 +141,12 @@ func manageBackupDirectories() {
 		// Afficher les répertoires sauvegardés
         display.DisplayConfigList(common.AppConfig.BackupDirs, "Répertoires configurés", func(i int, item interface{}) string {
             dir := item.(common.BackupConfig)
-            incr := "Non"
-            if dir.IsIncremental {
-                incr = "Oui"
-            }
             comp := "Non"
             if dir.Compression {
                 comp = "Oui"
             }
-            return fmt.Sprintf("%d. %s (%s)   Compression: %s, Incrémental: %s, Intervalle: %d min",
-                i+1, dir.Name, dir.SourcePath, comp, incr, dir.Interval)
+            return fmt.Sprintf("%d. %s (%s)   Compression: %s, Mode: %s, Intervalle: %d min",
+                i+1, dir.Name, dir.SourcePath, comp, modeLabel(dir), dir.Interval)
         })
 
 		fmt.Printf("  %s1.%s Ajouter un répertoire\n", display.ColorGreen(), display.ColorReset())
@@ -201,8 +202,27 @@ func editBackupDirectory() {
 	// Permettre de modifier chaque propriété
 	name := input.ReadStringInput(fmt.Sprintf("Nouveau nom (actuel: %s): ", dir.Name), dir.Name, common.IsValidName, "Nom invalide.")
 	sourcePath := input.ReadStringInput(fmt.Sprintf("Nouveau chemin (actuel: %s): ", dir.SourcePath), dir.SourcePath, common.IsValidPath, "Chemin invalide.")
-	incremental := input.ReadBoolInput("Activer les sauvegardes incrémentales?", dir.IsIncremental)
+	currentMode := dir.BackupMode()
+	incremental := input.ReadBoolInput("Activer les sauvegardes incrémentales?", currentMode == common.BackupModeIncremental)
+	mode := common.BackupModeFull
+	if incremental {
+		mode = common.BackupModeIncremental
+	} else if input.ReadBoolInput("Activer les sauvegardes différentielles?", currentMode == common.BackupModeDifferential) {
+		mode = common.BackupModeDifferential
+	}
+	fullEveryRuns, fullEveryDays := 0, 0
+	if mode != common.BackupModeFull {
+		fullEveryRuns = input.ReadIntInput("Sauvegarde complète toutes les N exécutions (0 pour désactiver)", dir.FullEveryRuns)
+		fullEveryDays = input.ReadIntInput("Sauvegarde complète tous les N jours (0 pour désactiver)", dir.FullEveryDays)
+	}
 	compression := input.ReadBoolInput("Activer la compression?", dir.Compression)
+	encrypt := input.ReadBoolInput("Chiffrer les sauvegardes?", dir.Encrypt)
+	if encrypt {
+		if _, err := common.EncryptionPassphrase(); err != nil {
+			common.LogWarning("Chiffrement activé sans phrase secrète disponible: %v", err)
+			fmt.Printf("%sAttention: %v%s\n", display.ColorYellow(), err, display.ColorReset())
+		}
+	}
 
 	// Répertoires à exclure
 	fmt.Printf("Répertoires exclus actuels: %s\n", strings.Join(dir.ExcludeDirs, ", "))
@@ -229,16 +249,40 @@ func editBackupDirectory() {
 	// Intervalle
 	interval := input.ReadIntInput("Nouvel intervalle en minutes", dir.Interval)
 
+	// Planification cron, exécutée par le démon
+	schedule := input.ReadStringInput(fmt.Sprintf("Planification cron (actuelle: %s, vide pour garder, '-' pour supprimer): ", dir.Schedule), dir.Schedule, func(s string) bool {
+		if s == "" || s == "-" {
+			return true
+		}
+		_, err := common.ParseSchedule(s)
+		return err == nil
+	}, "Planification invalide (ex: '0 18 * * 1-5' ou '@daily').")
+	if schedule == "-" {
+		schedule = ""
+	}
+
 	// Créer la configuration modifiée
 	updatedConfig := common.BackupConfig{
 		Name:          name,
 		SourcePath:    sourcePath,
 		Compression:   compression,
+		Encrypt:       encrypt,
 		IsIncremental: incremental,
+		Mode:          mode,
+		FullEveryRuns: fullEveryRuns,
+		FullEveryDays: fullEveryDays,
 		ExcludeDirs:   excludeDirs,
 		ExcludeFiles:  excludeFiles,
 		Interval:      interval,
+		Schedule:      schedule,
+		Watch:         dir.Watch,
+		WatchDebounce: dir.WatchDebounce, // Les délais de surveillance se configurent dans le fichier de configuration
+		WatchMinInterval: dir.WatchMinInterval,
+		WatchMaxLatency:  dir.WatchMaxLatency,
 		RemoteServer:  dir.RemoteServer, // Conserver le serveur distant s'il existe
+		PreHooks:      dir.PreHooks,  // Les hooks se configurent dans le fichier de configuration
+		PostHooks:     dir.PostHooks,
+		DestinationName: dir.DestinationName,
 	}
 
 	// Mettre à jour la configuration
@@ -504,6 +548,9 @@ func manageBackupDestinations() {
 			if dest.IsDefault {
 				defaultStr = " (Par défaut)"
 			}
+			if dest.Format == common.FormatChunks {
+				defaultStr += " [dédupliqué]"
+			}
 			return fmt.Sprintf("%d. %s (%s) - %s%s", i+1, dest.Name, dest.Type, dest.Path, defaultStr)
 		})
 
@@ -554,11 +601,17 @@ func addBackupDestination() {
 
 	isDefault := input.ReadBoolInput("Définir comme destination par défaut?", false)
 
+	format := ""
+	if destType == "local" && input.ReadBoolInput("Utiliser un dépôt dédupliqué (blocs partagés entre sauvegardes)?", false) {
+		format = common.FormatChunks
+	}
+
 	newDest := common.BackupDestination{
 		Name:      name,
 		Path:      path,
 		Type:      destType,
 		IsDefault: isDefault,
+		Format:    format,
 	}
 
 	if err := common.AddBackupDestination(newDest); err != nil{
@@ -602,10 +655,12 @@ func editBackupDestination() {
 	isDefault := input.ReadBoolInput(fmt.Sprintf("Définir comme destination par défaut? (actuel: %t)", dest.IsDefault), dest.IsDefault)
 
 	updatedDest := common.BackupDestination{
-		Name:      name,
-		Path:      path,
-		Type:      destType,
-		IsDefault: isDefault,
+		Name:        name,
+		Path:        path,
+		Type:        destType,
+		IsDefault:   isDefault,
+		RsyncServer: dest.RsyncServer,
+		Format:      dest.Format,
 	}
 
 	if err := common.UpdateBackupDestination(dest.Name, updatedDest); err != nil {
@@ -698,4 +753,24 @@ func changeBackupDestination() {
 	}
 
 	input.DisplayMessage(false, "Destination principale modifiée avec succès: %s", newDest)
-}
\ No newline at end of file
+}
+
+// modeLabel renvoie le libellé du mode de sauvegarde d'une configuration
+func modeLabel(dir common.BackupConfig) string {
+	label := "complet"
+	switch dir.BackupMode() {
+	case common.BackupModeIncremental:
+		label = "incrémentiel"
+	case common.BackupModeDifferential:
+		label = "différentiel"
+	default:
+		return label
+	}
+	if dir.FullEveryRuns > 0 {
+		label += fmt.Sprintf(", complet toutes les %d exécutions", dir.FullEveryRuns)
+	}
+	if dir.FullEveryDays > 0 {
+		label += fmt.Sprintf(", complet tous les %d jours", dir.FullEveryDays)
+	}
+	return label
+}
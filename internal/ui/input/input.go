@@ -6,22 +6,60 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Noziop/s4v3my4ss/internal/ui/display"
 	"github.com/Noziop/s4v3my4ss/pkg/common"
 )
 
-var reader *bufio.Reader
+// lines reçoit les lignes lues sur l'entrée standard. La lecture se fait dans une goroutine
+// unique, démarrée à la première question, pour qu'une ligne saisie après l'expiration
+// d'un délai serve à la question suivante.
+var (
+	lines     = make(chan string)
+	startRead sync.Once
+)
 
-func init() {
-	reader = bufio.NewReader(os.Stdin)
+// nextLine renvoie le canal des lignes saisies, fermé à la fin de l'entrée standard
+func nextLine() <-chan string {
+	startRead.Do(func() {
+		go func() {
+			reader := bufio.NewReader(os.Stdin)
+			for {
+				line, err := reader.ReadString('\n')
+				if line != "" {
+					lines <- line
+				}
+				if err != nil {
+					close(lines)
+					return
+				}
+			}
+		}()
+	})
+	return lines
 }
 
 // ReadInput lit une entrée utilisateur depuis la console.
 func ReadInput(prompt string) string {
 	fmt.Print(prompt)
-	input, _ := reader.ReadString('\n')
-	return strings.TrimSpace(input)
+	return strings.TrimSpace(<-nextLine())
+}
+
+// ReadInputTimeout lit une entrée utilisateur, ou renvoie ok à false si rien n'a été
+// saisi avant l'expiration du délai.
+func ReadInputTimeout(prompt string, timeout time.Duration) (input string, ok bool) {
+	fmt.Print(prompt)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case line := <-nextLine():
+		return strings.TrimSpace(line), true
+	case <-timer.C:
+		fmt.Println()
+		return "", false
+	}
 }
 
 // ReadAndValidateInput lit une entrée utilisateur et la valide en utilisant une fonction de validation.
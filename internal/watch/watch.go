@@ -4,61 +4,94 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Noziop/s4v3my4ss/internal/backup"
+	"github.com/Noziop/s4v3my4ss/internal/journal"
 	"github.com/Noziop/s4v3my4ss/internal/wrappers"
 	"github.com/Noziop/s4v3my4ss/pkg/common"
 )
 
-// Constantes pour la configuration du watcher
-const (
-	// Le délai minimum entre deux sauvegardes (pour éviter les sauvegardes trop fréquentes)
-	minBackupInterval = 10 * time.Second
-	// Le délai d'attente après des modifications avant de déclencher une sauvegarde
-	waitAfterChanges = 5 * time.Second
-)
-
-// Watcher gère la surveillance d'un répertoire
+// Watcher gère la surveillance d'un répertoire. Les modifications sont regroupées: une
+// sauvegarde a lieu quand elles cessent depuis debounce, ou au plus tard maxLatency après la
+// première d'entre elles, et jamais moins de minInterval après la précédente. La réception des
+// modifications ne fait que les compter: elle n'attend jamais la fin d'une sauvegarde.
 type Watcher struct {
 	// Config contient la configuration du répertoire à surveiller
 	Config common.BackupConfig
 	// Le wrapper inotify pour la détection des modifications
 	inotify *wrappers.InotifyWrapper
-	// Canal pour signaler qu'une sauvegarde doit être déclenchée
-	triggerBackup chan struct{}
+	// Délais de regroupement des modifications (WatchDebounce, WatchMinInterval et WatchMaxLatency)
+	debounce, minInterval, maxLatency time.Duration
+	// Canal pour signaler une modification au planificateur des sauvegardes
+	wake chan struct{}
 	// Contexte pour arrêter la surveillance
 	ctx context.Context
 	// Fonction pour annuler la surveillance
 	cancel context.CancelFunc
-	// Mutex pour protéger l'accès à lastBackupTime
+	// Mutex pour protéger les modifications en attente, jamais conservé pendant une sauvegarde
 	mu sync.Mutex
-	// Date de la dernière sauvegarde
+	// Nombre de modifications en attente de sauvegarde
+	pending int
+	// Dates de la première et de la dernière modification en attente
+	firstChange, lastChange time.Time
+	// Date du début de la dernière sauvegarde
 	lastBackupTime time.Time
-	// Indique si une modification est en attente
-	pendingChanges bool
-	// Timer pour déclencher une sauvegarde après un délai
-	backupTimer *time.Timer
+	// onChange, si défini, est appelée à la place de la sauvegarde directe (voir WatchChanges)
+	onChange func()
+	// Journal des modifications, qui permet aux sauvegardes de ne relire que les chemins
+	// modifiés (nil si la configuration ne peut pas l'exploiter)
+	journal *journal.Journal
 }
 
 // NewWatcher crée un nouveau watcher pour un répertoire
 func NewWatcher(config common.BackupConfig) (*Watcher, error) {
+	return newWatcher(context.Background(), config)
+}
+
+// newWatcher crée un watcher arrêté à l'annulation de parent
+func newWatcher(parent context.Context, config common.BackupConfig) (*Watcher, error) {
 	inotify, err := wrappers.NewInotifyWrapper()
 	if err != nil {
 		return nil, fmt.Errorf("impossible de créer le watcher: %w", err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(parent)
 
-	return &Watcher{
-		Config:        config,
-		inotify:       inotify,
-		triggerBackup: make(chan struct{}, 1),
-		ctx:           ctx,
-		cancel:        cancel,
+	w := &Watcher{
+		Config:         config,
+		inotify:        inotify,
+		debounce:       seconds(config.WatchDebounce, common.DefaultWatchDebounce),
+		minInterval:    seconds(config.WatchMinInterval, common.DefaultWatchMinInterval),
+		maxLatency:     seconds(config.WatchMaxLatency, common.DefaultWatchMaxLatency),
+		wake:           make(chan struct{}, 1),
+		ctx:            ctx,
+		cancel:         cancel,
 		lastBackupTime: time.Time{}, // Zéro = jamais fait de sauvegarde
-	}, nil
+	}
+
+	if backup.UsesChangeJournal(config) {
+		if w.journal, err = journal.For(config.Name); err != nil {
+			common.LogWarning("Journal des modifications indisponible pour %s: %v", config.Name, err)
+		}
+		// Le journal n'est fiable qu'une fois toute l'arborescence surveillée
+		inotify.OnReady = func() {
+			if err := w.journal.Start(); err != nil {
+				common.LogWarning("%v", err)
+			}
+		}
+	}
+	return w, nil
+}
+
+// seconds convertit un délai configuré en secondes, def s'il n'est pas défini
+func seconds(value, def int) time.Duration {
+	if value <= 0 {
+		value = def
+	}
+	return time.Duration(value) * time.Second
 }
 
 // StartWatch démarre la surveillance du répertoire
@@ -104,18 +137,38 @@ func StartWatchWithCallback(config common.BackupConfig, done <-chan bool) error
 	return watcher.Start()
 }
 
+// WatchChanges surveille le répertoire d'une configuration jusqu'à l'annulation de ctx, sans
+// sauvegarder: onChange est appelée une fois les modifications retombées, et c'est à l'appelant
+// de décider de la sauvegarde. Renvoie l'erreur de l'outil de surveillance s'il s'arrête.
+func WatchChanges(ctx context.Context, config common.BackupConfig, onChange func()) error {
+	if !common.DirExists(config.SourcePath) {
+		return fmt.Errorf("le répertoire à surveiller n'existe pas: %s", config.SourcePath)
+	}
+	watcher, err := newWatcher(ctx, config)
+	if err != nil {
+		return err
+	}
+	watcher.onChange = onChange
+	defer watcher.Stop()
+	defer watcher.journal.Stop()
+	go watcher.scheduler()
+	return watcher.inotify.WatchDirectory(watcher.ctx, config.SourcePath, true, watcher.handleFileChange)
+}
+
 // Start démarre la surveillance du répertoire
 func (w *Watcher) Start() error {
 	fmt.Printf("Démarrage de la surveillance du répertoire: %s\n", w.Config.SourcePath)
 
 	// Effectuer une sauvegarde initiale
+	w.lastBackupTime = time.Now()
 	if err := w.performBackup(); err != nil {
 		fmt.Printf("Erreur lors de la sauvegarde initiale: %v\n", err)
 		// On continue même en cas d'erreur
 	}
 
 	// Démarrer la goroutine qui gère les sauvegardes
-	go w.backupManager()
+	go w.scheduler()
+	defer w.journal.Stop()
 
 	// Démarrer la surveillance des fichiers
 	return w.inotify.WatchDirectory(w.ctx, w.Config.SourcePath, true, w.handleFileChange)
@@ -124,116 +177,176 @@ func (w *Watcher) Start() error {
 // Stop arrête la surveillance
 func (w *Watcher) Stop() {
 	w.cancel()
-	// Arrêter le timer s'il est actif
-	if w.backupTimer != nil {
-		w.backupTimer.Stop()
-	}
 }
 
 // handleFileChange est appelé chaque fois qu'un fichier est modifié
 func (w *Watcher) handleFileChange(event wrappers.WatchEvent) {
+	w.record(event)
+
+	// Une nouvelle analyse complète concerne tout le répertoire: aucune exclusion ne s'applique
+	if event.EventType != wrappers.EventRescan && w.ignored(event.Path) {
+		return
+	}
+
+	// Afficher l'événement
+	fmt.Printf("Modification détectée: %s (%s)\n", event.Path, event.EventType)
+
+	w.mu.Lock()
+	now := time.Now()
+	if w.pending == 0 {
+		w.firstChange = now
+	}
+	w.pending++
+	w.lastChange = now
+	w.mu.Unlock()
+
+	// Réveiller le planificateur sans jamais attendre: un signal déjà en attente suffit
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// record consigne une modification dans le journal. Rien n'est filtré: les fichiers cachés ou
+// temporaires ne déclenchent pas de sauvegarde, mais en font partie.
+func (w *Watcher) record(event wrappers.WatchEvent) {
+	if w.journal == nil {
+		return
+	}
+	if event.EventType == wrappers.EventRescan {
+		w.journal.Invalidate()
+		return
+	}
+	// Le contenu d'un répertoire créé ou renommé est entièrement à relire
+	tree := event.IsDir && (event.EventType == wrappers.EventCreate || event.EventType == wrappers.EventMove)
+	for _, path := range []string{event.OldPath, event.Path} {
+		if path == "" {
+			continue
+		}
+		rel, err := filepath.Rel(w.Config.SourcePath, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		w.journal.Record(journal.Change{Path: rel, Tree: tree && path == event.Path})
+	}
+}
+
+// ignored indique si une modification concerne un fichier temporaire, caché ou exclu
+func (w *Watcher) ignored(path string) bool {
 	// Ignorer les fichiers temporaires et cachés
-	baseName := filepath.Base(event.Path)
+	baseName := filepath.Base(path)
 	if len(baseName) > 0 && (baseName[0] == '.' || baseName[0] == '~' || baseName[len(baseName)-1] == '~') {
-		return
+		return true
 	}
-	
+
 	// Vérifier si le fichier fait partie des exclusions
 	for _, exclude := range w.Config.ExcludeFiles {
 		matched, err := filepath.Match(exclude, baseName)
 		if err == nil && matched {
-			return
+			return true
 		}
 	}
-	
+
 	// Vérifier si le répertoire fait partie des exclusions
-	dirPath := filepath.Dir(event.Path)
+	dirPath := filepath.Dir(path)
 	for _, exclude := range w.Config.ExcludeDirs {
 		if filepath.Base(dirPath) == exclude {
-			return
+			return true
 		}
 	}
+	return false
+}
 
-	// Afficher l'événement
-	fmt.Printf("Modification détectée: %s (%s)\n", event.Path, event.EventType)
+// scheduler déclenche les sauvegardes des modifications en attente jusqu'à l'arrêt de la
+// surveillance. Les modifications reçues pendant une sauvegarde restent en attente et donnent
+// toujours lieu à une nouvelle sauvegarde.
+func (w *Watcher) scheduler() {
+	for {
+		due, ok := w.nextBackup()
+		if ok && !time.Now().Before(due) {
+			w.flush()
+			continue
+		}
 
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if ok {
+			timer = time.NewTimer(time.Until(due))
+			fire = timer.C
+		}
+		select {
+		case <-w.ctx.Done():
+		case <-w.wake:
+		case <-fire:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if w.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// nextBackup renvoie la date de la prochaine sauvegarde, ou false si aucune modification
+// n'est en attente
+func (w *Watcher) nextBackup() (time.Time, bool) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	if w.pending == 0 {
+		return time.Time{}, false
+	}
+	due := w.lastChange.Add(w.debounce)
+	if latest := w.firstChange.Add(w.maxLatency); latest.Before(due) {
+		due = latest
+	}
+	if earliest := w.lastBackupTime.Add(w.minInterval); due.Before(earliest) {
+		due = earliest
+	}
+	return due, true
+}
 
-	// Marquer qu'il y a des modifications en attente
-	w.pendingChanges = true
+// flush sauvegarde les modifications en attente, ou les signale à onChange si elle est définie.
+// En cas d'échec, elles sont remises en attente.
+func (w *Watcher) flush() {
+	w.mu.Lock()
+	changes, first, last := w.pending, w.firstChange, w.lastChange
+	w.pending = 0
+	w.lastBackupTime = time.Now()
+	w.mu.Unlock()
 
-	// Si un timer est déjà actif, le réinitialiser
-	if w.backupTimer != nil {
-		w.backupTimer.Stop()
+	if w.onChange != nil {
+		w.onChange()
+		return
 	}
 
-	// Créer un nouveau timer pour déclencher la sauvegarde après un délai
-	w.backupTimer = time.AfterFunc(waitAfterChanges, func() {
-		// Ne déclencher que si assez de temps s'est écoulé depuis la dernière sauvegarde
+	common.LogInfo("Sauvegarde de %s après %d modification(s).", w.Config.Name, changes)
+	if err := w.performBackup(); err != nil {
+		fmt.Printf("Erreur lors de la sauvegarde: %v\n", err)
 		w.mu.Lock()
-		defer w.mu.Unlock()
-		
-		if time.Since(w.lastBackupTime) >= minBackupInterval {
-			// Envoyer un signal pour déclencher la sauvegarde
-			select {
-			case w.triggerBackup <- struct{}{}:
-				// Signal envoyé avec succès
-			default:
-				// Canal déjà plein, une sauvegarde est déjà prévue
-			}
-		}
-	})
-}
-
-// backupManager gère les sauvegardes en fonction des signaux reçus
-func (w *Watcher) backupManager() {
-	for {
-		select {
-		case <-w.ctx.Done():
-			// Contexte annulé, arrêter la surveillance
-			return
-		case <-w.triggerBackup:
-			// Recevoir un signal pour déclencher une sauvegarde
-			err := w.performBackup()
-			if err != nil {
-				fmt.Printf("Erreur lors de la sauvegarde: %v\n", err)
-			}
+		if w.pending == 0 {
+			w.lastChange = last
 		}
+		w.firstChange = first
+		w.pending += changes
+		w.mu.Unlock()
 	}
 }
 
 // performBackup effectue une sauvegarde du répertoire
 func (w *Watcher) performBackup() error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	
-	if !w.pendingChanges && !w.lastBackupTime.IsZero() {
-		// Pas de modifications depuis la dernière sauvegarde
-		return nil
-	}
-
 	fmt.Printf("Démarrage de la sauvegarde de %s...\n", w.Config.SourcePath)
-	
+
 	// Appeler le module de backup pour créer une sauvegarde
-	backupConfig := backup.BackupConfig{
-		SourcePath:   w.Config.SourcePath,
-		Name:         w.Config.Name,
-		Compression:  w.Config.Compression,
-		ExcludeDirs:  w.Config.ExcludeDirs,
-		ExcludeFiles: w.Config.ExcludeFiles,
- 		Incremental:  true, // Forcer les sauvegardes incrémentales pour la surveillance automatique
-	}
-	
-	err := backup.CreateBackup(backupConfig)
-	if err != nil {
+	backupConfig := backup.FromConfig(w.Config)
+	// Forcer les sauvegardes incrémentales pour la surveillance automatique, sauf en mode différentiel
+	backupConfig.Incremental = true
+	backupConfig.Journal = w.journal
+
+	if err := backup.CreateBackup(backupConfig); err != nil {
 		return err
 	}
-	
-	// Mettre à jour la date de la dernière sauvegarde
-	w.lastBackupTime = time.Now()
-	w.pendingChanges = false
-	
-	fmt.Printf("Sauvegarde terminée avec succès à %s.\n", w.lastBackupTime.Format("15:04:05"))
+
+	fmt.Printf("Sauvegarde terminée avec succès à %s.\n", time.Now().Format("15:04:05"))
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,121 @@
+package watch
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/internal/wrappers"
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// newTestWatcher crée un watcher dont les sauvegardes sont remplacées par onChange
+func newTestWatcher(t *testing.T, debounce, minInterval, maxLatency time.Duration, onChange func()) *Watcher {
+	t.Helper()
+	w, err := NewWatcher(common.BackupConfig{Name: "test", SourcePath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewWatcher failed: %v", err)
+	}
+	w.debounce, w.minInterval, w.maxLatency = debounce, minInterval, maxLatency
+	w.onChange = onChange
+	go w.scheduler()
+	t.Cleanup(w.Stop)
+	return w
+}
+
+func (w *Watcher) touch(name string) {
+	w.handleFileChange(wrappers.WatchEvent{Path: filepath.Join(w.Config.SourcePath, name), EventType: wrappers.EventModify})
+}
+
+func TestWatcherTrailingBackup(t *testing.T) {
+	calls := make(chan time.Time, 10)
+	w := newTestWatcher(t, 50*time.Millisecond, 300*time.Millisecond, time.Second, func() { calls <- time.Now() })
+
+	start := time.Now()
+	w.touch("a.txt")
+	first := <-calls
+	// Modification pendant l'intervalle minimal: elle ne doit pas être perdue
+	w.touch("b.txt")
+	select {
+	case second := <-calls:
+		if gap := second.Sub(first); gap < 300*time.Millisecond {
+			t.Errorf("Minimum interval not respected: %v between backups", gap)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Trailing backup never ran")
+	}
+	if delay := first.Sub(start); delay < 50*time.Millisecond {
+		t.Errorf("Debounce not respected: backup after %v", delay)
+	}
+}
+
+func TestWatcherMaxLatency(t *testing.T) {
+	calls := make(chan time.Time, 10)
+	w := newTestWatcher(t, 200*time.Millisecond, 0, 300*time.Millisecond, func() { calls <- time.Now() })
+
+	// Des modifications continues repoussent le délai de calme, pas la latence maximale
+	start := time.Now()
+	stop := time.After(time.Second)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case at := <-calls:
+			if delay := at.Sub(start); delay > 600*time.Millisecond {
+				t.Errorf("Backup delayed beyond the maximum latency: %v", delay)
+			}
+			return
+		case <-ticker.C:
+			w.touch("busy.log")
+		case <-stop:
+			t.Fatal("No backup during a continuous burst of changes")
+		}
+	}
+}
+
+func TestWatcherDoesNotBlockDuringBackup(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := 0
+	w := newTestWatcher(t, 10*time.Millisecond, 0, time.Second, func() {
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		if n == 1 {
+			// Sauvegarde longue
+			<-release
+		}
+	})
+
+	w.touch("first.txt")
+	time.Sleep(100 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			w.touch("during.txt")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Change handling blocked while a backup was running")
+	}
+	close(release)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := calls
+		mu.Unlock()
+		if n == 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	t.Errorf("Expected exactly one trailing backup after the burst, got %d call(s)", calls)
+}
@@ -0,0 +1,475 @@
+package wrappers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/sys/unix"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// ProgressFunc est appelée périodiquement avec le nombre d'octets traités et le total attendu
+// (total vaut 0 s'il est inconnu).
+type ProgressFunc func(done, total int64)
+
+// newCompressWriter enveloppe w dans le compresseur correspondant à un format tar
+func newCompressWriter(w io.Writer, format CompressionFormat) (io.WriteCloser, error) {
+	switch format {
+	case FormatTarGz:
+		return gzip.NewWriter(w), nil
+	case FormatTarZst:
+		return zstd.NewWriter(w)
+	case FormatTarXz:
+		return xz.NewWriter(w)
+	case FormatTar:
+		return nopWriteCloser{w}, nil
+	default:
+		return nil, fmt.Errorf("format de compression non supporté pour tar: %s", format)
+	}
+}
+
+// nopWriteCloser transmet les écritures sans compression
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// newDecompressReader enveloppe r dans le décompresseur correspondant à un format tar
+func newDecompressReader(r io.Reader, format CompressionFormat) (io.ReadCloser, error) {
+	switch format {
+	case FormatTarGz:
+		return gzip.NewReader(r)
+	case FormatTarZst:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case FormatTarXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	case FormatTar:
+		return io.NopCloser(r), nil
+	default:
+		return nil, fmt.Errorf("format de compression non supporté pour tar: %s", format)
+	}
+}
+
+// progressCounter compte les octets traités et notifie une ProgressFunc
+type progressCounter struct {
+	done     int64
+	total    int64
+	progress ProgressFunc
+	last     time.Time
+}
+
+// add comptabilise n octets et notifie au plus quelques fois par seconde
+func (p *progressCounter) add(n int64) {
+	p.done += n
+	if p.progress == nil || n == 0 {
+		return
+	}
+	if now := time.Now(); now.Sub(p.last) >= 200*time.Millisecond || p.done == p.total {
+		p.last = now
+		p.progress(p.done, p.total)
+	}
+}
+
+// countingReader notifie un progressCounter à chaque lecture
+type countingReader struct {
+	r       io.Reader
+	counter *progressCounter
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.counter.add(int64(n))
+	return n, err
+}
+
+// ExcludeFunc indique si un élément (chemin relatif avec des slashes) doit être exclu de l'archive
+type ExcludeFunc func(rel string, isDir bool) bool
+
+// walkArchiveSource parcourt sourcePath et appelle fn pour chaque élément avec son chemin
+// relatif (avec des slashes). La racine elle-même n'est pas transmise, et les éléments
+// pour lesquels exclude renvoie true sont ignorés (avec leur contenu pour un répertoire).
+func walkArchiveSource(sourcePath string, exclude ExcludeFunc, fn func(path, rel string, info os.FileInfo) error) error {
+	return filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourcePath, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if exclude != nil && exclude(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(path, rel, info)
+	})
+}
+
+// archiveSourceSize calcule la taille des fichiers réguliers qui seront archivés
+func archiveSourceSize(sourcePath string, exclude ExcludeFunc) (int64, error) {
+	var size int64
+	err := walkArchiveSource(sourcePath, exclude, func(_, _ string, info os.FileInfo) error {
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// recordFunc reçoit chaque élément archivé avec l'empreinte SHA-256 de son contenu
+type recordFunc func(rel string, info os.FileInfo, target, sum string)
+
+// copyContent copie le contenu d'un fichier dans une archive et calcule son empreinte si record est défini
+func copyContent(w io.Writer, path, rel string, info os.FileInfo, counter *progressCounter, record recordFunc) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if record == nil {
+		_, err = io.Copy(w, &countingReader{r: file, counter: counter})
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), &countingReader{r: file, counter: counter}); err != nil {
+		return err
+	}
+	record(rel, info, "", hex.EncodeToString(h.Sum(nil)))
+	return nil
+}
+
+// writeTarEntry ajoute un élément du système de fichiers à une archive tar
+func writeTarEntry(tw *tar.Writer, path, rel string, info os.FileInfo, counter *progressCounter, record recordFunc) error {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		link = target
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	// Format PAX pour conserver les noms longs et les dates à la nanoseconde
+	header.Format = tar.FormatPAX
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		if record != nil {
+			record(rel, info, link, "")
+		}
+		return nil
+	}
+	return copyContent(tw, path, rel, info, counter, record)
+}
+
+// writeZipEntry ajoute un élément du système de fichiers à une archive zip
+func writeZipEntry(zw *zip.Writer, path, rel string, info os.FileInfo, counter *progressCounter, record recordFunc) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	if info.IsDir() {
+		header.Name += "/"
+	} else if info.Mode().IsRegular() {
+		header.Method = zip.Deflate
+	}
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		// Convention zip: la cible du lien est stockée comme contenu de l'entrée
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		if record != nil {
+			record(rel, info, target, "")
+		}
+		_, err = io.WriteString(w, target)
+		return err
+	case info.Mode().IsRegular():
+		return copyContent(w, path, rel, info, counter, record)
+	}
+	return nil
+}
+
+// archiveExtractor écrit des entrées d'archive sous un répertoire de destination
+// en refusant toute entrée qui en sortirait.
+type archiveExtractor struct {
+	dest string
+	// dirs mémorise permissions et dates des répertoires, appliquées après l'écriture de leur contenu
+	dirs map[string]dirMeta
+	// files contient les fichiers réguliers écrits, seules cibles admises pour un lien dur
+	files map[string]bool
+}
+
+// dirMeta contient les attributs d'un répertoire extrait
+type dirMeta struct {
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// newArchiveExtractor prépare l'extraction vers dest
+func newArchiveExtractor(dest string) (*archiveExtractor, error) {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	return &archiveExtractor{
+		dest:  dest,
+		dirs:  make(map[string]dirMeta),
+		files: make(map[string]bool),
+	}, nil
+}
+
+// target renvoie le chemin de destination d'une entrée, ou une erreur si elle sort de dest
+func (e *archiveExtractor) target(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(name, "/")))
+	if clean == "." {
+		return e.dest, nil
+	}
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) || filepath.IsAbs(clean) {
+		return "", fmt.Errorf("entrée d'archive hors de la destination: %s", name)
+	}
+	// SECURITY: un lien symbolique extrait plus tôt ne doit pas permettre d'écrire hors de dest,
+	// y compris à travers des répertoires parents encore à créer
+	if err := common.CheckNoSymlinkAncestor(e.dest, clean); err != nil {
+		return "", fmt.Errorf("entrée d'archive hors de la destination via un lien symbolique: %s", name)
+	}
+	return filepath.Join(e.dest, clean), nil
+}
+
+// dir crée un répertoire
+func (e *archiveExtractor) dir(name string, mode os.FileMode, modTime time.Time) error {
+	path, err := e.target(name)
+	if err != nil {
+		return err
+	}
+	// Un lien symbolique extrait plus tôt sous ce nom serait suivi par MkdirAll et Chmod
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("répertoire d'archive remplaçant un lien symbolique: %s", name)
+	}
+	// Le répertoire reste accessible en écriture jusqu'à finish
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return err
+	}
+	if err := os.Chmod(path, mode.Perm()|0700); err != nil {
+		return err
+	}
+	e.dirs[path] = dirMeta{mode: mode.Perm(), modTime: modTime}
+	return nil
+}
+
+// file écrit un fichier régulier
+func (e *archiveExtractor) file(name string, mode os.FileMode, modTime time.Time, r io.Reader) error {
+	path, err := e.target(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Supprimer un éventuel lien symbolique existant pour ne pas écrire à travers
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		os.Remove(path)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	e.files[path] = true
+	if err := os.Chmod(path, mode.Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(path, modTime, modTime)
+}
+
+// hardlink recrée un lien dur en recopiant le contenu de sa cible, qui doit être un fichier
+// régulier déjà extrait de l'archive
+func (e *archiveExtractor) hardlink(name, linkname string, mode os.FileMode, modTime time.Time) error {
+	source, err := e.target(linkname)
+	if err != nil {
+		return err
+	}
+	// SECURITY: un lien symbolique ou un fichier préexistant permettrait de recopier un fichier
+	// quelconque de l'hôte dans l'extraction
+	info, err := os.Lstat(source)
+	if err != nil || !info.Mode().IsRegular() || !e.files[source] {
+		return fmt.Errorf("cible de lien dur invalide, pas un fichier extrait de l'archive: %s", linkname)
+	}
+	path, err := e.target(name)
+	if err != nil {
+		return err
+	}
+	if path == source {
+		return nil
+	}
+	in, err := os.OpenFile(source, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// Le fichier ouvert doit être celui qui a été examiné
+	if opened, err := in.Stat(); err != nil || !os.SameFile(info, opened) {
+		return fmt.Errorf("cible de lien dur modifiée pendant l'extraction: %s", linkname)
+	}
+	return e.file(name, mode, modTime, in)
+}
+
+// symlink crée un lien symbolique, avec la date du lien lui-même
+func (e *archiveExtractor) symlink(name, linkTarget string, modTime time.Time) error {
+	path, err := e.target(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	os.Remove(path)
+	delete(e.files, path)
+	if err := os.Symlink(linkTarget, path); err != nil {
+		return err
+	}
+	times := []unix.Timespec{unix.NsecToTimespec(modTime.UnixNano()), unix.NsecToTimespec(modTime.UnixNano())}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, path, times, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+// finish applique les permissions définitives et dates des répertoires
+func (e *archiveExtractor) finish() {
+	for path, meta := range e.dirs {
+		// Une entrée suivante a pu remplacer le répertoire par un lien symbolique
+		if info, err := os.Lstat(path); err != nil || !info.IsDir() {
+			continue
+		}
+		os.Chmod(path, meta.mode)
+		os.Chtimes(path, meta.modTime, meta.modTime)
+	}
+}
+
+// extractTar extrait le contenu d'une archive tar
+func extractTar(tr *tar.Reader, e *archiveExtractor, filter func(name string) bool) error {
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("archive tar illisible: %w", err)
+		}
+		if filter != nil && !filter(strings.TrimSuffix(header.Name, "/")) {
+			continue
+		}
+
+		mode := header.FileInfo().Mode()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.dir(header.Name, mode, header.ModTime)
+		case tar.TypeReg, tar.TypeRegA:
+			err = e.file(header.Name, mode, header.ModTime, tr)
+		case tar.TypeSymlink:
+			err = e.symlink(header.Name, header.Linkname, header.ModTime)
+		case tar.TypeLink:
+			err = e.hardlink(header.Name, header.Linkname, mode, header.ModTime)
+		default:
+			// Périphériques, FIFO...: ignorés
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("erreur lors de l'extraction de %s: %w", header.Name, err)
+		}
+	}
+	e.finish()
+	return nil
+}
+
+// extractZip extrait le contenu d'une archive zip
+func extractZip(zr *zip.Reader, e *archiveExtractor, counter *progressCounter, filter func(name string) bool) error {
+	for _, f := range zr.File {
+		if filter != nil && !filter(strings.TrimSuffix(f.Name, "/")) {
+			continue
+		}
+		if err := extractZipFile(f, e, counter); err != nil {
+			return fmt.Errorf("erreur lors de l'extraction de %s: %w", f.Name, err)
+		}
+	}
+	e.finish()
+	return nil
+}
+
+// extractZipFile extrait une entrée d'une archive zip
+func extractZipFile(f *zip.File, e *archiveExtractor, counter *progressCounter) error {
+	mode := f.Mode()
+	if mode.IsDir() || strings.HasSuffix(f.Name, "/") {
+		return e.dir(f.Name, mode, f.Modified)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if mode&os.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(rc, 4096))
+		if err != nil {
+			return err
+		}
+		return e.symlink(f.Name, string(target), f.Modified)
+	}
+	if mode&os.ModeType != 0 {
+		return nil
+	}
+	counter.add(int64(f.CompressedSize64))
+	return e.file(f.Name, mode, f.Modified, rc)
+}
@@ -1,12 +1,16 @@
 package wrappers
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"github.com/Noziop/s4v3my4ss/internal/encryption"
+	"github.com/Noziop/s4v3my4ss/internal/manifest"
 	"github.com/Noziop/s4v3my4ss/pkg/common"
 )
 
@@ -18,93 +22,111 @@ const (
 	FormatTarGz CompressionFormat = "targz"
 	// FormatZip représente le format zip
 	FormatZip CompressionFormat = "zip"
+	// FormatTarZst représente le format tar.zst (zstandard)
+	FormatTarZst CompressionFormat = "tarzst"
+	// FormatTarXz représente le format tar.xz
+	FormatTarXz CompressionFormat = "tarxz"
+	// FormatTar représente une archive tar sans compression (exports uniquement)
+	FormatTar CompressionFormat = "tar"
 )
 
-// CompressionWrapper gère la compression et décompression des fichiers
+// Extension renvoie l'extension de fichier associée au format
+func (f CompressionFormat) Extension() string {
+	switch f {
+	case FormatZip:
+		return ".zip"
+	case FormatTarZst:
+		return ".tar.zst"
+	case FormatTarXz:
+		return ".tar.xz"
+	case FormatTar:
+		return ".tar"
+	default:
+		return ".tar.gz"
+	}
+}
+
+// FormatFromPath détermine le format d'une archive d'après son extension.
+// L'extension de chiffrement éventuelle (.enc) est ignorée.
+func FormatFromPath(path string) (CompressionFormat, bool) {
+	path = strings.TrimSuffix(path, encryption.Extension)
+	switch {
+	case strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz"):
+		return FormatTarGz, true
+	case strings.HasSuffix(path, ".tar.zst") || strings.HasSuffix(path, ".tzst"):
+		return FormatTarZst, true
+	case strings.HasSuffix(path, ".tar.xz") || strings.HasSuffix(path, ".txz"):
+		return FormatTarXz, true
+	case strings.HasSuffix(path, ".zip"):
+		return FormatZip, true
+	case strings.HasSuffix(path, ".tar"):
+		return FormatTar, true
+	default:
+		return "", false
+	}
+}
+
+// CompressionWrapper gère la compression et décompression des fichiers.
+// Les archives sont produites en Go natif (archive/tar, archive/zip, gzip, zstd, xz),
+// sans dépendre d'outils externes.
 type CompressionWrapper struct {
 	// Vérifié indique si les outils de compression sont disponibles
 	Verified bool
 	// DefaultFormat est le format de compression par défaut
 	DefaultFormat CompressionFormat
+	// Progress, si défini, est appelée pendant la compression et la décompression
+	Progress ProgressFunc
+	// Key, si définie, chiffre les archives produites
+	Key *encryption.Key
+	// Keyring permet de déchiffrer les archives portant l'extension .enc
+	Keyring *encryption.Keyring
+	// Manifest, si défini, reçoit la description de chaque élément archivé
+	Manifest *manifest.Manifest
 }
 
 // NewCompressionWrapper crée une nouvelle instance de CompressionWrapper
 func NewCompressionWrapper() (*CompressionWrapper, error) {
 	cw := &CompressionWrapper{
-		Verified:     false,
+		Verified:      true,
 		DefaultFormat: FormatTarGz,
 	}
-
-	// Vérifier si tar est disponible
-	if !common.IsCommandAvailable("tar") {
-		common.LogError("tar n'est pas installé.")
-		return cw, fmt.Errorf("tar n'est pas installé")
-	}
-
-	// Vérifier si gzip est disponible
-	if !common.IsCommandAvailable("gzip") {
-		// Si gzip n'est pas disponible mais que zip l'est, utiliser zip comme format par défaut
-		if common.IsCommandAvailable("zip") {
-			cw.DefaultFormat = FormatZip
-		} else {
-			common.LogError("Ni gzip ni zip ne sont installés.")
-			return cw, fmt.Errorf("ni gzip ni zip ne sont installés")
-		}
-	}
-
-	cw.Verified = true
-	common.LogInfo("CompressionWrapper créé et outils vérifiés.")
+	common.LogInfo("CompressionWrapper créé (moteur d'archives natif).")
 	return cw, nil
 }
 
-// EnsureAvailable vérifie que les outils de compression sont disponibles
-func (cw *CompressionWrapper) EnsureAvailable() error {
-	if cw.Verified {
-		return nil
-	}
-
-	// Essayer d'installer tar et gzip
-	if common.EnsureDependency("tar", "tar") != nil || 
-	   common.EnsureDependency("gzip", "gzip") != nil {
-		// Si l'installation échoue, essayer zip
-		common.LogWarning("Impossible d'installer tar ou gzip. Tentative d'installation de zip.")
-		if common.EnsureDependency("zip", "zip") == nil && 
-		   common.EnsureDependency("unzip", "unzip") == nil {
-			cw.DefaultFormat = FormatZip
-			common.LogInfo("zip et unzip installés avec succès. Format par défaut défini sur zip.")
-		} else {
-			common.LogError("Impossible d'installer les outils de compression.")
-			return fmt.Errorf("impossible d'installer les outils de compression")
-		}
-	} else {
-		cw.DefaultFormat = FormatTarGz
-		common.LogInfo("tar et gzip installés avec succès. Format par défaut défini sur tar.gz.")
-	}
-
-	cw.Verified = true
-	return nil
+// Compress archive le contenu d'un répertoire dans un fichier de manière sécurisée.
+// Les chemins de l'archive sont relatifs à sourcePath. L'archive est écrite dans un
+// fichier temporaire puis renommée, pour ne jamais laisser d'archive partielle.
+func (cw *CompressionWrapper) Compress(sourcePath, destPath string, format CompressionFormat) error {
+	return cw.CompressFiltered(sourcePath, destPath, format, nil)
 }
 
-// Compress compresse un répertoire dans un fichier de manière sécurisée.
-func (cw *CompressionWrapper) Compress(sourcePath, destPath string, format CompressionFormat) error {
+// CompressFiltered archive le contenu d'un répertoire en ignorant les éléments pour
+// lesquels exclude renvoie true. Un filtre nil archive tout le répertoire.
+func (cw *CompressionWrapper) CompressFiltered(sourcePath, destPath string, format CompressionFormat, exclude ExcludeFunc) error {
 	common.LogInfo("Début de la compression: Source=%s, Destination=%s, Format=%s", sourcePath, destPath, format)
 	// SECURITY: Valider les chemins et le format avant toute opération.
 	if !common.IsValidPath(sourcePath) || !common.IsValidPath(destPath) { // Utilisation de common.IsValidPath
 		common.LogError("Chemin source ou destination invalide ou non sécurisé: Source=%s, Dest=%s", sourcePath, destPath)
 		return fmt.Errorf("chemin source ou destination invalide ou non sécurisé")
 	}
+
+	if format == "" {
+		format = cw.DefaultFormat
+	}
 	if !common.IsValidCompressionFormat(string(format)) { // Utilisation de common.IsValidCompressionFormat
 		common.LogError("Format de compression non supporté: %s", format)
 		return fmt.Errorf("format de compression non supporté: %s", format)
 	}
 
-	if err := cw.EnsureAvailable(); err != nil {
-		common.LogError("Outils de compression non disponibles: %v", err)
-		return err
+	if format == FormatZip && cw.Key != nil {
+		common.LogError("Le chiffrement n'est pas pris en charge pour le format zip.")
+		return fmt.Errorf("le chiffrement n'est pas pris en charge pour le format zip")
 	}
 
-	if format == "" {
-		format = cw.DefaultFormat
+	if !common.DirExists(sourcePath) {
+		common.LogError("Le répertoire à compresser n'existe pas: %s", sourcePath)
+		return fmt.Errorf("le répertoire à compresser n'existe pas: %s", sourcePath)
 	}
 
 	destDir := filepath.Dir(destPath)
@@ -113,38 +135,106 @@ func (cw *CompressionWrapper) Compress(sourcePath, destPath string, format Compr
 		return fmt.Errorf("impossible de créer le répertoire de destination: %w", err)
 	}
 
-	var cmd *exec.Cmd
+	// Taille totale pour le suivi de progression
+	counter := &progressCounter{progress: cw.Progress}
+	if cw.Progress != nil {
+		if size, err := archiveSourceSize(sourcePath, exclude); err == nil {
+			counter.total = size
+		}
+	}
 
-	switch format {
-	case FormatTarGz:
-		// SECURITY: Les arguments sont passés séparément pour éviter l'injection de shell.
-		cmd = exec.Command("tar", "-czf", destPath, "-C", filepath.Dir(sourcePath), filepath.Base(sourcePath))
-	case FormatZip:
-		// Le changement de répertoire est une opération sensible. Assurer que les chemins sont propres.
-		cleanSourceDir := filepath.Clean(filepath.Dir(sourcePath))
-		cmd = exec.Command("zip", "-r", destPath, filepath.Base(sourcePath))
-		cmd.Dir = cleanSourceDir // Exécuter la commande dans le répertoire parent de la source
-	default:
-		common.LogError("Format de compression non supporté: %s", format)
-		return fmt.Errorf("format de compression non supporté: %s", format)
+	var record recordFunc
+	if cw.Manifest != nil {
+		record = cw.Manifest.Add
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	tmp, err := os.CreateTemp(destDir, ".saveme-archive-*")
+	if err != nil {
+		common.LogError("Impossible de créer le fichier temporaire dans %s: %v", destDir, err)
+		return fmt.Errorf("impossible de créer le fichier temporaire: %w", err)
+	}
+	tmpPath := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
 
-	common.LogInfo("Exécution de la commande de compression: %s %s", cmd.Path, strings.Join(cmd.Args, " "))
-	err := cmd.Run()
+	if format == FormatZip {
+		zw := zip.NewWriter(tmp)
+		err = walkArchiveSource(sourcePath, exclude, func(path, rel string, info os.FileInfo) error {
+			return writeZipEntry(zw, path, rel, info, counter, record)
+		})
+		if err == nil {
+			err = zw.Close()
+		}
+	} else {
+		// Chaîne d'écriture: tar -> compression -> chiffrement éventuel -> fichier
+		var out io.Writer = tmp
+		var enc io.WriteCloser
+		if cw.Key != nil {
+			enc, err = cw.Key.NewWriter(tmp)
+			out = enc
+		}
+		var cwr io.WriteCloser
+		if err == nil {
+			cwr, err = newCompressWriter(out, format)
+		}
+		if err == nil {
+			tw := tar.NewWriter(cwr)
+			err = walkArchiveSource(sourcePath, exclude, func(path, rel string, info os.FileInfo) error {
+				return writeTarEntry(tw, path, rel, info, counter, record)
+			})
+			if err == nil {
+				err = tw.Close()
+			}
+			if closeErr := cwr.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if enc != nil {
+			if closeErr := enc.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		common.LogError("Erreur lors de la compression: %v", err)
 		return fmt.Errorf("erreur lors de la compression: %w", err)
 	}
 
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		common.LogError("Impossible de finaliser l'archive %s: %v", destPath, err)
+		return fmt.Errorf("impossible de finaliser l'archive: %w", err)
+	}
+	committed = true
+
 	common.LogInfo("Compression terminée avec succès.")
 	return nil
 }
 
 // Decompress décompresse un fichier vers un répertoire de manière sécurisée.
 func (cw *CompressionWrapper) Decompress(sourcePath, destPath string) error {
+	return cw.decompress(sourcePath, destPath, nil)
+}
+
+// DecompressFiltered décompresse uniquement les entrées pour lesquelles filter renvoie true,
+// pour la restauration sélective. filter reçoit le chemin de l'entrée dans l'archive (avec des
+// slashes, sans slash final); les répertoires parents d'une entrée retenue sont créés.
+func (cw *CompressionWrapper) DecompressFiltered(sourcePath, destPath string, filter func(name string) bool) error {
+	return cw.decompress(sourcePath, destPath, filter)
+}
+
+// decompress extrait les entrées de l'archive retenues par filter (toutes si filter est nil)
+func (cw *CompressionWrapper) decompress(sourcePath, destPath string, filter func(name string) bool) error {
 	common.LogInfo("Début de la décompression: Source=%s, Destination=%s", sourcePath, destPath)
 	// SECURITY: Valider les chemins avant la décompression.
 	if !common.IsValidPath(sourcePath) || !common.IsValidPath(destPath) { // Utilisation de common.IsValidPath
@@ -152,34 +242,66 @@ func (cw *CompressionWrapper) Decompress(sourcePath, destPath string) error {
 		return fmt.Errorf("chemin source ou destination invalide ou non sécurisé")
 	}
 
-	if err := cw.EnsureAvailable(); err != nil {
-		common.LogError("Outils de décompression non disponibles: %v", err)
-		return err
+	format, ok := FormatFromPath(sourcePath)
+	if !ok {
+		common.LogError("Format de compression non reconnu pour le fichier: %s", sourcePath)
+		return fmt.Errorf("format de compression non reconnu pour le fichier: %s", sourcePath)
 	}
 
-	if err := os.MkdirAll(destPath, 0755); err != nil {
+	extractor, err := newArchiveExtractor(destPath)
+	if err != nil {
 		common.LogError("Impossible de créer le répertoire de destination %s: %v", destPath, err)
 		return fmt.Errorf("impossible de créer le répertoire de destination: %w", err)
 	}
 
-	var cmd *exec.Cmd
+	encrypted := strings.HasSuffix(sourcePath, encryption.Extension)
+	if encrypted && cw.Keyring == nil {
+		common.LogError("L'archive %s est chiffrée mais aucune phrase secrète n'est disponible.", sourcePath)
+		return fmt.Errorf("archive chiffrée: phrase secrète requise pour %s", sourcePath)
+	}
+	if encrypted && format == FormatZip {
+		return fmt.Errorf("le chiffrement n'est pas pris en charge pour le format zip")
+	}
 
-	if strings.HasSuffix(sourcePath, ".tar.gz") || strings.HasSuffix(sourcePath, ".tgz") {
-		// SECURITY: Utiliser des arguments séparés pour tar.
-		cmd = exec.Command("tar", "-xzf", sourcePath, "-C", destPath)
-	} else if strings.HasSuffix(sourcePath, ".zip") {
-		// SECURITY: Utiliser des arguments séparés pour unzip.
-		cmd = exec.Command("unzip", sourcePath, "-d", destPath)
-	} else {
-		common.LogError("Format de compression non reconnu pour le fichier: %s", sourcePath)
-		return fmt.Errorf("format de compression non reconnu pour le fichier: %s", sourcePath)
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		common.LogError("Impossible d'ouvrir l'archive %s: %v", sourcePath, err)
+		return fmt.Errorf("impossible d'ouvrir l'archive: %w", err)
 	}
+	defer file.Close()
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("impossible de lire l'archive: %w", err)
+	}
+	counter := &progressCounter{progress: cw.Progress, total: info.Size()}
 
-	common.LogInfo("Exécution de la commande de décompression: %s %s", cmd.Path, strings.Join(cmd.Args, " "))
-	err := cmd.Run()
+	if format == FormatZip {
+		var zr *zip.Reader
+		zr, err = zip.NewReader(file, info.Size())
+		if err == nil {
+			err = extractZip(zr, extractor, counter, filter)
+		}
+	} else {
+		var in io.Reader = &countingReader{r: file, counter: counter}
+		if encrypted {
+			if in, err = cw.Keyring.NewReader(in); err != nil {
+				common.LogError("Impossible de déchiffrer l'archive %s: %v", sourcePath, err)
+				return fmt.Errorf("impossible de déchiffrer l'archive: %w", err)
+			}
+		}
+		dr, derr := newDecompressReader(in, format)
+		if derr != nil {
+			err = fmt.Errorf("archive illisible: %w", derr)
+		} else {
+			err = extractTar(tar.NewReader(dr), extractor, filter)
+			dr.Close()
+			if err == nil && encrypted {
+				// Lire le flux jusqu'au bout pour authentifier le dernier segment
+				_, err = io.Copy(io.Discard, in)
+			}
+		}
+	}
 	if err != nil {
 		common.LogError("Erreur lors de la décompression: %v", err)
 		return fmt.Errorf("erreur lors de la décompression: %w", err)
@@ -187,4 +309,103 @@ func (cw *CompressionWrapper) Decompress(sourcePath, destPath string) error {
 
 	common.LogInfo("Décompression terminée avec succès.")
 	return nil
-}
\ No newline at end of file
+}
+
+// WalkArchive parcourt le contenu d'une archive sans l'extraire, en appelant fn pour chaque
+// fichier régulier et lien symbolique. Les archives chiffrées sont déchiffrées à la volée.
+func (cw *CompressionWrapper) WalkArchive(sourcePath string, fn manifest.EntryFunc) error {
+	format, ok := FormatFromPath(sourcePath)
+	if !ok {
+		return fmt.Errorf("format de compression non reconnu pour le fichier: %s", sourcePath)
+	}
+	encrypted := strings.HasSuffix(sourcePath, encryption.Extension)
+	if encrypted && (cw.Keyring == nil || format == FormatZip) {
+		return fmt.Errorf("archive chiffrée: phrase secrète requise pour %s", sourcePath)
+	}
+
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("impossible d'ouvrir l'archive: %w", err)
+	}
+	defer file.Close()
+
+	if format == FormatZip {
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(file, info.Size())
+		if err != nil {
+			return fmt.Errorf("archive zip illisible: %w", err)
+		}
+		for _, f := range zr.File {
+			if err := walkZipFile(f, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var in io.Reader = file
+	if encrypted {
+		if in, err = cw.Keyring.NewReader(file); err != nil {
+			return fmt.Errorf("impossible de déchiffrer l'archive: %w", err)
+		}
+	}
+	dr, err := newDecompressReader(in, format)
+	if err != nil {
+		return fmt.Errorf("archive illisible: %w", err)
+	}
+	defer dr.Close()
+
+	tr := tar.NewReader(dr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("archive tar illisible: %w", err)
+		}
+		name := strings.TrimSuffix(header.Name, "/")
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			err = fn(name, header.FileInfo(), "", tr)
+		case tar.TypeSymlink:
+			err = fn(name, header.FileInfo(), header.Linkname, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if encrypted {
+		// Lire le flux jusqu'au bout pour authentifier le dernier segment
+		if _, err := io.Copy(io.Discard, in); err != nil {
+			return fmt.Errorf("archive chiffrée altérée: %w", err)
+		}
+	}
+	return nil
+}
+
+// walkZipFile transmet une entrée d'archive zip à fn
+func walkZipFile(f *zip.File, fn manifest.EntryFunc) error {
+	mode := f.Mode()
+	if mode.IsDir() || (!mode.IsRegular() && mode&os.ModeSymlink == 0) {
+		return nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	name := strings.TrimSuffix(f.Name, "/")
+	if mode&os.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(rc, 4096))
+		if err != nil {
+			return err
+		}
+		return fn(name, f.FileInfo(), string(target), nil)
+	}
+	return fn(name, f.FileInfo(), "", rc)
+}
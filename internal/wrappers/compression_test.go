@@ -1,9 +1,14 @@
 package wrappers
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func TestCompressionWrapper(t *testing.T) {
@@ -71,4 +76,278 @@ func TestCompressionWrapper(t *testing.T) {
 		t.Errorf("Extracted content doesn't match original. Expected: %s, Got: %s",
 			testContent, string(extractedContent))
 	}
-}
\ No newline at end of file
+}
+
+func TestCompressionFormatsPreserveMetadata(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "compress_formats_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	scriptPath := filepath.Join(sourceDir, "sub", "script.sh")
+	if err := os.WriteFile(scriptPath, []byte("#!/bin/sh\necho ok\n"), 0750); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(scriptPath, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+	if err := os.Symlink("sub/script.sh", filepath.Join(sourceDir, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	linkTime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	linkTimes := []unix.Timespec{unix.NsecToTimespec(linkTime.UnixNano()), unix.NsecToTimespec(linkTime.UnixNano())}
+	if err := unix.UtimesNanoAt(unix.AT_FDCWD, filepath.Join(sourceDir, "link"), linkTimes, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		t.Fatalf("Failed to set symlink mtime: %v", err)
+	}
+
+	cw, err := NewCompressionWrapper()
+	if err != nil {
+		t.Fatalf("Failed to create compression wrapper: %v", err)
+	}
+
+	for _, format := range []CompressionFormat{FormatTarGz, FormatZip, FormatTarZst, FormatTarXz} {
+		t.Run(string(format), func(t *testing.T) {
+			archivePath := filepath.Join(tempDir, "archive"+format.Extension())
+			extractDir := filepath.Join(tempDir, "extract_"+string(format))
+
+			if err := cw.Compress(sourceDir, archivePath, format); err != nil {
+				t.Fatalf("Compression failed: %v", err)
+			}
+			if err := cw.Decompress(archivePath, extractDir); err != nil {
+				t.Fatalf("Decompression failed: %v", err)
+			}
+
+			info, err := os.Stat(filepath.Join(extractDir, "sub", "script.sh"))
+			if err != nil {
+				t.Fatalf("Extracted file doesn't exist: %v", err)
+			}
+			if info.Mode().Perm() != 0750 {
+				t.Errorf("Expected mode 0750, got %o", info.Mode().Perm())
+			}
+			if !info.ModTime().Equal(modTime) {
+				t.Errorf("Expected mtime %v, got %v", modTime, info.ModTime())
+			}
+
+			target, err := os.Readlink(filepath.Join(extractDir, "link"))
+			if err != nil {
+				t.Fatalf("Extracted symlink missing: %v", err)
+			}
+			if target != "sub/script.sh" {
+				t.Errorf("Expected symlink target sub/script.sh, got %s", target)
+			}
+			linkInfo, err := os.Lstat(filepath.Join(extractDir, "link"))
+			if err != nil {
+				t.Fatalf("Extracted symlink missing: %v", err)
+			}
+			if !linkInfo.ModTime().Equal(linkTime) {
+				t.Errorf("Expected symlink mtime %v, got %v", linkTime, linkInfo.ModTime())
+			}
+		})
+	}
+}
+
+func TestDecompressRejectsPathTraversal(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "decompress_traversal_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	archivePath := filepath.Join(tempDir, "evil.tar.gz")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+	content := []byte("pwned")
+	if err := tw.WriteHeader(&tar.Header{Name: "../escaped.txt", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatalf("Failed to write header: %v", err)
+	}
+	tw.Write(content)
+	tw.Close()
+	gw.Close()
+	file.Close()
+
+	cw, err := NewCompressionWrapper()
+	if err != nil {
+		t.Fatalf("Failed to create compression wrapper: %v", err)
+	}
+	if err := cw.Decompress(archivePath, filepath.Join(tempDir, "extract")); err == nil {
+		t.Errorf("Expected decompression of a path traversal entry to fail")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "escaped.txt")); !os.IsNotExist(err) {
+		t.Errorf("File was written outside the destination")
+	}
+}
+
+func TestDecompressRejectsWritesThroughSymlink(t *testing.T) {
+	tempDir := t.TempDir()
+	outside := filepath.Join(tempDir, "outside")
+	if err := os.MkdirAll(outside, 0755); err != nil {
+		t.Fatalf("Failed to create outside dir: %v", err)
+	}
+
+	cw, err := NewCompressionWrapper()
+	if err != nil {
+		t.Fatalf("Failed to create compression wrapper: %v", err)
+	}
+	// Un lien vers l'extérieur, puis des entrées sous ce lien dont le parent n'existe pas encore
+	for _, entries := range [][]*tar.Header{
+		{
+			{Name: "link", Linkname: outside, Mode: 0777, Typeflag: tar.TypeSymlink},
+			{Name: "link/sub/file.txt", Mode: 0644, Typeflag: tar.TypeReg},
+		},
+		{
+			{Name: "link", Linkname: outside, Mode: 0777, Typeflag: tar.TypeSymlink},
+			{Name: "link/sub/", Mode: 0755, Typeflag: tar.TypeDir},
+		},
+		{
+			{Name: "link", Linkname: outside, Mode: 0777, Typeflag: tar.TypeSymlink},
+			{Name: "link/", Mode: 0700, Typeflag: tar.TypeDir},
+		},
+	} {
+		archivePath := filepath.Join(tempDir, "evil.tar.gz")
+		file, err := os.Create(archivePath)
+		if err != nil {
+			t.Fatalf("Failed to create archive: %v", err)
+		}
+		gw := gzip.NewWriter(file)
+		tw := tar.NewWriter(gw)
+		for _, h := range entries {
+			if err := tw.WriteHeader(h); err != nil {
+				t.Fatalf("Failed to write header: %v", err)
+			}
+		}
+		tw.Close()
+		gw.Close()
+		file.Close()
+
+		extractDir := filepath.Join(tempDir, "extract")
+		os.RemoveAll(extractDir)
+		if err := cw.Decompress(archivePath, extractDir); err == nil {
+			t.Errorf("Expected %s to be rejected", entries[1].Name)
+		}
+		if _, err := os.Lstat(filepath.Join(outside, "sub")); !os.IsNotExist(err) {
+			t.Fatalf("%s was written outside the destination", entries[1].Name)
+		}
+		if info, err := os.Stat(outside); err != nil {
+			t.Fatalf("Outside directory missing: %v", err)
+		} else if info.Mode().Perm() != 0755 {
+			t.Errorf("%s changed the outside directory mode to %o", entries[1].Name, info.Mode().Perm())
+		}
+	}
+}
+
+func TestDecompressRejectsHardlinkThroughSymlink(t *testing.T) {
+	tempDir := t.TempDir()
+	secret := filepath.Join(tempDir, "secret.txt")
+	if err := os.WriteFile(secret, []byte("host secret"), 0600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+
+	// writeArchive écrit une archive tar.gz composée des en-têtes donnés
+	writeArchive := func(name string, headers []*tar.Header, contents map[string][]byte) string {
+		path := filepath.Join(tempDir, name)
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("Failed to create archive: %v", err)
+		}
+		gw := gzip.NewWriter(file)
+		tw := tar.NewWriter(gw)
+		for _, h := range headers {
+			h.Size = int64(len(contents[h.Name]))
+			if err := tw.WriteHeader(h); err != nil {
+				t.Fatalf("Failed to write header: %v", err)
+			}
+			tw.Write(contents[h.Name])
+		}
+		tw.Close()
+		gw.Close()
+		file.Close()
+		return path
+	}
+
+	cw, err := NewCompressionWrapper()
+	if err != nil {
+		t.Fatalf("Failed to create compression wrapper: %v", err)
+	}
+
+	evil := writeArchive("evil.tar.gz", []*tar.Header{
+		{Name: "evil", Linkname: secret, Mode: 0777, Typeflag: tar.TypeSymlink},
+		{Name: "stolen.txt", Linkname: "evil", Mode: 0644, Typeflag: tar.TypeLink},
+	}, nil)
+	extractDir := filepath.Join(tempDir, "extract")
+	if err := cw.Decompress(evil, extractDir); err == nil {
+		t.Errorf("Expected a hardlink to a symlink to be rejected")
+	}
+	if content, err := os.ReadFile(filepath.Join(extractDir, "stolen.txt")); err == nil {
+		t.Errorf("Host file copied into the extraction: %q", content)
+	}
+
+	// Un lien dur vers un fichier de l'archive reste extrait
+	legit := writeArchive("legit.tar.gz", []*tar.Header{
+		{Name: "original.txt", Mode: 0644, Typeflag: tar.TypeReg},
+		{Name: "link.txt", Linkname: "original.txt", Mode: 0644, Typeflag: tar.TypeLink},
+	}, map[string][]byte{"original.txt": []byte("shared content")})
+	legitDir := filepath.Join(tempDir, "legit")
+	if err := cw.Decompress(legit, legitDir); err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(legitDir, "link.txt")); err != nil || string(content) != "shared content" {
+		t.Errorf("Expected hardlink content to be extracted, got %q (%v)", content, err)
+	}
+}
+
+func TestDecompressFilteredExtractsOnlySelectedEntries(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	files := map[string]string{
+		"docs/report.txt":  "report",
+		"docs/notes.txt":   "notes",
+		"photos/beach.jpg": "beach",
+		"top.txt":          "top",
+	}
+	for name, content := range files {
+		path := filepath.Join(sourceDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	cw, err := NewCompressionWrapper()
+	if err != nil {
+		t.Fatalf("Failed to create compression wrapper: %v", err)
+	}
+	for _, format := range []CompressionFormat{FormatTarGz, FormatZip} {
+		archive := filepath.Join(tempDir, "archive"+format.Extension())
+		if err := cw.Compress(sourceDir, archive, format); err != nil {
+			t.Fatalf("Compression to %s failed: %v", format, err)
+		}
+
+		extractDir := filepath.Join(tempDir, "extract-"+string(format))
+		only := func(name string) bool { return name == "docs/report.txt" || name == "top.txt" }
+		if err := cw.DecompressFiltered(archive, extractDir, only); err != nil {
+			t.Fatalf("DecompressFiltered of %s failed: %v", format, err)
+		}
+		for name, content := range files {
+			got, err := os.ReadFile(filepath.Join(extractDir, name))
+			if only(name) {
+				if err != nil || string(got) != content {
+					t.Errorf("%s: expected %s to be extracted, got %q (%v)", format, name, got, err)
+				}
+			} else if !os.IsNotExist(err) {
+				t.Errorf("%s: filtered out entry %s was extracted", format, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package wrappers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// ChangeType est la nature d'une modification détectée par une simulation rsync
+type ChangeType string
+
+const (
+	ChangeNew        ChangeType = "new"        // Élément absent de la sauvegarde de base
+	ChangeModified   ChangeType = "modified"   // Contenu modifié
+	ChangeDeleted    ChangeType = "deleted"    // Élément supprimé de la source
+	ChangeAttributes ChangeType = "attributes" // Seuls les attributs (date, permissions...) ont changé
+)
+
+// Change décrit un élément que la sauvegarde transférerait
+type Change struct {
+	Type  ChangeType `json:"type"`
+	Path  string     `json:"path"`
+	IsDir bool       `json:"isDir,omitempty"`
+	Size  int64      `json:"size,omitempty"` // Taille de l'élément dans la source (nouveaux et modifiés)
+}
+
+// RsyncDryRun simule une sauvegarde de source vers destination avec
+// rsync --dry-run --itemize-changes et renvoie les modifications détectées.
+// Rien n'est écrit: destination peut ne pas exister, tous les éléments sont alors nouveaux.
+func RsyncDryRun(source, destination string, opts BackupOptions) ([]Change, error) {
+	common.LogInfo("Simulation de sauvegarde rsync: Source=%s, Destination=%s", source, destination)
+	if _, err := os.Stat(source); err != nil {
+		common.LogError("Le répertoire source '%s' n'existe pas: %v", source, err)
+		return nil, fmt.Errorf("le répertoire source '%s' n'existe pas: %w", source, err)
+	}
+	if !strings.HasSuffix(source, "/") {
+		source = source + "/"
+	}
+	if !strings.HasSuffix(destination, "/") {
+		destination = destination + "/"
+	}
+
+	var out bytes.Buffer
+	options := RsyncOptions{
+		Source:      source,
+		Destination: destination,
+		Exclude:     append(append([]string{}, opts.ExcludeDirs...), opts.ExcludeFiles...),
+		Delete:      true,
+		Archive:     true,
+		DryRun:      true,
+		Stdout:      &out,
+	}
+	if err := ExecuteRsync(options); err != nil {
+		return nil, fmt.Errorf("erreur lors de la simulation rsync: %w", err)
+	}
+	return parseItemizedChanges(&out)
+}
+
+// parseItemizedChanges lit la sortie de rsync --itemize-changes ("YXcstpoguax chemin"
+// ou "*deleting chemin"). Les lignes qui ne décrivent pas un élément sont ignorées.
+func parseItemizedChanges(r io.Reader) ([]Change, error) {
+	var changes []Change
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "*deleting ") {
+			path := strings.TrimLeft(strings.TrimPrefix(line, "*deleting "), " ")
+			changes = append(changes, Change{
+				Type:  ChangeDeleted,
+				Path:  strings.TrimSuffix(path, "/"),
+				IsDir: strings.HasSuffix(path, "/"),
+			})
+			continue
+		}
+
+		sep := strings.IndexByte(line, ' ')
+		if sep < 3 || !strings.ContainsRune("<>ch.", rune(line[0])) || !strings.ContainsRune("fdLDS", rune(line[1])) {
+			continue
+		}
+		code, path := line[:sep], line[sep+1:]
+		if line[1] == 'L' {
+			// Lien symbolique: "chemin -> cible"
+			if i := strings.Index(path, " -> "); i >= 0 {
+				path = path[:i]
+			}
+		}
+		if path == "./" {
+			continue
+		}
+
+		var changeType ChangeType
+		attrs := code[2:]
+		switch {
+		case strings.Trim(attrs, "+") == "":
+			changeType = ChangeNew
+		case code[0] != '.':
+			changeType = ChangeModified
+		case strings.Trim(attrs, ". ") != "":
+			changeType = ChangeAttributes
+		default:
+			continue
+		}
+		changes = append(changes, Change{
+			Type:  changeType,
+			Path:  strings.TrimSuffix(path, "/"),
+			IsDir: line[1] == 'd',
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("impossible de lire la sortie de rsync: %w", err)
+	}
+	return changes, nil
+}
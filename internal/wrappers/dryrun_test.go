@@ -0,0 +1,43 @@
+package wrappers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseItemizedChanges(t *testing.T) {
+	output := strings.Join([]string{
+		"sending incremental file list",
+		".d..t...... ./",
+		"*deleting   old/removed.txt",
+		">f+++++++++ new.txt",
+		"cd+++++++++ newdir/",
+		">f.st...... changed.txt",
+		".f...p..... chmod.txt",
+		"cL+++++++++ link -> new.txt",
+		"",
+		"sent 123 bytes  received 45 bytes  336.00 bytes/sec",
+	}, "\n")
+
+	changes, err := parseItemizedChanges(strings.NewReader(output))
+	if err != nil {
+		t.Fatalf("parseItemizedChanges failed: %v", err)
+	}
+
+	expected := []Change{
+		{Type: ChangeDeleted, Path: "old/removed.txt"},
+		{Type: ChangeNew, Path: "new.txt"},
+		{Type: ChangeNew, Path: "newdir", IsDir: true},
+		{Type: ChangeModified, Path: "changed.txt"},
+		{Type: ChangeAttributes, Path: "chmod.txt"},
+		{Type: ChangeNew, Path: "link"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %d: %+v", len(expected), len(changes), changes)
+	}
+	for i, want := range expected {
+		if changes[i] != want {
+			t.Errorf("Change %d: expected %+v, got %+v", i, want, changes[i])
+		}
+	}
+}
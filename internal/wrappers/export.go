@@ -0,0 +1,127 @@
+package wrappers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ExportFormats associe les noms de format acceptés par l'export à leur format d'archive
+var ExportFormats = map[string]CompressionFormat{
+	"tar":     FormatTar,
+	"tar.gz":  FormatTarGz,
+	"tar.zst": FormatTarZst,
+	"tar.xz":  FormatTarXz,
+	"zip":     FormatZip,
+}
+
+// ParseExportFormat convertit le nom d'un format d'export (tar, tar.gz, tar.zst, tar.xz ou zip)
+func ParseExportFormat(name string) (CompressionFormat, error) {
+	format, ok := ExportFormats[strings.TrimPrefix(strings.ToLower(name), ".")]
+	if !ok {
+		return "", fmt.Errorf("format d'export non supporté: %q (attendu: tar, tar.gz, tar.zst, tar.xz ou zip)", name)
+	}
+	return format, nil
+}
+
+// ArchiveWriter écrit une archive en flux, élément par élément, à partir de contenus qui ne
+// sont pas forcément sur le disque (sauvegarde parcourue sans extraction). Rien n'est écrit
+// dans des fichiers temporaires: l'archive peut être envoyée directement dans un tube.
+type ArchiveWriter struct {
+	zw *zip.Writer
+	tw *tar.Writer
+	cw io.WriteCloser
+}
+
+// NewArchiveWriter crée une archive au format donné écrite dans w
+func NewArchiveWriter(w io.Writer, format CompressionFormat) (*ArchiveWriter, error) {
+	if format == FormatZip {
+		return &ArchiveWriter{zw: zip.NewWriter(w)}, nil
+	}
+	cw, err := newCompressWriter(w, format)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveWriter{tw: tar.NewWriter(cw), cw: cw}, nil
+}
+
+// Add ajoute un fichier régulier (content non nil) ou un lien symbolique vers target.
+// rel est le chemin dans l'archive, avec des slashes.
+func (aw *ArchiveWriter) Add(rel string, info os.FileInfo, target string, content io.Reader) error {
+	if aw.zw != nil {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if content != nil {
+			header.Method = zip.Deflate
+		}
+		w, err := aw.zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if content == nil {
+			// Convention zip: la cible du lien est stockée comme contenu de l'entrée
+			_, err = io.WriteString(w, target)
+			return err
+		}
+		_, err = io.Copy(w, content)
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, target)
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	// Format PAX pour conserver les noms longs et les dates à la nanoseconde
+	header.Format = tar.FormatPAX
+	if err := aw.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if content == nil {
+		return nil
+	}
+	n, err := io.Copy(aw.tw, content)
+	if err == nil && n != header.Size {
+		err = fmt.Errorf("taille de '%s' inattendue: %d octets au lieu de %d", rel, n, header.Size)
+	}
+	return err
+}
+
+// AddBytes ajoute un fichier régulier dont le contenu est en mémoire
+func (aw *ArchiveWriter) AddBytes(name string, data []byte, modTime time.Time) error {
+	info := memFileInfo{name: name, size: int64(len(data)), modTime: modTime}
+	return aw.Add(name, info, "", strings.NewReader(string(data)))
+}
+
+// Close termine l'archive. Le flux sous-jacent n'est pas fermé.
+func (aw *ArchiveWriter) Close() error {
+	if aw.zw != nil {
+		return aw.zw.Close()
+	}
+	err := aw.tw.Close()
+	if closeErr := aw.cw.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// memFileInfo décrit un fichier construit en mémoire
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (m memFileInfo) Name() string       { return m.name }
+func (m memFileInfo) Size() int64        { return m.size }
+func (m memFileInfo) Mode() os.FileMode  { return 0644 }
+func (m memFileInfo) ModTime() time.Time { return m.modTime }
+func (m memFileInfo) IsDir() bool        { return false }
+func (m memFileInfo) Sys() interface{}   { return nil }
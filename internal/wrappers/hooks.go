@@ -0,0 +1,52 @@
+package wrappers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// RunHook exécute un hook de sauvegarde. env contient les variables SAVEME_* décrivant
+// la sauvegarde; les variables propres au hook les complètent ou les remplacent.
+func RunHook(hook common.Hook, env map[string]string) error {
+	timeout := hook.Timeout
+	if timeout == 0 {
+		timeout = common.DefaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	// SECURITY: la commande est exécutée sans shell, les arguments ne sont pas interprétés
+	cmd := exec.CommandContext(ctx, hook.Command, hook.Args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	for _, vars := range []map[string]string{env, hook.Env} {
+		keys := make([]string, 0, len(vars))
+		for k := range vars {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			cmd.Env = append(cmd.Env, k+"="+vars[k])
+		}
+	}
+
+	common.LogInfo("Exécution du hook: %s %s", hook.Command, strings.Join(hook.Args, " "))
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		common.LogError("Hook %s interrompu après %d secondes.", hook.Command, timeout)
+		return fmt.Errorf("hook %s interrompu après %d secondes", hook.Command, timeout)
+	}
+	if err != nil {
+		common.LogError("Erreur lors de l'exécution du hook %s: %v", hook.Command, err)
+		return fmt.Errorf("erreur lors de l'exécution du hook %s: %w", hook.Command, err)
+	}
+	return nil
+}
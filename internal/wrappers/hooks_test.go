@@ -0,0 +1,40 @@
+package wrappers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+func TestRunHookPassesEnvironmentAndEnforcesTimeout(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "hooks_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	out := filepath.Join(tempDir, "out.txt")
+	hook := common.Hook{
+		Command: "sh",
+		Args:    []string{"-c", `printf '%s %s %s' "$SAVEME_BACKUP_ID" "$SAVEME_STATUS" "$EXTRA" > "$OUT"`},
+		Env:     map[string]string{"EXTRA": "custom", "OUT": out},
+	}
+	if err := RunHook(hook, map[string]string{"SAVEME_BACKUP_ID": "test-1", "SAVEME_STATUS": "success"}); err != nil {
+		t.Fatalf("RunHook failed: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Hook did not write output: %v", err)
+	}
+	if string(data) != "test-1 success custom" {
+		t.Errorf("Unexpected hook environment: %q", data)
+	}
+
+	slow := common.Hook{Command: "sleep", Args: []string{"5"}, Timeout: 1}
+	if err := RunHook(slow, nil); err == nil || !strings.Contains(err.Error(), "interrompu") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+}
@@ -2,19 +2,33 @@ package wrappers
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"os/exec"
 	"strings"
 
 	"github.com/Noziop/s4v3my4ss/pkg/common"
 )
 
+// Types d'événements de surveillance
+const (
+	EventCreate = "CREATE"
+	EventModify = "MODIFY"
+	EventDelete = "DELETE"
+	// EventMove est un renommage: OldPath est l'ancien chemin, Path le nouveau
+	EventMove = "MOVE"
+	// EventRescan signale que des événements ont été perdus (file d'attente du noyau pleine):
+	// tout le répertoire surveillé doit être considéré comme modifié
+	EventRescan = "RESCAN"
+)
+
 // WatchEvent représente un événement de modification de fichier
 type WatchEvent struct {
 	// Path est le chemin du fichier modifié
 	Path string
+	// OldPath est l'ancien chemin d'un fichier renommé (EventMove uniquement, vide si inconnu)
+	OldPath string
 	// EventType est le type d'événement (create, modify, delete, etc.)
 	EventType string
 	// IsDir indique si c'est un répertoire
@@ -24,12 +38,15 @@ type WatchEvent struct {
 // WatchCallback est la signature de la fonction de rappel appelée quand un fichier est modifié
 type WatchCallback func(event WatchEvent)
 
-// InotifyWrapper gère la surveillance des fichiers via inotify ou fswatch
+// InotifyWrapper gère la surveillance des fichiers: inotify natif sous Linux, fswatch ailleurs
 type InotifyWrapper struct {
-	// Vérifié indique si inotify/fswatch est disponible
+	// Vérifié indique si un mécanisme de surveillance est disponible
 	Verified bool
 	// UseInotify indique si on utilise inotify (true) ou fswatch (false)
 	UseInotify bool
+	// OnReady, si défini, est appelée dès que la surveillance est en place: aucune modification
+	// ultérieure ne peut plus être manquée. fswatch ne le signale pas, elle n'est alors jamais appelée.
+	OnReady func()
 }
 
 // NewInotifyWrapper crée une nouvelle instance de InotifyWrapper
@@ -39,8 +56,8 @@ func NewInotifyWrapper() (*InotifyWrapper, error) {
 		UseInotify: false,
 	}
 
-	// Vérifier si inotifywait est disponible
-	if common.IsCommandAvailable("inotifywait") {
+	// inotify est appelé directement, sans outil externe
+	if nativeInotify {
 		iw.Verified = true
 		iw.UseInotify = true
 		return iw, nil
@@ -53,74 +70,51 @@ func NewInotifyWrapper() (*InotifyWrapper, error) {
 		return iw, nil
 	}
 
-	return iw, fmt.Errorf("ni inotifywait ni fswatch ne sont installés")
+	return iw, fmt.Errorf("fswatch n'est pas installé")
 }
 
-// EnsureAvailable vérifie que inotify/fswatch est disponible, et tente de l'installer si ce n'est pas le cas
+// EnsureAvailable vérifie que la surveillance est disponible, et tente d'installer fswatch si ce n'est pas le cas
 func (iw *InotifyWrapper) EnsureAvailable() error {
 	if iw.Verified {
 		return nil
 	}
 
-	// Essayer d'installer inotify-tools d'abord (plus léger et plus commun)
-	if common.EnsureDependency("inotifywait", "inotify-tools") == nil {
-		iw.Verified = true
-		iw.UseInotify = true
-		return nil
-	}
-
-	// Si inotify n'a pas pu être installé, essayer fswatch
 	if common.EnsureDependency("fswatch", "fswatch") == nil {
 		iw.Verified = true
 		iw.UseInotify = false
 		return nil
 	}
 
-	return fmt.Errorf("impossible d'installer inotify-tools ou fswatch")
+	return fmt.Errorf("impossible d'installer fswatch")
 }
 
-// WatchDirectory surveille un répertoire pour les changements et appelle callback pour chaque événement
+// WatchDirectory surveille un répertoire pour les changements et appelle callback pour chaque
+// événement, jusqu'à l'annulation de ctx (renvoie alors nil)
 func (iw *InotifyWrapper) WatchDirectory(ctx context.Context, directory string, recursive bool, callback WatchCallback) error {
 	if err := iw.EnsureAvailable(); err != nil {
 		return err
 	}
-
-	var cmd *exec.Cmd
-	var stdout io.ReadCloser
-	var err error
-
 	if iw.UseInotify {
-		// Utiliser inotifywait
-		args := []string{
-			"-m",       // Mode surveillance continue
-			"-q",       // Mode silencieux
-			"--format", "%w%f %e", // Format de sortie: <chemin> <événement>
-			"-e", "create,modify,delete,move", // Types d'événements à surveiller
-		}
-
-		if recursive {
-			args = append(args, "-r") // Mode récursif
-		}
-
-		args = append(args, directory) // Répertoire à surveiller
-		cmd = exec.CommandContext(ctx, "inotifywait", args...)
-	} else {
-		// Utiliser fswatch
-		args := []string{
-			"-0",       // Terminer chaque événement par un caractère NULL
-			"--format", "%p %f", // Format: <chemin> <type>
-		}
-
-		if recursive {
-			args = append(args, "-r") // Mode récursif
-		}
+		return watchInotify(ctx, directory, recursive, callback, iw.OnReady)
+	}
+	return watchFswatch(ctx, directory, recursive, callback)
+}
 
-		args = append(args, directory) // Répertoire à surveiller
-		cmd = exec.CommandContext(ctx, "fswatch", args...)
+// watchFswatch surveille un répertoire avec fswatch
+func watchFswatch(ctx context.Context, directory string, recursive bool, callback WatchCallback) error {
+	args := []string{
+		"-0",                          // Terminer chaque événement par un caractère NULL
+		"-x",                          // Afficher les types d'événements
+		"--event-flag-separator", ",", // Types séparés par des virgules: le chemin est tout ce qui précède le dernier espace
+	}
+	if recursive {
+		args = append(args, "-r") // Mode récursif
 	}
+	args = append(args, directory) // Répertoire à surveiller
+	cmd := exec.CommandContext(ctx, "fswatch", args...)
 
 	// Obtenir la sortie standard
-	stdout, err = cmd.StdoutPipe()
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("erreur lors de la création du pipe: %w", err)
 	}
@@ -130,58 +124,58 @@ func (iw *InotifyWrapper) WatchDirectory(ctx context.Context, directory string,
 		return fmt.Errorf("erreur lors du démarrage de la surveillance: %w", err)
 	}
 
-	// Lancer une goroutine pour lire la sortie
-	go func() {
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			line := scanner.Text()
-			event := parseWatchEvent(line, iw.UseInotify)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(splitNull)
+	for scanner.Scan() {
+		if event, ok := parseFswatchEvent(scanner.Text()); ok {
 			callback(event)
 		}
-	}()
+	}
 
-	// Attendre que la commande se termine ou que le contexte soit annulé
-	go func() {
-		<-ctx.Done()
-		cmd.Process.Kill()
-	}()
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
 
-	return cmd.Wait()
+// splitNull découpe un flux en enregistrements terminés par un caractère NULL
+func splitNull(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
 }
 
-// parseWatchEvent convertit une ligne de sortie d'inotify/fswatch en un WatchEvent
-func parseWatchEvent(line string, isInotify bool) WatchEvent {
+// parseFswatchEvent convertit un enregistrement "<chemin> <type>,<type>..." de fswatch en un WatchEvent
+func parseFswatchEvent(record string) (WatchEvent, bool) {
 	var event WatchEvent
-
-	if isInotify {
-		// Format inotify: "<chemin> <événements>"
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) == 2 {
-			event.Path = parts[0]
-			event.EventType = parts[1]
-			// Vérifier si c'est un répertoire d'après les événements
-			event.IsDir = strings.Contains(parts[1], "ISDIR")
-		}
-	} else {
-		// Format fswatch: "<chemin> <type>"
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) == 2 {
-			event.Path = parts[0]
-			// Convertir les types d'événements fswatch en format cohérent
-			switch parts[1] {
-			case "Created":
-				event.EventType = "CREATE"
-			case "Updated", "OwnerModified", "AttributeModified":
-				event.EventType = "MODIFY"
-			case "Removed":
-				event.EventType = "DELETE"
-			case "Renamed":
-				event.EventType = "MOVE"
+	sep := strings.LastIndex(record, " ")
+	if sep <= 0 {
+		return event, false
+	}
+	event.Path = record[:sep]
+	for _, flag := range strings.Split(record[sep+1:], ",") {
+		// Convertir les types d'événements fswatch en format cohérent
+		switch flag {
+		case "Created":
+			event.EventType = EventCreate
+		case "Updated", "OwnerModified", "AttributeModified":
+			if event.EventType == "" {
+				event.EventType = EventModify
 			}
-			// fswatch n'indique pas directement si c'est un répertoire dans la sortie
-			// On pourrait implémenter une vérification supplémentaire si nécessaire
+		case "Removed":
+			event.EventType = EventDelete
+		case "Renamed", "MovedFrom", "MovedTo":
+			event.EventType = EventMove
+		case "IsDir":
+			event.IsDir = true
+		case "Overflow":
+			event.EventType = EventRescan
 		}
 	}
-
-	return event
-}
\ No newline at end of file
+	return event, event.EventType != ""
+}
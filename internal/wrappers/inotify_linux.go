@@ -0,0 +1,275 @@
+package wrappers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// nativeInotify indique que la surveillance appelle inotify directement
+const nativeInotify = true
+
+const (
+	// inotifyMask regroupe les événements surveillés sur chaque répertoire
+	inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_DELETE |
+		syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF |
+		syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW | syscall.IN_EXCL_UNLINK
+	// inotifyBufferSize est la taille du tampon de lecture des événements
+	inotifyBufferSize = 64 * 1024
+	// maxInotifyEvent est la taille maximale d'un événement (nom de fichier compris)
+	maxInotifyEvent = syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1
+)
+
+// inotifyWatcher surveille une arborescence avec inotify
+type inotifyWatcher struct {
+	fd        int
+	root      string
+	rootWd    int32
+	recursive bool
+	callback  WatchCallback
+	watches   map[int32]string // Descripteur de surveillance -> répertoire surveillé
+	moved     *pendingMove     // Départ d'un renommage en attente de son arrivée
+}
+
+// pendingMove est le départ d'un renommage (IN_MOVED_FROM), apparié à son arrivée par le cookie
+type pendingMove struct {
+	cookie uint32
+	path   string
+	isDir  bool
+}
+
+// watchInotify surveille un répertoire avec inotify jusqu'à l'annulation de ctx. ready, si non
+// nil, est appelée une fois toutes les surveillances en place.
+func watchInotify(ctx context.Context, directory string, recursive bool, callback WatchCallback, ready func()) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("impossible d'initialiser inotify: %w", err)
+	}
+	// Descripteur non bloquant: la lecture passe par le poller de Go et la fermeture l'interrompt
+	file := os.NewFile(uintptr(fd), "inotify")
+	defer file.Close()
+
+	w := &inotifyWatcher{
+		fd:        fd,
+		root:      filepath.Clean(directory),
+		rootWd:    -1,
+		recursive: recursive,
+		callback:  callback,
+		watches:   make(map[int32]string),
+	}
+	if err := w.addTree(w.root, false); err != nil {
+		return err
+	}
+	common.LogInfo("Surveillance inotify de %s: %d répertoire(s).", w.root, len(w.watches))
+	if ready != nil {
+		ready()
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			file.Close()
+		case <-stop:
+		}
+	}()
+
+	buf := make([]byte, inotifyBufferSize)
+	for {
+		n, err := file.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("erreur de lecture des événements inotify: %w", err)
+		}
+		if err := w.process(buf[:n], n > len(buf)-maxInotifyEvent); err != nil {
+			return err
+		}
+	}
+}
+
+// process traite les événements d'une lecture. full indique que le tampon était plein: la
+// suite d'un renommage peut alors se trouver dans la lecture suivante.
+func (w *inotifyWatcher) process(buf []byte, full bool) error {
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= len(buf); {
+		raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + syscall.SizeofInotifyEvent
+		nameEnd := nameStart + int(raw.Len)
+		if nameEnd > len(buf) {
+			return fmt.Errorf("événement inotify tronqué")
+		}
+		name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+		offset = nameEnd
+		if err := w.handle(raw.Wd, raw.Mask, raw.Cookie, name); err != nil {
+			return err
+		}
+	}
+	if !full {
+		w.flushMove()
+	}
+	return nil
+}
+
+// handle traite un événement inotify
+func (w *inotifyWatcher) handle(wd int32, mask, cookie uint32, name string) error {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// Des événements ont été perdus, y compris peut-être des créations de répertoires à surveiller
+		w.flushMove()
+		common.LogWarning("File d'événements inotify pleine pour %s: nouvelle analyse complète.", w.root)
+		if w.recursive {
+			if err := w.addTree(w.root, false); err != nil {
+				return err
+			}
+		}
+		w.callback(WatchEvent{Path: w.root, EventType: EventRescan, IsDir: true})
+		return nil
+	}
+
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.watches, wd)
+		if wd == w.rootWd {
+			return fmt.Errorf("le répertoire surveillé %s a été supprimé ou démonté", w.root)
+		}
+		return nil
+	}
+	dir, ok := w.watches[wd]
+	if !ok {
+		// Événement d'une surveillance déjà retirée
+		return nil
+	}
+	if mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 {
+		// Les sous-répertoires sont suivis par les événements de leur parent
+		if wd == w.rootWd && mask&syscall.IN_MOVE_SELF != 0 {
+			return fmt.Errorf("le répertoire surveillé %s a été déplacé", w.root)
+		}
+		return nil
+	}
+
+	path := filepath.Join(dir, name)
+	isDir := mask&syscall.IN_ISDIR != 0
+	if w.moved != nil && (mask&syscall.IN_MOVED_TO == 0 || cookie != w.moved.cookie) {
+		w.flushMove()
+	}
+
+	switch {
+	case mask&syscall.IN_MOVED_FROM != 0:
+		w.moved = &pendingMove{cookie: cookie, path: path, isDir: isDir}
+	case mask&syscall.IN_MOVED_TO != 0:
+		if from := w.moved; from != nil {
+			w.moved = nil
+			if isDir {
+				w.renameWatches(from.path, path)
+			}
+			w.callback(WatchEvent{Path: path, OldPath: from.path, EventType: EventMove, IsDir: isDir})
+			return nil
+		}
+		// Arrivée depuis l'extérieur de l'arborescence surveillée
+		return w.created(path, isDir)
+	case mask&syscall.IN_CREATE != 0:
+		return w.created(path, isDir)
+	case mask&syscall.IN_DELETE != 0:
+		w.callback(WatchEvent{Path: path, EventType: EventDelete, IsDir: isDir})
+	case mask&(syscall.IN_MODIFY|syscall.IN_ATTRIB) != 0:
+		// Contenu ou métadonnées (permissions, dates...) modifiés
+		w.callback(WatchEvent{Path: path, EventType: EventModify, IsDir: isDir})
+	}
+	return nil
+}
+
+// created signale un élément apparu et surveille son contenu si c'est un répertoire
+func (w *inotifyWatcher) created(path string, isDir bool) error {
+	w.callback(WatchEvent{Path: path, EventType: EventCreate, IsDir: isDir})
+	if isDir && w.recursive {
+		return w.addTree(path, true)
+	}
+	return nil
+}
+
+// flushMove signale comme supprimé un départ de renommage sans arrivée: l'élément a quitté
+// l'arborescence surveillée
+func (w *inotifyWatcher) flushMove() {
+	from := w.moved
+	if from == nil {
+		return
+	}
+	w.moved = nil
+	if from.isDir {
+		w.removeWatches(from.path)
+	}
+	w.callback(WatchEvent{Path: from.path, EventType: EventDelete, IsDir: from.isDir})
+}
+
+// addTree surveille un répertoire et, en mode récursif, ses sous-répertoires. report signale
+// le contenu trouvé comme créé: il a pu apparaître avant que la surveillance ne soit en place.
+func (w *inotifyWatcher) addTree(dir string, report bool) error {
+	if !w.recursive {
+		return w.addWatch(dir)
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == w.root {
+				return fmt.Errorf("impossible de surveiller %s: %w", path, err)
+			}
+			// Élément supprimé entre-temps ou illisible
+			common.LogWarning("Surveillance impossible de %s: %v", path, err)
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if report && path != dir {
+			w.callback(WatchEvent{Path: path, EventType: EventCreate, IsDir: info.IsDir()})
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		return w.addWatch(path)
+	})
+}
+
+// addWatch ajoute une surveillance sur un répertoire
+func (w *inotifyWatcher) addWatch(dir string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		if err == syscall.ENOSPC {
+			return fmt.Errorf("limite de surveillances inotify atteinte pour %s (augmentez fs.inotify.max_user_watches)", dir)
+		}
+		if dir == w.root {
+			return fmt.Errorf("impossible de surveiller %s: %w", dir, err)
+		}
+		common.LogWarning("Surveillance impossible de %s: %v", dir, err)
+		return nil
+	}
+	w.watches[int32(wd)] = dir
+	if dir == w.root {
+		w.rootWd = int32(wd)
+	}
+	return nil
+}
+
+// renameWatches met à jour les chemins des surveillances d'un répertoire renommé
+func (w *inotifyWatcher) renameWatches(oldDir, newDir string) {
+	for wd, dir := range w.watches {
+		if dir == oldDir || strings.HasPrefix(dir, oldDir+string(filepath.Separator)) {
+			w.watches[wd] = newDir + dir[len(oldDir):]
+		}
+	}
+}
+
+// removeWatches retire les surveillances d'un répertoire sorti de l'arborescence
+func (w *inotifyWatcher) removeWatches(oldDir string) {
+	for wd, dir := range w.watches {
+		if dir == oldDir || strings.HasPrefix(dir, oldDir+string(filepath.Separator)) {
+			syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.watches, wd)
+		}
+	}
+}
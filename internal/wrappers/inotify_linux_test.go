@@ -0,0 +1,164 @@
+package wrappers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// waitEvent attend un événement satisfaisant match, en ignorant les autres
+func waitEvent(t *testing.T, events <-chan WatchEvent, desc string, match func(WatchEvent) bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if match(event) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Event not received: %s", desc)
+		}
+	}
+}
+
+func TestWatchInotify(t *testing.T) {
+	root := t.TempDir()
+	events := make(chan WatchEvent, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	ready := make(chan struct{})
+	go func() {
+		done <- watchInotify(ctx, root, true, func(event WatchEvent) { events <- event }, func() { close(ready) })
+	}()
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watcher never became ready")
+	}
+
+	spaced := filepath.Join(root, "a file.txt")
+	if err := os.WriteFile(spaced, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, events, "creation of a path with a space", func(e WatchEvent) bool {
+		return e.EventType == EventCreate && e.Path == spaced
+	})
+
+	sub := filepath.Join(root, "sub dir")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, events, "directory creation", func(e WatchEvent) bool {
+		return e.EventType == EventCreate && e.Path == sub && e.IsDir
+	})
+	inner := filepath.Join(sub, "inner.txt")
+	if err := os.WriteFile(inner, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, events, "creation in a new directory", func(e WatchEvent) bool {
+		return e.EventType == EventCreate && e.Path == inner
+	})
+
+	renamed := filepath.Join(sub, "renamed.txt")
+	if err := os.Rename(spaced, renamed); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, events, "rename pair", func(e WatchEvent) bool {
+		return e.EventType == EventMove && e.OldPath == spaced && e.Path == renamed
+	})
+
+	moved := filepath.Join(root, "moved dir")
+	if err := os.Rename(sub, moved); err != nil {
+		t.Fatal(err)
+	}
+	after := filepath.Join(moved, "after.txt")
+	if err := os.WriteFile(after, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, events, "creation in a renamed directory", func(e WatchEvent) bool {
+		return e.EventType == EventCreate && e.Path == after
+	})
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected nil error after cancellation, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watcher did not stop after cancellation")
+	}
+}
+
+// rawInotifyEvent encode un événement inotify tel que le noyau le renvoie
+func rawInotifyEvent(wd int32, mask, cookie uint32, name string) []byte {
+	nameLen := 0
+	if name != "" {
+		nameLen = (len(name) + 4) &^ 3
+	}
+	buf := make([]byte, syscall.SizeofInotifyEvent+nameLen)
+	*(*syscall.InotifyEvent)(unsafe.Pointer(&buf[0])) = syscall.InotifyEvent{Wd: wd, Mask: mask, Cookie: cookie, Len: uint32(nameLen)}
+	copy(buf[syscall.SizeofInotifyEvent:], name)
+	return buf
+}
+
+func TestInotifyOverflowAndOrphanMove(t *testing.T) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		t.Fatalf("InotifyInit1 failed: %v", err)
+	}
+	defer syscall.Close(fd)
+
+	root := t.TempDir()
+	var got []WatchEvent
+	w := &inotifyWatcher{
+		fd:        fd,
+		root:      root,
+		rootWd:    -1,
+		recursive: true,
+		callback:  func(event WatchEvent) { got = append(got, event) },
+		watches:   make(map[int32]string),
+	}
+	if err := w.addTree(root, false); err != nil {
+		t.Fatalf("addTree failed: %v", err)
+	}
+
+	// Répertoire créé pendant que des événements étaient perdus
+	missed := filepath.Join(root, "missed")
+	if err := os.Mkdir(missed, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.process(rawInotifyEvent(-1, syscall.IN_Q_OVERFLOW, 0, ""), false); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if len(got) != 1 || got[0].EventType != EventRescan || got[0].Path != root {
+		t.Fatalf("Expected a rescan event, got %+v", got)
+	}
+	watched := false
+	for _, dir := range w.watches {
+		watched = watched || dir == missed
+	}
+	if !watched {
+		t.Errorf("Directory created during the overflow is not watched: %v", w.watches)
+	}
+
+	// Départ d'un renommage sans arrivée: l'élément a quitté l'arborescence
+	got = nil
+	if err := w.process(rawInotifyEvent(w.rootWd, syscall.IN_MOVED_FROM, 7, "gone.txt"), true); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("Move reported before its pair could arrive: %+v", got)
+	}
+	if err := w.process(rawInotifyEvent(w.rootWd, syscall.IN_CREATE, 0, "new.txt"), false); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if len(got) != 2 || got[0].EventType != EventDelete || got[0].Path != filepath.Join(root, "gone.txt") || got[1].EventType != EventCreate {
+		t.Errorf("Expected delete then create, got %+v", got)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package wrappers
+
+import (
+	"context"
+	"fmt"
+)
+
+// nativeInotify indique que la surveillance appelle inotify directement
+const nativeInotify = false
+
+// watchInotify n'est pas disponible hors de Linux: fswatch est utilisé à la place
+func watchInotify(ctx context.Context, directory string, recursive bool, callback WatchCallback, ready func()) error {
+	return fmt.Errorf("inotify n'est disponible que sous Linux")
+}
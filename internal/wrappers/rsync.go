@@ -1,8 +1,10 @@
 package wrappers
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -73,6 +75,7 @@ type RsyncOptions struct {
 	Source                string
 	Destination           string
 	Exclude               []string
+	Include               []string // Motifs à transférer seuls (restauration sélective), ancrés à la racine de la source
 	Delete                bool
 	Archive               bool
 	Compression           bool
@@ -87,40 +90,62 @@ type RsyncOptions struct {
 	LinkDest              string // Chemin vers la sauvegarde précédente
 	SSHPrivateKeyPath     string // Chemin vers la clé privée SSH
 	SSHHostKeyFingerprint string // Empreinte de la clé de l'hôte SSH
+	DryRun                bool      // Simuler le transfert (--dry-run --itemize-changes)
+	Stdout                io.Writer // Sortie de rsync (os.Stdout si nil)
+	NoOwner               bool      // Avec Archive, ne pas reproduire propriétaire et groupe (--no-owner --no-group)
+	FilesFrom             string    // Fichier listant les seuls chemins à transférer, séparés par des caractères NULL (--files-from)
 }
 
 // ExecuteRsync exécute une commande rsync avec les options spécifiées de manière sécurisée.
 func ExecuteRsync(options RsyncOptions) error {
+	_, err := ExecuteRsyncWithStats(options)
+	return err
+}
+
+// ExecuteRsyncWithStats exécute rsync comme ExecuteRsync et renvoie les statistiques
+// du transfert, lues dans la sortie de --stats (nil si l'option Progress n'est pas active).
+func ExecuteRsyncWithStats(options RsyncOptions) (*common.TransferStats, error) {
 	common.LogSecurity("Exécution de rsync avec les options: Source=%s, Destination=%s, Remote=%t", options.Source, options.Destination, options.Remote)
 	// SECURITY: Valider toutes les entrées pour prévenir les injections de commande et les chemins non autorisés.
 	if !common.IsValidPath(options.Source) {
 		common.LogError("Chemin source invalide ou non sécurisé: %s", options.Source)
-		return fmt.Errorf("chemin source invalide ou non sécurisé: %s", options.Source)
+		return nil, fmt.Errorf("chemin source invalide ou non sécurisé: %s", options.Source)
 	}
 	if !common.IsValidPath(options.Destination) {
 		common.LogError("Chemin destination invalide ou non sécurisé: %s", options.Destination)
-		return fmt.Errorf("chemin destination invalide ou non sécurisé: %s", options.Destination)
+		return nil, fmt.Errorf("chemin destination invalide ou non sécurisé: %s", options.Destination)
 	}
-	if options.LinkDest != "" && !common.IsValidPath(options.LinkDest) {
+	// Sur un serveur distant, la sauvegarde de base est désignée relativement à la destination (../<répertoire>)
+	if options.LinkDest != "" && !common.IsValidPath(strings.TrimPrefix(options.LinkDest, "../")) {
 		common.LogError("Chemin link-dest invalide ou non sécurisé: %s", options.LinkDest)
-		return fmt.Errorf("chemin link-dest invalide ou non sécurisé: %s", options.LinkDest)
+		return nil, fmt.Errorf("chemin link-dest invalide ou non sécurisé: %s", options.LinkDest)
+	}
+	if options.FilesFrom != "" && !common.IsValidPath(options.FilesFrom) {
+		common.LogError("Liste de fichiers invalide ou non sécurisée: %s", options.FilesFrom)
+		return nil, fmt.Errorf("liste de fichiers invalide ou non sécurisée: %s", options.FilesFrom)
 	}
 	if options.Username != "" && !common.IsValidName(options.Username) {
 		common.LogError("Nom d'utilisateur invalide: %s", options.Username)
-		return fmt.Errorf("nom d'utilisateur invalide: %s", options.Username)
+		return nil, fmt.Errorf("nom d'utilisateur invalide: %s", options.Username)
 	}
 	if options.Hostname != "" && !common.IsValidName(options.Hostname) {
 		common.LogError("Nom d'hôte invalide: %s", options.Hostname)
-		return fmt.Errorf("nom d'hôte invalide: %s", options.Hostname)
+		return nil, fmt.Errorf("nom d'hôte invalide: %s", options.Hostname)
 	}
 	if options.Module != "" && !common.IsValidName(options.Module) {
 		common.LogError("Nom de module invalide: %s", options.Module)
-		return fmt.Errorf("nom de module invalide: %s", options.Module)
+		return nil, fmt.Errorf("nom de module invalide: %s", options.Module)
 	}
 	for _, exclude := range options.Exclude {
 		if !common.IsValidExcludePattern(exclude) {
 			common.LogError("Modèle d'exclusion invalide: %s", exclude)
-			return fmt.Errorf("modèle d'exclusion invalide: %s", exclude)
+			return nil, fmt.Errorf("modèle d'exclusion invalide: %s", exclude)
+		}
+	}
+	for _, include := range options.Include {
+		if !common.IsValidExcludePattern(include) {
+			common.LogError("Modèle d'inclusion invalide: %s", include)
+			return nil, fmt.Errorf("modèle d'inclusion invalide: %s", include)
 		}
 	}
 
@@ -129,6 +154,9 @@ func ExecuteRsync(options RsyncOptions) error {
 	// Options de base
 	if options.Archive {
 		args = append(args, "-a")
+		if options.NoOwner {
+			args = append(args, "--no-owner", "--no-group")
+		}
 	}
 	if options.Compression {
 		args = append(args, "-z")
@@ -139,17 +167,40 @@ func ExecuteRsync(options RsyncOptions) error {
 	if options.Progress {
 		args = append(args, "--progress", "--stats")
 	}
+	if options.DryRun {
+		args = append(args, "--dry-run", "--itemize-changes")
+	}
 
 	// Options pour la sauvegarde incrémentale
 	if options.Incremental && options.LinkDest != "" {
 		args = append(args, "--link-dest="+options.LinkDest)
 	}
 
+	// Liste des chemins à transférer: les répertoires listés sont transférés sans leur contenu
+	if options.FilesFrom != "" {
+		args = append(args, "--files-from="+options.FilesFrom, "--from0")
+	}
+
 	// Exclusions
 	for _, exclude := range options.Exclude {
 		args = append(args, "--exclude="+exclude)
 	}
 
+	// Inclusions: parcourir tous les répertoires, ne garder que les éléments retenus
+	// (et le contenu des répertoires retenus), puis exclure le reste
+	if len(options.Include) > 0 {
+		args = append(args, "--include=*/")
+		for _, include := range options.Include {
+			include = "/" + strings.Trim(strings.TrimPrefix(include, "./"), "/")
+			args = append(args, "--include="+include, "--include="+include+"/***")
+			// Pour rsync, "/**/" exige au moins un répertoire intermédiaire
+			if flat := strings.ReplaceAll(include, "/**/", "/"); flat != include {
+				args = append(args, "--include="+flat, "--include="+flat+"/***")
+			}
+		}
+		args = append(args, "--exclude=*", "--prune-empty-dirs")
+	}
+
 	// Configuration SSH pour les serveurs distants
 	sshCommand := "ssh"
 	if options.Remote {
@@ -171,7 +222,7 @@ func ExecuteRsync(options RsyncOptions) error {
 		if options.SSHPrivateKeyPath != "" {
 			if !common.IsValidPath(options.SSHPrivateKeyPath) {
 				common.LogError("Chemin de la clé privée SSH invalide: %s", options.SSHPrivateKeyPath)
-				return fmt.Errorf("chemin de la clé privée SSH invalide: %s", options.SSHPrivateKeyPath)
+				return nil, fmt.Errorf("chemin de la clé privée SSH invalide: %s", options.SSHPrivateKeyPath)
 			}
 			sshOptions = append(sshOptions, "-i", options.SSHPrivateKeyPath)
 		}
@@ -185,28 +236,42 @@ func ExecuteRsync(options RsyncOptions) error {
 
 	// Exécuter la commande
 	cmd := exec.CommandContext(context.Background(), "rsync", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	stdout := io.Writer(os.Stdout)
+	if options.Stdout != nil {
+		stdout = options.Stdout
+	}
+	stats := &statsWriter{}
+	stderr := &errorCounter{w: os.Stderr}
+	cmd.Stdout = io.MultiWriter(stdout, stats)
+	cmd.Stderr = stderr
 
 	common.LogInfo("Exécution de la commande rsync: rsync %s", strings.Join(args, " "))
 
 	err := cmd.Run()
 	if err != nil {
 		common.LogError("Erreur lors de l'exécution de rsync: %v", err)
-		return fmt.Errorf("erreur lors de l'exécution de rsync: %w", err)
+		return nil, fmt.Errorf("erreur lors de l'exécution de rsync: %w", err)
 	}
 
 	common.LogInfo("Commande rsync exécutée avec succès.")
-	return nil
+	result := stats.result()
+	if result != nil {
+		result.Errors = stderr.count
+	}
+	return result, nil
 }
 
-// RsyncBackup effectue une sauvegarde avec rsync
-func RsyncBackup(source, destination string, excludeDirs, excludeFiles []string, compression bool, remoteServer *common.RsyncServerConfig) error {
+// RsyncBackup effectue une sauvegarde avec rsync.
+// Pour une destination locale, les fichiers sont copiés directement dans destination.
+// Pour un serveur distant, un sous-répertoire horodaté est créé sur le serveur.
+// La sauvegarde parente éventuelle (--link-dest) est choisie par l'appelant via opts.
+// Retourne le chemin effectivement utilisé pour la sauvegarde et les statistiques du transfert.
+func RsyncBackup(source, destination string, opts BackupOptions, compression bool, remoteServer *common.RsyncServerConfig) (string, *common.TransferStats, error) {
 	common.LogInfo("Début de la sauvegarde rsync: Source=%s, Destination=%s", source, destination)
 	// Vérifier que le répertoire source existe
 	if _, err := os.Stat(source); err != nil {
 		common.LogError("Le répertoire source '%s' n'existe pas: %v", source, err)
-		return fmt.Errorf("le répertoire source '%s' n'existe pas: %v", source, err)
+		return "", nil, fmt.Errorf("le répertoire source '%s' n'existe pas: %v", source, err)
 	}
 
 	// S'assurer que le chemin source se termine par un slash
@@ -216,29 +281,16 @@ func RsyncBackup(source, destination string, excludeDirs, excludeFiles []string,
 
 	// Construire la liste des exclusions
 	excludes := []string{}
-	for _, dir := range excludeDirs {
-		excludes = append(excludes, dir)
-	}
-	for _, file := range excludeFiles {
-		excludes = append(excludes, file)
-	}
-
-	// Générer un horodatage unique pour cette sauvegarde
-	timestamp := fmt.Sprintf("%s", strings.Replace(
-		strings.Replace(
-			strings.Replace(
-				time.Now().Format("2006-01-02 15:04:05"), 
-				" ", "_", -1), 
-			":", "-", -1), 
-		"+", "", -1))
+	excludes = append(excludes, opts.ExcludeDirs...)
+	excludes = append(excludes, opts.ExcludeFiles...)
 
-	// Construire le chemin de destination final avec timestamp pour éviter d'écraser les sauvegardes existantes
 	finalDestination := destination
-	var lastBackupPath string
-	var isIncremental bool
 
 	// Si on utilise un serveur distant, préparer des chemins spécifiques
 	if remoteServer != nil {
+		// Générer un horodatage unique pour cette sauvegarde
+		timestamp := strings.NewReplacer(" ", "_", ":", "-", "+", "").Replace(time.Now().Format("2006-01-02 15:04:05"))
+
 		// Extraire le nom du répertoire source pour l'utiliser comme base du nom du répertoire de sauvegarde
 		sourceBaseName := filepath.Base(strings.TrimSuffix(source, "/"))
 		
@@ -266,59 +318,6 @@ func RsyncBackup(source, destination string, excludeDirs, excludeFiles []string,
 				timestamp,
 				common.GenerateRandomString(6))
 		}
-
-		// Chercher la dernière sauvegarde pour créer une sauvegarde incrémentale
-		backups, err := common.ListBackups()
-		if err == nil {
-			var lastBackup *common.BackupInfo
-			for i := range backups {
-				b := &backups[i]
-				// Vérifier si c'est une sauvegarde du même répertoire source vers le même serveur distant
-				if b.SourcePath == source && 
-					b.RemoteServer != nil && 
-					b.RemoteServer.IP == remoteServer.IP {
-						if lastBackup == nil || b.Time.After(lastBackup.Time) {
-							lastBackup = b
-						}
-				}
-			}
-
-			if lastBackup != nil {
-				// Utiliser le chemin de la dernière sauvegarde pour link-dest
-				lastBackupPath = lastBackup.BackupPath
-				isIncremental = true
-				common.LogInfo("Sauvegarde incrémentale basée sur: %s", lastBackupPath)
-			} else {
-				common.LogInfo("Aucune sauvegarde précédente trouvée. Création d'une sauvegarde complète.")
-			}
-		}
-	} else {
-		// Pour les sauvegardes locales, créer un sous-répertoire avec timestamp
-		finalDestination = filepath.Join(destination, timestamp)
-		
-		// Vérifier s'il existe déjà des sauvegardes pour ce répertoire
-		backups, err := common.ListBackups()
-		if err == nil {
-			var lastBackup *common.BackupInfo
-			for i := range backups {
-				b := &backups[i]
-				// Vérifier si c'est une sauvegarde du même répertoire source
-				if b.SourcePath == source && b.RemoteServer == nil {
-					if lastBackup == nil || b.Time.After(lastBackup.Time) {
-						lastBackup = b
-					}
-				}
-			}
-
-			if lastBackup != nil {
-				// Utiliser le chemin de la dernière sauvegarde pour link-dest
-				lastBackupPath = lastBackup.BackupPath
-				isIncremental = true
-				common.LogInfo("Sauvegarde incrémentale basée sur: %s", lastBackupPath)
-			} else {
-				common.LogInfo("Aucune sauvegarde précédente trouvée. Création d'une sauvegarde complète.")
-			}
-		}
 	}
 
 	// Préparer les options
@@ -332,10 +331,30 @@ func RsyncBackup(source, destination string, excludeDirs, excludeFiles []string,
 		Progress:    true,
 	}
 
-	// Configurer pour sauvegarde incrémentale si possible
-	if isIncremental && lastBackupPath != "" {
+	// Ne transférer que les chemins listés, sans parcourir toute la source
+	if opts.Files != nil {
+		list, err := writeFileList(opts.Files)
+		if err != nil {
+			return "", nil, err
+		}
+		defer os.Remove(list)
+		options.FilesFrom = list
+		// Les chemins non listés ne sont pas transférés, et non supprimés: les suppressions sont
+		// à la charge de l'appelant
+		options.Delete = false
+		common.LogInfo("Transfert limité à %d chemin(s) modifié(s).", len(opts.Files))
+	}
+
+	// Configurer pour sauvegarde incrémentale si une sauvegarde parente a été fournie
+	if opts.Incremental && opts.LinkDest != "" {
 		options.Incremental = true
-		options.LinkDest = lastBackupPath
+		options.LinkDest = opts.LinkDest
+		if remoteServer != nil {
+			options.LinkDest = remoteLinkDest(opts.LinkDest)
+		}
+		common.LogInfo("Sauvegarde incrémentale basée sur: %s", opts.LinkDest)
+	} else {
+		common.LogInfo("Aucune sauvegarde parente fournie. Création d'une sauvegarde complète.")
 	}
 
 	// Si on utilise un serveur distant
@@ -352,23 +371,34 @@ func RsyncBackup(source, destination string, excludeDirs, excludeFiles []string,
 	if remoteServer == nil {
 		if err := os.MkdirAll(finalDestination, 0755); err != nil {
 			common.LogError("Impossible de créer le répertoire de destination: %v", err)
-			return fmt.Errorf("impossible de créer le répertoire de destination: %v", err)
+			return "", nil, fmt.Errorf("impossible de créer le répertoire de destination: %v", err)
 		}
 	}
 
 	// Exécuter rsync
 	common.LogInfo("Lancement de rsync pour %s vers %s...", source, finalDestination)
-	if err := ExecuteRsync(options); err != nil {
+	stats, err := ExecuteRsyncWithStats(options)
+	if err != nil {
 		common.LogError("Erreur rsync lors de la sauvegarde: %v", err)
-		return fmt.Errorf("erreur rsync: %v", err)
+		return "", nil, fmt.Errorf("erreur rsync: %v", err)
 	}
 
 	common.LogInfo("Sauvegarde rsync terminée avec succès.")
-	return nil
+	return finalDestination, stats, nil
 }
 
-// RsyncRestore restaure une sauvegarde avec rsync
-func RsyncRestore(source, destination string, remoteServer *common.RsyncServerConfig) error {
+// remoteLinkDest convertit le chemin d'une sauvegarde distante, tel qu'enregistré par RsyncBackup,
+// en argument de --link-dest: rsync l'interprète côté serveur, relativement à la nouvelle
+// sauvegarde, qui est créée dans le même répertoire
+func remoteLinkDest(backupPath string) string {
+	return "../" + filepath.Base(strings.TrimSuffix(backupPath, "/"))
+}
+
+// RsyncRestore restaure une sauvegarde avec rsync.
+// Si opts.Include n'est pas vide, seuls les éléments correspondants sont restaurés.
+// Avec un serveur distant, source est le chemin de la sauvegarde sur ce serveur, tel
+// qu'enregistré par RsyncBackup (module rsync ou chemin SSH).
+func RsyncRestore(source, destination string, opts RestoreOptions, remoteServer *common.RsyncServerConfig) error {
 	common.LogInfo("Début de la restauration rsync: Source=%s, Destination=%s", source, destination)
 	// Vérifier que le répertoire source existe (sauf si c'est distant)
 	if remoteServer == nil {
@@ -376,6 +406,8 @@ func RsyncRestore(source, destination string, remoteServer *common.RsyncServerCo
 			common.LogError("Le répertoire source '%s' n'existe pas: %v", source, err)
 			return fmt.Errorf("le répertoire source '%s' n'existe pas: %v", source, err)
 		}
+	} else {
+		source = RemotePath(remoteServer, source)
 	}
 
 	// S'assurer que le chemin source se termine par un slash
@@ -393,30 +425,13 @@ func RsyncRestore(source, destination string, remoteServer *common.RsyncServerCo
 	options := RsyncOptions{
 		Source:      source,
 		Destination: destination,
+		Include:     opts.Include,
 		Archive:     true,
+		Compression: opts.Compression && remoteServer != nil,
+		NoOwner:     opts.NoOwner,
 		Progress:    true,
 	}
-
-	// Si on utilise un serveur distant comme source
-	if remoteServer != nil {
-		options.Remote = true
-		options.SSHPort = remoteServer.SSHPort
-		options.Username = remoteServer.Username
-		options.SSHPrivateKeyPath = remoteServer.SSHPrivateKeyPath
-		options.SSHHostKeyFingerprint = remoteServer.SSHHostKeyFingerprint
-		
-		// La source devient une référence distante
-		if remoteServer.DefaultModule != "" {
-			options.Source = fmt.Sprintf("%s@%s::%s/", 
-				remoteServer.Username, 
-				remoteServer.IP, 
-				remoteServer.DefaultModule)
-		} else {
-			options.Source = fmt.Sprintf("%s@%s:", 
-				remoteServer.Username, 
-				remoteServer.IP)
-		}
-	}
+	setRemoteOptions(&options, remoteServer)
 
 	// Exécuter rsync
 	common.LogInfo("Lancement de rsync pour la restauration de %s vers %s...", source, destination)
@@ -429,6 +444,88 @@ func RsyncRestore(source, destination string, remoteServer *common.RsyncServerCo
 	return nil
 }
 
+// RsyncFetch copie un fichier ou un répertoire d'un serveur distant dans le répertoire local
+// destination, et renvoie le chemin local obtenu
+func RsyncFetch(remotePath, destination string, remoteServer *common.RsyncServerConfig) (string, error) {
+	source := strings.TrimSuffix(RemotePath(remoteServer, remotePath), "/")
+	common.LogInfo("Récupération de %s dans %s.", source, destination)
+	if err := os.MkdirAll(destination, 0700); err != nil {
+		return "", fmt.Errorf("impossible de créer le répertoire %s: %w", destination, err)
+	}
+
+	options := RsyncOptions{
+		Source:      source,
+		Destination: destination + "/",
+		Archive:     true,
+		Progress:    true,
+		// La récupération n'est qu'une étape: la sortie standard reste libre pour le résultat
+		Stdout: os.Stderr,
+	}
+	setRemoteOptions(&options, remoteServer)
+	if err := ExecuteRsync(options); err != nil {
+		common.LogError("Erreur rsync lors de la récupération de %s: %v", source, err)
+		return "", fmt.Errorf("impossible de récupérer %s: %v", source, err)
+	}
+
+	// rsync place l'élément copié dans destination sous son propre nom
+	name := source[strings.LastIndexAny(source, ":/")+1:]
+	return filepath.Join(destination, name), nil
+}
+
+// RemotePath renvoie la référence rsync d'un chemin sur un serveur distant. Les chemins
+// enregistrés par RsyncBackup sont déjà des références complètes et sont renvoyés tels quels.
+func RemotePath(remoteServer *common.RsyncServerConfig, path string) string {
+	// "hôte:chemin" ou "hôte::module/chemin": le nom d'hôte précède le premier deux-points
+	if colon := strings.Index(path, ":"); colon > 0 && !strings.Contains(path[:colon], "/") {
+		return path
+	}
+
+	host := remoteServer.IP
+	if remoteServer.Username != "" {
+		host = remoteServer.Username + "@" + host
+	}
+	if remoteServer.DefaultModule != "" {
+		return fmt.Sprintf("%s::%s/%s", host, remoteServer.DefaultModule, strings.TrimPrefix(path, "/"))
+	}
+	return fmt.Sprintf("%s:%s", host, path)
+}
+
+// setRemoteOptions configure la connexion à un serveur distant, comme pour la sauvegarde
+func setRemoteOptions(options *RsyncOptions, remoteServer *common.RsyncServerConfig) {
+	if remoteServer == nil {
+		return
+	}
+	options.Remote = true
+	options.SSHPort = remoteServer.SSHPort
+	options.Username = remoteServer.Username
+	options.Module = remoteServer.DefaultModule
+	options.SSHPrivateKeyPath = remoteServer.SSHPrivateKeyPath
+	options.SSHHostKeyFingerprint = remoteServer.SSHHostKeyFingerprint
+}
+
+// writeFileList écrit une liste de chemins pour --files-from --from0 dans un fichier temporaire
+func writeFileList(files []string) (string, error) {
+	list, err := os.CreateTemp("", "saveme-files-")
+	if err != nil {
+		return "", fmt.Errorf("impossible de créer la liste des fichiers à transférer: %w", err)
+	}
+	w := bufio.NewWriter(list)
+	for _, file := range files {
+		w.WriteString(file)
+		w.WriteByte(0)
+	}
+	if err := w.Flush(); err != nil {
+		list.Close()
+		os.Remove(list.Name())
+		return "", fmt.Errorf("impossible d'écrire la liste des fichiers à transférer: %w", err)
+	}
+	if err := list.Close(); err != nil {
+		os.Remove(list.Name())
+		return "", fmt.Errorf("impossible d'écrire la liste des fichiers à transférer: %w", err)
+	}
+	return list.Name(), nil
+}
+
 // BackupOptions contient les options pour la création de sauvegarde
 type BackupOptions struct {
 	// Incremental indique s'il s'agit d'une sauvegarde incrémentielle
@@ -439,4 +536,17 @@ type BackupOptions struct {
 	ExcludeDirs []string
 	// ExcludeFiles est la liste des fichiers à exclure
 	ExcludeFiles []string
-}
\ No newline at end of file
+	// Files limite le transfert à ces chemins relatifs à la source, sans parcourir le reste
+	// de l'arborescence ni supprimer quoi que ce soit de la destination (tout si nil)
+	Files []string
+}
+
+// RestoreOptions contient les options pour la restauration de sauvegarde
+type RestoreOptions struct {
+	// Include est la liste des chemins et motifs à restaurer (tout si vide)
+	Include []string
+	// Compression compresse le transfert depuis un serveur distant (-z)
+	Compression bool
+	// NoOwner ne reproduit pas le propriétaire et le groupe des fichiers sauvegardés
+	NoOwner bool
+}
@@ -0,0 +1,123 @@
+package wrappers
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+// statsWriter relit la sortie de rsync au fil de l'eau et en extrait le bloc --stats.
+// Les lignes de progression, séparées par des retours chariot, sont ignorées.
+type statsWriter struct {
+	stats common.TransferStats
+	found bool
+	line  []byte
+}
+
+func (w *statsWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' || b == '\r' {
+			w.parseLine(string(w.line))
+			w.line = w.line[:0]
+			continue
+		}
+		w.line = append(w.line, b)
+	}
+	return len(p), nil
+}
+
+// result renvoie les statistiques lues, ou nil si rsync n'en a pas affiché
+func (w *statsWriter) result() *common.TransferStats {
+	w.parseLine(string(w.line))
+	w.line = w.line[:0]
+	if !w.found {
+		return nil
+	}
+	stats := w.stats
+	return &stats
+}
+
+// parseLine interprète une ligne du bloc de statistiques de rsync (3.0 et suivants)
+func (w *statsWriter) parseLine(line string) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "total size is ") {
+		if i := strings.Index(line, "speedup is "); i >= 0 {
+			value := strings.Fields(line[i+len("speedup is "):])
+			if len(value) > 0 {
+				if speedup, err := strconv.ParseFloat(strings.ReplaceAll(value[0], ",", ""), 64); err == nil {
+					w.stats.Speedup = speedup
+				}
+			}
+		}
+		return
+	}
+
+	sep := strings.Index(line, ": ")
+	if sep < 0 {
+		return
+	}
+	value := parseStatsNumber(line[sep+2:])
+	s := &w.stats
+	switch line[:sep] {
+	case "Number of files":
+		s.Files = value
+	case "Number of created files":
+		s.CreatedFiles = value
+	case "Number of deleted files":
+		s.DeletedFiles = value
+	case "Number of regular files transferred", "Number of files transferred":
+		s.TransferredFiles = value
+	case "Total file size":
+		s.TotalSize = value
+	case "Total transferred file size":
+		s.TransferredSize = value
+	case "Literal data":
+		s.LiteralData = value
+	case "Matched data":
+		s.MatchedData = value
+	case "Total bytes sent":
+		s.BytesSent = value
+	case "Total bytes received":
+		s.BytesReceived = value
+	default:
+		return
+	}
+	w.found = true
+}
+
+// parseStatsNumber lit le premier nombre d'une valeur comme "1,234 bytes" ou "5 (reg: 3, dir: 2)"
+func parseStatsNumber(value string) int64 {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0
+	}
+	// Les séparateurs de milliers dépendent de la locale
+	digits := strings.NewReplacer(",", "", ".", "", "'", "").Replace(fields[0])
+	n, _ := strconv.ParseInt(digits, 10, 64)
+	return n
+}
+
+// errorCounter transmet la sortie d'erreur de rsync et compte les erreurs signalées par fichier
+type errorCounter struct {
+	w     io.Writer
+	count int
+	line  []byte
+}
+
+func (e *errorCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != '\n' {
+			e.line = append(e.line, b)
+			continue
+		}
+		// "rsync error:" est le résumé final, les autres lignes "rsync:" décrivent chaque échec
+		if bytes.HasPrefix(e.line, []byte("rsync: ")) {
+			e.count++
+		}
+		e.line = e.line[:0]
+	}
+	return e.w.Write(p)
+}
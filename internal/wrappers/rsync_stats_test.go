@@ -0,0 +1,83 @@
+package wrappers
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+func TestStatsWriter(t *testing.T) {
+	output := strings.Join([]string{
+		"sending incremental file list",
+		"new.txt",
+		"          1,024 100%    0.00kB/s    0:00:00\r          2,048 100%    1.95MB/s    0:00:00 (xfr#1, to-chk=0/3)",
+		"",
+		"Number of files: 3 (reg: 2, dir: 1)",
+		"Number of created files: 1 (reg: 1)",
+		"Number of deleted files: 0",
+		"Number of regular files transferred: 1",
+		"Total file size: 4,096 bytes",
+		"Total transferred file size: 2,048 bytes",
+		"Literal data: 2,000 bytes",
+		"Matched data: 48 bytes",
+		"File list size: 0",
+		"Total bytes sent: 2,210",
+		"Total bytes received: 38",
+		"",
+		"sent 2,210 bytes  received 38 bytes  4,496.00 bytes/sec",
+		"total size is 4,096  speedup is 1.82",
+	}, "\n")
+
+	w := &statsWriter{}
+	// Écrire par petits morceaux pour vérifier le découpage des lignes
+	for i := 0; i < len(output); i += 7 {
+		end := i + 7
+		if end > len(output) {
+			end = len(output)
+		}
+		w.Write([]byte(output[i:end]))
+	}
+
+	stats := w.result()
+	if stats == nil {
+		t.Fatal("Expected stats, got nil")
+	}
+	expected := common.TransferStats{
+		Files:            3,
+		CreatedFiles:     1,
+		TransferredFiles: 1,
+		TotalSize:        4096,
+		TransferredSize:  2048,
+		LiteralData:      2000,
+		MatchedData:      48,
+		BytesSent:        2210,
+		BytesReceived:    38,
+		Speedup:          1.82,
+	}
+	if *stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *stats)
+	}
+}
+
+func TestStatsWriterWithoutStats(t *testing.T) {
+	w := &statsWriter{}
+	w.Write([]byte(">f+++++++++ new.txt\n"))
+	if stats := w.result(); stats != nil {
+		t.Errorf("Expected nil stats, got %+v", stats)
+	}
+}
+
+func TestErrorCounter(t *testing.T) {
+	var out bytes.Buffer
+	e := &errorCounter{w: &out}
+	e.Write([]byte("rsync: send_files failed to open \"/src/a\": Permission denied (13)\nrsync: [sender] read errors mapping \"/src/b\"\n"))
+	e.Write([]byte("rsync error: some files/attrs were not transferred (code 23)\n"))
+	if e.count != 2 {
+		t.Errorf("Expected 2 errors, got %d", e.count)
+	}
+	if !strings.Contains(out.String(), "code 23") {
+		t.Errorf("Expected stderr to be forwarded, got %q", out.String())
+	}
+}
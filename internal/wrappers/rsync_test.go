@@ -0,0 +1,41 @@
+package wrappers
+
+import (
+	"testing"
+
+	"github.com/Noziop/s4v3my4ss/pkg/common"
+)
+
+func TestRemotePath(t *testing.T) {
+	module := &common.RsyncServerConfig{IP: "192.168.1.10", Username: "nas", DefaultModule: "backups"}
+	ssh := &common.RsyncServerConfig{IP: "192.168.1.10", Username: "nas"}
+
+	tests := []struct {
+		server *common.RsyncServerConfig
+		path   string
+		want   string
+	}{
+		{module, "nas@192.168.1.10::backups/docs_2024-01-02_10-00-00_abc123/", "nas@192.168.1.10::backups/docs_2024-01-02_10-00-00_abc123/"},
+		{ssh, "nas@192.168.1.10:/srv/backups/docs_x/", "nas@192.168.1.10:/srv/backups/docs_x/"},
+		{module, "docs_x/archive.tar.gz", "nas@192.168.1.10::backups/docs_x/archive.tar.gz"},
+		{ssh, "/srv/backups/docs_x", "nas@192.168.1.10:/srv/backups/docs_x"},
+		{ssh, "/srv/a:b", "nas@192.168.1.10:/srv/a:b"},
+	}
+	for _, tt := range tests {
+		if got := RemotePath(tt.server, tt.path); got != tt.want {
+			t.Errorf("RemotePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteLinkDest(t *testing.T) {
+	tests := map[string]string{
+		"nas@192.168.1.10::backups/docs_2024-01-02_10-00-00_abc123/": "../docs_2024-01-02_10-00-00_abc123",
+		"nas@192.168.1.10:/srv/backups/docs_x/":                      "../docs_x",
+	}
+	for path, want := range tests {
+		if got := remoteLinkDest(path); got != want {
+			t.Errorf("remoteLinkDest(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -21,6 +21,44 @@ type BackupInfo struct {
 	Encrypted     bool               `json:"encrypted,omitempty"`
 	RemoteServer  *RsyncServerConfig `json:"remoteServer,omitempty"` // Serveur rsync distant si applicable
 	DestinationName string `json:"destinationName,omitempty"` // Nom de la destination utilisée
+	ParentID        string `json:"parentId,omitempty"`        // ID de la sauvegarde utilisée comme base (--link-dest)
+	Type            string `json:"type,omitempty"`            // BackupModeFull, BackupModeIncremental ou BackupModeDifferential
+	Format          string `json:"format,omitempty"`          // Format de stockage, FormatChunks si BackupPath est un dépôt de blocs
+	ManifestPath    string `json:"manifestPath,omitempty"`    // Manifeste (chemins, tailles, empreintes) écrit à côté de la sauvegarde
+	Stats           *TransferStats `json:"stats,omitempty"`     // Statistiques du transfert rsync (rsync --stats)
+}
+
+// TransferStats contient les statistiques d'un transfert rsync
+type TransferStats struct {
+	Files            int64   `json:"files"`            // Éléments examinés dans la source
+	CreatedFiles     int64   `json:"createdFiles"`     // Éléments créés dans la sauvegarde
+	DeletedFiles     int64   `json:"deletedFiles"`     // Éléments supprimés de la destination
+	TransferredFiles int64   `json:"transferredFiles"` // Fichiers réguliers transférés
+	TotalSize        int64   `json:"totalSize"`        // Taille totale des fichiers de la source
+	TransferredSize  int64   `json:"transferredSize"`  // Taille des fichiers transférés
+	LiteralData      int64   `json:"literalData"`      // Octets copiés tels quels
+	MatchedData      int64   `json:"matchedData"`      // Octets repris d'une version existante
+	BytesSent        int64   `json:"bytesSent"`
+	BytesReceived    int64   `json:"bytesReceived"`
+	Speedup          float64 `json:"speedup"`
+	Errors           int     `json:"errors,omitempty"` // Erreurs signalées par rsync
+}
+
+// BackupType renvoie le type de la sauvegarde (complète, incrémentielle ou différentielle).
+// Les métadonnées antérieures au champ Type sont interprétées à partir de IsIncremental.
+func (b BackupInfo) BackupType() string {
+	if b.Type != "" {
+		return b.Type
+	}
+	if b.IsIncremental {
+		return BackupModeIncremental
+	}
+	return BackupModeFull
+}
+
+// IsFull indique si la sauvegarde est complète et peut servir de base différentielle
+func (b BackupInfo) IsFull() bool {
+	return b.BackupType() == BackupModeFull
 }
 
 // SaveBackupInfo sauvegarde les métadonnées d'une sauvegarde
@@ -98,7 +136,10 @@ func DeleteBackup(id string) error {
 	}
 
 	// Supprimer le fichier de sauvegarde s'il est local
-	if backup.RemoteServer == nil {
+	if backup.Format == FormatChunks {
+		// BackupPath désigne le dépôt partagé: l'instantané et ses blocs sont gérés par le dépôt
+		LogInfo("La sauvegarde '%s' est stockée dans le dépôt %s, seules ses métadonnées sont supprimées ici.", backup.ID, backup.BackupPath)
+	} else if backup.RemoteServer == nil {
 		// Si c'est un fichier local
 		if FileExists(backup.BackupPath) {
 			// Si c'est un fichier (sauvegarde compressée)
@@ -119,6 +160,13 @@ func DeleteBackup(id string) error {
 		LogInfo("La sauvegarde '%s' est distante, la suppression du fichier distant doit être gérée manuellement.", backup.ID)
 	}
 
+	// Supprimer le manifeste de la sauvegarde
+	if backup.ManifestPath != "" && FileExists(backup.ManifestPath) {
+		if err := os.Remove(backup.ManifestPath); err != nil {
+			LogWarning("Impossible de supprimer le manifeste %s: %v", backup.ManifestPath, err)
+		}
+	}
+
 	// Supprimer le fichier de métadonnées
 	metaPath := filepath.Join(BackupInfoDir, id+".json")
 	if err := os.Remove(metaPath); err != nil {
@@ -18,7 +18,7 @@ type Config struct {
 	RsyncServers       []RsyncServerConfig `json:"rsyncServers"`
 	RetentionPolicy    RetentionPolicy     `json:"retentionPolicy"`
 	Security           SecurityConfig      `json:"security,omitempty"` // Configuration de sécurité
-	EncryptionKey      string              `json:"encryptionKey,omitempty"`   // Clé de chiffrement (pour une future implémentation)
+	EncryptionKey      string              `json:"encryptionKey,omitempty"`   // Phrase secrète de chiffrement (SAVEME_PASSPHRASE est prioritaire)
 	LastUpdate         time.Time           `json:"last_update"`
 }
 
@@ -35,8 +35,20 @@ type BackupDestination struct {
 	Type        string `json:"type"`        // Type: "local", "rsync", "cloud", etc.
 	IsDefault   bool   `json:"isDefault"`   // Indique si c'est la destination par défaut
 	RsyncServer *RsyncServerConfig `json:"rsyncServer,omitempty"` // Configuration rsync si applicable
+	Format      string `json:"format,omitempty"` // Format de stockage: vide (répertoires rsync/archives) ou "chunks"
 }
 
+// FormatChunks désigne un dépôt de blocs dédupliqués (voir internal/chunkstore)
+const FormatChunks = "chunks"
+
+// Modes de sauvegarde. Une sauvegarde incrémentielle se base sur la précédente,
+// une sauvegarde différentielle sur la dernière sauvegarde complète.
+const (
+	BackupModeFull         = "full"
+	BackupModeIncremental  = "incremental"
+	BackupModeDifferential = "differential"
+)
+
 // BackupConfig contient la configuration pour un répertoire à sauvegarder
 type BackupConfig struct {
 	SourcePath    string   `json:"sourcePath"`
@@ -44,11 +56,52 @@ type BackupConfig struct {
 	Compression   bool     `json:"compression"`
 	Encrypt       bool     `json:"encrypt,omitempty"` // Activer le chiffrement pour cette sauvegarde
 	IsIncremental bool     `json:"isIncremental"` // Indique si la sauvegarde doit être incrémentale
+	Mode          string   `json:"mode,omitempty"` // BackupModeFull, BackupModeIncremental ou BackupModeDifferential (déduit de IsIncremental si vide)
+	FullEveryRuns int      `json:"fullEveryRuns,omitempty"` // Forcer une sauvegarde complète toutes les N exécutions (0 pour désactiver)
+	FullEveryDays int      `json:"fullEveryDays,omitempty"` // Forcer une sauvegarde complète tous les N jours (0 pour désactiver)
 	ExcludeDirs   []string `json:"excludeDirs,omitempty"`
 	ExcludeFiles  []string `json:"excludeFiles,omitempty"`
 	Interval      int      `json:"interval"` // en minutes, 0 pour désactiver
+	Watch         bool     `json:"watch,omitempty"` // Sauvegarder à chaque modification en mode démon
+	WatchDebounce    int   `json:"watchDebounce,omitempty"`    // Calme requis après une modification, en secondes (DefaultWatchDebounce si 0)
+	WatchMinInterval int   `json:"watchMinInterval,omitempty"` // Délai minimal entre deux sauvegardes surveillées, en secondes (DefaultWatchMinInterval si 0)
+	WatchMaxLatency  int   `json:"watchMaxLatency,omitempty"`  // Délai maximal entre une modification et sa sauvegarde, en secondes (DefaultWatchMaxLatency si 0)
+	Schedule      string   `json:"schedule,omitempty"` // Planification cron (ex: "0 18 * * 1-5", "@daily") en mode démon
 	RemoteServer  *RsyncServerConfig `json:"remoteServer,omitempty"` // Serveur rsync distant
 	DestinationName string `json:"destinationName,omitempty"` // Nom de la destination à utiliser (si vide, utilise la destination par défaut)
+	PreHooks      []Hook   `json:"preHooks,omitempty"` // Commandes exécutées avant chaque sauvegarde
+	PostHooks     []Hook   `json:"postHooks,omitempty"` // Commandes exécutées après chaque sauvegarde
+}
+
+// Valeurs par défaut de la surveillance des modifications, en secondes
+const (
+	DefaultWatchDebounce    = 5
+	DefaultWatchMinInterval = 10
+	DefaultWatchMaxLatency  = 300
+)
+
+// DefaultHookTimeout est la durée maximale d'exécution d'un hook, en secondes, si Timeout n'est pas défini
+const DefaultHookTimeout = 300
+
+// Hook décrit une commande exécutée autour d'une sauvegarde (export de base de données,
+// arrêt d'un service, notification...). La commande est exécutée directement, sans shell.
+type Hook struct {
+	Command      string            `json:"command"`
+	Args         []string          `json:"args,omitempty"`
+	Timeout      int               `json:"timeout,omitempty"`      // en secondes, DefaultHookTimeout si 0
+	Env          map[string]string `json:"env,omitempty"`          // Variables d'environnement supplémentaires
+	RunOnFailure bool              `json:"runOnFailure,omitempty"` // Exécuter même si la sauvegarde ou un hook précédent a échoué
+}
+
+// BackupMode renvoie le mode de sauvegarde de la configuration
+func (c BackupConfig) BackupMode() string {
+	if c.Mode != "" {
+		return c.Mode
+	}
+	if c.IsIncremental {
+		return BackupModeIncremental
+	}
+	return BackupModeFull
 }
 
 // RetentionPolicy définit combien de temps les sauvegardes sont conservées
@@ -330,6 +383,21 @@ func GetBackupDestination(name string) (BackupDestination, bool) {
 	return BackupDestination{}, false
 }
 
+// EncryptionPassphraseEnv est la variable d'environnement qui fournit la phrase secrète de chiffrement.
+// Elle est prioritaire sur Config.EncryptionKey et évite de stocker la phrase secrète sur disque.
+const EncryptionPassphraseEnv = "SAVEME_PASSPHRASE"
+
+// EncryptionPassphrase renvoie la phrase secrète utilisée pour chiffrer et déchiffrer les sauvegardes
+func EncryptionPassphrase() (string, error) {
+	if passphrase := os.Getenv(EncryptionPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if AppConfig.EncryptionKey != "" {
+		return AppConfig.EncryptionKey, nil
+	}
+	return "", fmt.Errorf("aucune phrase secrète de chiffrement: définissez %s ou encryptionKey dans la configuration", EncryptionPassphraseEnv)
+}
+
 // DeleteBackupDestination supprime une destination de sauvegarde
 func DeleteBackupDestination(name string) error {
 	// Trouver la destination à supprimer pour vérifier si c'est la destination par défaut
@@ -520,6 +588,32 @@ func (c *Config) ValidateConfig() error {
 			LogError("Chemin source invalide dans la configuration '%s': %s", dir.Name, dir.SourcePath)
 			return fmt.Errorf("chemin source invalide dans la configuration '%s': %s", dir.Name, dir.SourcePath)
 		}
+		switch dir.Mode {
+		case "", BackupModeFull, BackupModeIncremental, BackupModeDifferential:
+		default:
+			LogError("Mode de sauvegarde inconnu pour '%s': %s", dir.Name, dir.Mode)
+			return fmt.Errorf("mode de sauvegarde inconnu pour '%s': %s", dir.Name, dir.Mode)
+		}
+		if dir.Schedule != "" {
+			if _, err := ParseSchedule(dir.Schedule); err != nil {
+				LogError("Planification invalide pour '%s': %v", dir.Name, err)
+				return fmt.Errorf("configuration '%s': %w", dir.Name, err)
+			}
+		}
+		if dir.WatchDebounce < 0 || dir.WatchMinInterval < 0 || dir.WatchMaxLatency < 0 {
+			LogError("Délais de surveillance invalides pour '%s'", dir.Name)
+			return fmt.Errorf("délais de surveillance invalides pour '%s'", dir.Name)
+		}
+		if dir.FullEveryRuns < 0 || dir.FullEveryDays < 0 {
+			LogError("Règle de sauvegarde complète invalide pour '%s'", dir.Name)
+			return fmt.Errorf("règle de sauvegarde complète invalide pour '%s'", dir.Name)
+		}
+		for _, hook := range append(append([]Hook{}, dir.PreHooks...), dir.PostHooks...) {
+			if hook.Command == "" || hook.Timeout < 0 {
+				LogError("Hook invalide dans la configuration '%s': %q", dir.Name, hook.Command)
+				return fmt.Errorf("hook invalide dans la configuration '%s': %q", dir.Name, hook.Command)
+			}
+		}
 	}
 
 	for _, dest := range c.BackupDestinations {
@@ -531,6 +625,10 @@ func (c *Config) ValidateConfig() error {
 			LogError("Chemin de destination invalide pour '%s': %s", dest.Name, dest.Path)
 			return fmt.Errorf("chemin de destination invalide pour '%s': %s", dest.Name, dest.Path)
 		}
+		if dest.Format != "" && dest.Format != FormatChunks {
+			LogError("Format de stockage inconnu pour '%s': %s", dest.Name, dest.Format)
+			return fmt.Errorf("format de stockage inconnu pour '%s': %s", dest.Name, dest.Format)
+		}
 	}
 
 	for _, server := range c.RsyncServers {
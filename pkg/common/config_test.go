@@ -95,4 +95,22 @@ func TestGetBackupConfig(t *testing.T) {
 	if found {
 		t.Errorf("GetBackupConfig unexpectedly found non-existent config")
 	}
-}
\ No newline at end of file
+}
+
+func TestBackupModeFallsBackToIsIncremental(t *testing.T) {
+	if mode := (BackupConfig{IsIncremental: true}).BackupMode(); mode != BackupModeIncremental {
+		t.Errorf("Expected legacy incremental config to be %s, got %s", BackupModeIncremental, mode)
+	}
+	if mode := (BackupConfig{Mode: BackupModeDifferential}).BackupMode(); mode != BackupModeDifferential {
+		t.Errorf("Expected %s, got %s", BackupModeDifferential, mode)
+	}
+
+	legacy := BackupInfo{IsIncremental: false}
+	if !legacy.IsFull() {
+		t.Error("Expected legacy non-incremental backup to be a full base")
+	}
+	diff := BackupInfo{IsIncremental: true, Type: BackupModeDifferential}
+	if diff.IsFull() || diff.BackupType() != BackupModeDifferential {
+		t.Errorf("Expected differential backup, got %s", diff.BackupType())
+	}
+}
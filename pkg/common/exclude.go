@@ -0,0 +1,125 @@
+package common
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// IsExcluded indique si un chemin relatif à la racine d'une sauvegarde doit être exclu.
+// Les listes d'exclusion sont interprétées comme les options --exclude de rsync:
+// un motif sans slash est comparé au nom de l'élément à n'importe quel niveau,
+// un motif commençant par un slash est ancré à la racine, et un motif terminé
+// par un slash ne s'applique qu'aux répertoires.
+func IsExcluded(relPath string, isDir bool, excludeDirs, excludeFiles []string) bool {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if relPath == "." || relPath == "" {
+		return false
+	}
+
+	for _, pattern := range excludeDirs {
+		if matchExcludePattern(pattern, relPath, isDir) {
+			return true
+		}
+	}
+	for _, pattern := range excludeFiles {
+		if matchExcludePattern(pattern, relPath, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchExcludePattern compare un motif d'exclusion de type rsync à un chemin relatif
+func matchExcludePattern(pattern, relPath string, isDir bool) bool {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return false
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		if !isDir {
+			return false
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	// Motif ancré à la racine de la sauvegarde
+	if strings.HasPrefix(pattern, "/") {
+		matched, err := filepath.Match(strings.TrimPrefix(pattern, "/"), relPath)
+		return err == nil && matched
+	}
+
+	// Motif contenant un slash: comparer aux suffixes du chemin
+	if strings.Contains(pattern, "/") {
+		parts := strings.Split(relPath, "/")
+		for i := range parts {
+			matched, err := filepath.Match(pattern, strings.Join(parts[i:], "/"))
+			if err == nil && matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	matched, err := filepath.Match(pattern, filepath.Base(relPath))
+	return err == nil && matched
+}
+
+// IsIncluded indique si un chemin relatif à la racine d'une sauvegarde est retenu par
+// une liste de motifs de restauration sélective. Un motif est ancré à la racine de la
+// sauvegarde, "*" ne traverse pas les slashes et "**" correspond à un nombre quelconque
+// de répertoires. Un élément est retenu si lui-même ou l'un de ses répertoires parents
+// correspond à un motif. Une liste vide retient tout.
+func IsIncluded(relPath string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if relPath == "." || relPath == "" {
+		return false
+	}
+
+	parts := strings.Split(relPath, "/")
+	for _, pattern := range patterns {
+		patternParts := splitIncludePattern(pattern)
+		if len(patternParts) == 0 {
+			continue
+		}
+		for i := 1; i <= len(parts); i++ {
+			if matchPathSegments(patternParts, parts[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitIncludePattern normalise un motif de restauration et le découpe en segments
+func splitIncludePattern(pattern string) []string {
+	pattern = strings.TrimSpace(filepath.ToSlash(pattern))
+	pattern = strings.Trim(strings.TrimPrefix(pattern, "./"), "/")
+	if pattern == "" || pattern == "." {
+		return nil
+	}
+	return strings.Split(pattern, "/")
+}
+
+// matchPathSegments compare segment par segment un motif (pouvant contenir "**") à un chemin
+func matchPathSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchPathSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	matched, err := filepath.Match(pattern[0], parts[0])
+	return err == nil && matched && matchPathSegments(pattern[1:], parts[1:])
+}
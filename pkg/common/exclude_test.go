@@ -0,0 +1,32 @@
+package common
+
+import "testing"
+
+func TestIsIncluded(t *testing.T) {
+	testCases := []struct {
+		path     string
+		patterns []string
+		expected bool
+	}{
+		{"src/main.go", nil, true},
+		{"src/main.go", []string{"src/main.go"}, true},
+		{"src/main.go", []string{"/src/main.go"}, true},
+		{"src/pkg/util.go", []string{"src"}, true},
+		{"src/pkg/util.go", []string{"src/"}, true},
+		{"src/pkg/util.go", []string{"src/*.go"}, false},
+		{"src/pkg/util.go", []string{"src/**/*.go"}, true},
+		{"src/util.go", []string{"src/**/*.go"}, true},
+		{"src/README.md", []string{"src/**/*.go"}, false},
+		{"docs/main.go", []string{"src/**/*.go"}, false},
+		{"main.go", []string{"*.go"}, true},
+		{"cmd/main.go", []string{"*.go"}, false},
+		{"cmd/main.go", []string{"**/main.go"}, true},
+		{"config/app.yml", []string{"notes.txt", "config"}, true},
+	}
+
+	for _, tc := range testCases {
+		if got := IsIncluded(tc.path, tc.patterns); got != tc.expected {
+			t.Errorf("IsIncluded(%q, %q) = %t, expected %t", tc.path, tc.patterns, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleShorthands sont les raccourcis acceptés à la place d'une expression cron
+var scheduleShorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// scheduleField décrit un champ d'une expression cron: bornes et noms acceptés
+type scheduleField struct {
+	name     string
+	min, max int
+	names    []string // Noms des valeurs à partir de min (mois, jours de la semaine)
+}
+
+var scheduleFields = []scheduleField{
+	{name: "minute", min: 0, max: 59},
+	{name: "heure", min: 0, max: 23},
+	{name: "jour du mois", min: 1, max: 31},
+	{name: "mois", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 désigne aussi le dimanche
+	{name: "jour de la semaine", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// maxScheduleSearch borne la recherche de la prochaine exécution (une date impossible, comme
+// le 30 février, n'en a aucune)
+const maxScheduleSearch = 5 * 366 * 24 * time.Hour
+
+// Schedule est une planification au format cron: "minute heure jour mois jour_semaine",
+// ou l'un des raccourcis @hourly, @daily, @weekly, @monthly et @yearly
+type Schedule struct {
+	expr                          string
+	minute, hour, dom, month, dow uint64 // Ensembles de valeurs acceptées, un bit par valeur
+	domAny, dowAny                bool   // Jour du mois ou de la semaine non restreint ("*")
+}
+
+// ParseSchedule analyse une expression cron. Chaque champ accepte "*", une valeur, un
+// intervalle "a-b", un pas "*/n" ou "a-b/n" et des listes séparées par des virgules; les mois
+// et jours de la semaine acceptent leur nom anglais abrégé (jan, mon...).
+func ParseSchedule(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if shorthand, ok := scheduleShorthands[strings.ToLower(spec)]; ok {
+		spec = shorthand
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(scheduleFields) {
+		return nil, fmt.Errorf("planification invalide %q: 5 champs attendus (minute heure jour mois jour_semaine) ou un raccourci (@daily...)", expr)
+	}
+
+	s := &Schedule{expr: expr}
+	sets := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, field := range fields {
+		set, err := parseScheduleField(field, scheduleFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("planification invalide %q: %w", expr, err)
+		}
+		*sets[i] = set
+	}
+	// Le dimanche peut s'écrire 0 ou 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+
+	if s.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("planification invalide %q: aucune date ne correspond", expr)
+	}
+	return s, nil
+}
+
+// parseScheduleField analyse un champ d'une expression cron
+func parseScheduleField(value string, field scheduleField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(value, ",") {
+		rangePart, step := part, 1
+		if slash := strings.Index(part, "/"); slash >= 0 {
+			n, err := strconv.Atoi(part[slash+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("pas invalide pour le champ %s: %q", field.name, part)
+			}
+			rangePart, step = part[:slash], n
+		}
+
+		low, high := field.min, field.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = scheduleValue(bounds[0], field); err != nil {
+				return 0, err
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = scheduleValue(bounds[1], field); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// "a/n": de a jusqu'à la fin du champ
+				high = field.max
+			}
+			if high < low {
+				return 0, fmt.Errorf("intervalle invalide pour le champ %s: %q", field.name, rangePart)
+			}
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// scheduleValue convertit une valeur d'un champ, numérique ou nommée
+func scheduleValue(value string, field scheduleField) (int, error) {
+	for i, name := range field.names {
+		if strings.EqualFold(value, name) {
+			return field.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < field.min || v > field.max {
+		return 0, fmt.Errorf("valeur invalide pour le champ %s: %q (de %d à %d)", field.name, value, field.min, field.max)
+	}
+	return v, nil
+}
+
+// String renvoie l'expression d'origine
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next renvoie la première date prévue strictement après after, dans le fuseau de after,
+// ou la date zéro si aucune date ne correspond. Les créneaux sont des heures murales: lors du
+// passage à l'heure d'hiver, un créneau de l'heure répétée n'a lieu qu'une fois (la première),
+// et lors du passage à l'heure d'été, les créneaux de l'heure sautée ont lieu au changement
+// d'heure (par exemple à 03:00 pour un créneau à 02:30).
+func (s *Schedule) Next(after time.Time) time.Time {
+	start := wallClock(after).Add(time.Minute)
+	limit := start.Add(maxScheduleSearch)
+	for wall := s.nextWall(start, limit); !wall.IsZero(); wall = s.nextWall(wall.Add(time.Minute), limit) {
+		// Un créneau de l'heure répétée peut précéder after, déjà dans sa seconde occurrence
+		if t := slotTime(wall, after.Location()); t.After(after) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// nextWall renvoie le premier créneau, en heure murale exprimée en UTC, à partir de t et
+// avant limit, ou la date zéro s'il n'y en a aucun
+func (s *Schedule) nextWall(t, limit time.Time) time.Time {
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// wallClock renvoie l'heure murale de t, à la minute, exprimée en UTC pour ne plus dépendre
+// des changements d'heure
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// slotTime renvoie l'instant où l'heure murale wall est atteinte dans le fuseau loc: la
+// première occurrence si elle a lieu deux fois, l'instant du changement d'heure si elle n'existe pas
+func slotTime(wall time.Time, loc *time.Location) time.Time {
+	// Un changement d'heure ne décale l'heure murale que de quelques heures au plus
+	guess := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, loc)
+	var first time.Time
+	for _, around := range []time.Duration{-3 * time.Hour, 0, 3 * time.Hour} {
+		_, offset := guess.Add(around).Zone()
+		t := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if wallClock(t).Equal(wall) && (first.IsZero() || t.Before(first)) {
+			first = t
+		}
+	}
+	if !first.IsZero() {
+		return first
+	}
+
+	// Heure sautée: premier instant dont l'heure murale n'est pas antérieure à wall
+	low, high := guess.Add(-3*time.Hour), guess.Add(3*time.Hour)
+	for high.Sub(low) > time.Minute {
+		mid := low.Add(high.Sub(low) / 2).Truncate(time.Minute)
+		if wallClock(mid).Before(wall) {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return high
+}
+
+// dayMatches applique la règle de cron: si le jour du mois et le jour de la semaine sont
+// tous deux restreints, il suffit que l'un des deux corresponde
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
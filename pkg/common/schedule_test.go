@@ -0,0 +1,84 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// Mercredi 2 octobre 2024, 17:30
+	from := time.Date(2024, 10, 2, 17, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"@hourly", time.Date(2024, 10, 2, 18, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 10, 3, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 10, 6, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 18 * * 1-5", time.Date(2024, 10, 2, 18, 0, 0, 0, time.UTC)},
+		{"0 18 * * sat,sun", time.Date(2024, 10, 5, 18, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 10, 6, 9, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2024, 10, 2, 17, 40, 0, 0, time.UTC)},
+		{"30 17 * * *", time.Date(2024, 10, 3, 17, 30, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Jour du mois et jour de la semaine restreints: l'un ou l'autre
+		{"0 0 15 * mon", time.Date(2024, 10, 7, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) error = %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("ParseSchedule(%q).Next() = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleNextDaylightSaving(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("Europe/Paris time zone unavailable: %v", err)
+	}
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC).In(paris)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		// 31 mars 2024: 02:00 CET devient 03:00 CEST (01:00 UTC)
+		{"heure sautée", "30 2 * * *", utc(3, 31, 0, 0), utc(3, 31, 1, 0)},
+		{"après l'heure sautée", "30 2 * * *", utc(3, 31, 1, 0), utc(4, 1, 0, 30)},
+		{"créneaux de l'heure sautée regroupés", "*/15 2 * * *", utc(3, 31, 1, 0), utc(4, 1, 0, 0)},
+		{"heure suivant le saut", "0 3 * * *", utc(3, 30, 23, 0), utc(3, 31, 1, 0)},
+		// 27 octobre 2024: 03:00 CEST redevient 02:00 CET (01:00 UTC)
+		{"heure répétée, première occurrence", "30 2 * * *", utc(10, 26, 22, 0), utc(10, 27, 0, 30)},
+		{"heure répétée, pas de seconde exécution", "30 2 * * *", utc(10, 27, 0, 30), utc(10, 28, 1, 30)},
+		{"pendant la seconde occurrence", "30 2 * * *", utc(10, 27, 1, 10), utc(10, 28, 1, 30)},
+		{"heure suivant la répétition", "0 3 * * *", utc(10, 27, 0, 30), utc(10, 27, 2, 0)},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) error = %v", tt.expr, err)
+		}
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%s: ParseSchedule(%q).Next(%v) = %v, want %v", tt.name, tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{"", "@often", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "0 0 30 feb *", "0 0 * foo *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want error", expr)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package common
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -58,9 +61,38 @@ func IsValidExcludePattern(pattern string) bool {
 // IsValidCompressionFormat valide que le format de compression est supporté.
 func IsValidCompressionFormat(format string) bool {
 	switch format {
-	case "targz", "zip": // Utiliser les chaînes littérales car CompressionFormat n'est pas dans ce package
+	case "targz", "zip", "tarzst", "tarxz": // Utiliser les chaînes littérales car CompressionFormat n'est pas dans ce package
 		return true
 	default:
 		return false
 	}
-}
\ No newline at end of file
+}
+
+// CheckNoSymlinkAncestor vérifie qu'aucun des répertoires parents du chemin relatif rel, sous
+// root, n'est un lien symbolique. Une entrée extraite ou restaurée plus tôt pourrait sinon
+// faire écrire les suivantes hors de root.
+func CheckNoSymlinkAncestor(root, rel string) error {
+	dir := root
+	for _, part := range strings.Split(filepath.Dir(filepath.Clean(rel)), string(filepath.Separator)) {
+		if part == "" || part == "." {
+			continue
+		}
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			// Les composants suivants n'existent pas davantage et seront créés comme répertoires
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// SECURITY: refuser d'écrire à travers un lien symbolique
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("chemin %s traversant le lien symbolique %s", rel, dir)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("chemin %s traversant %s, qui n'est pas un répertoire", rel, dir)
+		}
+	}
+	return nil
+}